@@ -0,0 +1,159 @@
+package gds
+
+import (
+	"fmt"
+	"math"
+)
+
+// AngleClass classifies the edge directions of a shape, classes are ordered so that
+// shapes above a limit can be selected with class > limit
+type AngleClass int
+
+const (
+	// All edges are horizontal or vertical
+	AngleManhattan AngleClass = iota
+	// All edges are multiples of 45°
+	Angle45
+	// At least one edge has an arbitrary angle
+	AngleAny
+)
+
+func (a AngleClass) String() string {
+	switch a {
+	case AngleManhattan:
+		return "manhattan"
+	case Angle45:
+		return "45"
+	case AngleAny:
+		return "all-angle"
+	}
+	return fmt.Sprintf("AngleClass(%d)", int(a))
+}
+
+// ClassifyEdges returns the class of the polyline x0, y0, x1, y1, ... and the index of the first point of the
+// first edge that has this class, -1 for Manhattan polylines. Polygons are closed automatically.
+func ClassifyEdges(xy []int32) (AngleClass, int) {
+	points := make([]float64, len(xy))
+	for i, value := range xy {
+		points[i] = float64(value)
+	}
+	return classifyEdges(points, true)
+}
+
+func classifyEdges(xy []float64, closed bool) (AngleClass, int) {
+	n := len(xy) / 2
+	edges := n - 1
+	if closed {
+		edges = n
+	}
+	class, first := AngleManhattan, -1
+	for i := 0; i < edges; i++ {
+		j := (i + 1) % n
+		edgeClass := edgeAngleClass(xy[2*j]-xy[2*i], xy[2*j+1]-xy[2*i+1])
+		if edgeClass > class {
+			class, first = edgeClass, i
+		}
+	}
+	return class, first
+}
+
+// Tolerates rounding errors of transformed coordinates
+func edgeAngleClass(dx, dy float64) AngleClass {
+	dx, dy = math.Abs(dx), math.Abs(dy)
+	tolerance := 1e-9 * max(dx, dy)
+	switch {
+	case dx <= tolerance || dy <= tolerance:
+		return AngleManhattan
+	case math.Abs(dx-dy) <= tolerance:
+		return Angle45
+	}
+	return AngleAny
+}
+
+// AngleShape is a placement of a non-Manhattan boundary, box or path
+type AngleShape struct {
+	Cell    string       // structure that contains the element
+	Element int          // index into Structure.Elements
+	Path    InstancePath // instance of Cell that places the shape
+	Class   AngleClass
+	X, Y    float64 // start of the first edge of Class in top cell coordinates
+}
+
+func (a AngleShape) String() string {
+	return fmt.Sprintf("%v: %s[%d] is %v, edge at (%g, %g)", a.Path, a.Cell, a.Element, a.Class, a.X, a.Y)
+}
+
+// LayerAngles counts the placed shapes of a layer per class and lists the non-Manhattan shapes
+type LayerAngles struct {
+	Manhattan int
+	Angle45   int
+	AngleAny  int
+	Shapes    []AngleShape
+}
+
+// Class returns the highest class of all shapes on the layer
+func (l LayerAngles) Class() AngleClass {
+	switch {
+	case l.AngleAny > 0:
+		return AngleAny
+	case l.Angle45 > 0:
+		return Angle45
+	}
+	return AngleManhattan
+}
+
+// ClassifyAngles classifies every placement of boundaries, boxes and paths below top by the directions of their
+// edges in top cell coordinates, so Manhattan shapes in rotated references count as 45° or all-angle.
+// Paths are classified by their center line. The result is keyed by layer/datatype.
+func (l *Library) ClassifyAngles(top string) (map[string]*LayerAngles, error) {
+	result := map[string]*LayerAngles{}
+	err := l.WalkInstances(top, func(instance Instance) error {
+		for i, element := range instance.Structure.Elements {
+			var xy []int32
+			closed := true
+			switch e := asPointer(element).(type) {
+			case *Boundary:
+				xy = openRing(e.XY)
+			case *Box:
+				xy = openRing(e.XY)
+			case *Path:
+				xy, closed = e.XY, false
+			default:
+				continue
+			}
+			points := make([]float64, 0, len(xy))
+			for k := 0; k+1 < len(xy); k += 2 {
+				x, y := instance.Transform.Apply(float64(xy[k]), float64(xy[k+1]))
+				points = append(points, x, y)
+			}
+			layer, ok := result[element.GetLayer()]
+			if !ok {
+				layer = &LayerAngles{Shapes: []AngleShape{}}
+				result[element.GetLayer()] = layer
+			}
+			class, edge := classifyEdges(points, closed)
+			switch class {
+			case AngleManhattan:
+				layer.Manhattan++
+				continue
+			case Angle45:
+				layer.Angle45++
+			default:
+				layer.AngleAny++
+			}
+			layer.Shapes = append(layer.Shapes, AngleShape{
+				Cell:    instance.Structure.StrName,
+				Element: i,
+				Path:    instance.Path,
+				Class:   class,
+				X:       points[2*edge],
+				Y:       points[2*edge+1],
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not classify angles of cell %s: %v", top, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,58 @@
+package gds
+
+import (
+	"testing"
+)
+
+func TestClassifyEdges(t *testing.T) {
+	class, edge := ClassifyEdges([]int32{0, 0, 10, 0, 10, 10, 0, 10, 0, 0})
+	assertEqual(t, AngleManhattan, class)
+	assertEqual(t, -1, edge)
+	class, edge = ClassifyEdges([]int32{0, 0, 10, 0, 20, 10, 0, 10})
+	assertEqual(t, Angle45, class)
+	assertEqual(t, 1, edge)
+	class, edge = ClassifyEdges([]int32{0, 0, 10, 0, 20, 10, 0, 10, 0, 5, 3, 4})
+	assertEqual(t, AngleAny, class)
+	assertEqual(t, 4, edge)
+}
+
+func TestClassifyAngles(t *testing.T) {
+	library := NewLibrary("ANGLES", 1e-6, 1e-9)
+	cell, err := library.NewCell("CELL")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	cell.AddRect(LayerSpec{1, 0}, 0, 0, 100, 50)
+	_, err = cell.AddPath(LayerSpec{2, 0}, 10, []int32{0, 0, 100, 0, 150, 50})
+	if err != nil {
+		t.Fatalf("could not add path: %v", err)
+	}
+	top, err := library.NewCell("TOP")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	top.AddInstance("CELL", 0, 0)
+	top.AddInstance("CELL", 1000, 0).Angle = 90
+	top.AddInstance("CELL", 2000, 0).Angle = 45
+	top.AddArray("CELL", 0, 1000, 3, 2, 200, 200).Angle = 30
+
+	layers, err := library.ClassifyAngles("TOP")
+	if err != nil {
+		t.Fatalf("could not classify angles: %v", err)
+	}
+	rects := layers["1/0"]
+	assertEqual(t, 2, rects.Manhattan)
+	assertEqual(t, 1, rects.Angle45)
+	assertEqual(t, 6, rects.AngleAny)
+	assertEqual(t, AngleAny, rects.Class())
+	assertEqual(t, 7, len(rects.Shapes))
+	assertEqual(t, "TOP/CELL#2", rects.Shapes[0].Path.String())
+	assertEqual(t, "TOP/CELL#3[2,1]", rects.Shapes[6].Path.String())
+
+	// rotating the path by 45° swaps its horizontal and diagonal segments, it stays 45°
+	paths := layers["2/0"]
+	assertEqual(t, 0, paths.Manhattan)
+	assertEqual(t, 3, paths.Angle45)
+	assertEqual(t, 6, paths.AngleAny)
+	assertEqual(t, 1, paths.Shapes[0].Element)
+}
@@ -0,0 +1,155 @@
+package gds
+
+import (
+	"fmt"
+	"time"
+)
+
+// LayerSpec identifies a layer together with its datatype, texttype or boxtype
+type LayerSpec struct {
+	Layer    int16
+	Datatype int16
+}
+
+func (l LayerSpec) String() string {
+	return fmt.Sprintf("%d/%d", l.Layer, l.Datatype)
+}
+
+// ParseLayerSpec parses layer strings of the form "layer/datatype" as returned by Element.GetLayer
+func ParseLayerSpec(layer string) (LayerSpec, error) {
+	var spec LayerSpec
+	var rest string
+	n, _ := fmt.Sscanf(layer+" ", "%d/%d%s", &spec.Layer, &spec.Datatype, &rest)
+	if n != 2 {
+		return LayerSpec{}, fmt.Errorf("could not parse layer %q, expected layer/datatype", layer)
+	}
+	return spec, nil
+}
+
+// NewLibrary creates an empty library with GDSII version 600 and current timestamps.
+// userUnit and dbUnit are given in meters, e.g. 1e-6 and 1e-9 for a 1nm grid with coordinates shown in um.
+func NewLibrary(name string, userUnit float64, dbUnit float64) *Library {
+	now := time.Now()
+	library := &Library{
+		Header:         600,
+		LibName:        name,
+		Units:          []float64{dbUnit / userUnit, dbUnit},
+		Structures:     map[string]*Structure{},
+		StructureOrder: []string{},
+		Metadata:       []Record{},
+	}
+	library.SetTimes(now, now)
+	return library
+}
+
+// NewCell adds an empty structure to the library
+func (l *Library) NewCell(name string) (*Structure, error) {
+	if _, ok := l.Structures[name]; ok {
+		return nil, fmt.Errorf("cell with name %s already exists", name)
+	}
+	if l.Structures == nil {
+		l.Structures = map[string]*Structure{}
+	}
+	now := time.Now()
+	structure := &Structure{
+		StrName:  name,
+		Elements: []Element{},
+	}
+	structure.SetTimes(now, now)
+	l.Structures[name] = structure
+	l.StructureOrder = append(l.StructureOrder, name)
+	return structure, nil
+}
+
+// AddRect adds a rectangle with corners (x0, y0) and (x1, y1) as closed counter-clockwise boundary
+func (s *Structure) AddRect(layer LayerSpec, x0, y0, x1, y1 int32) *Boundary {
+	xmin, xmax := min(x0, x1), max(x0, x1)
+	ymin, ymax := min(y0, y1), max(y0, y1)
+	boundary := &Boundary{
+		Layer:    layer.Layer,
+		Datatype: layer.Datatype,
+		XY:       []int32{xmin, ymin, xmax, ymin, xmax, ymax, xmin, ymax, xmin, ymin},
+	}
+	s.Elements = append(s.Elements, boundary)
+	return boundary
+}
+
+// AddPolygon adds a boundary with points given as x0, y0, x1, y1, ..., the polygon is closed if necessary
+func (s *Structure) AddPolygon(layer LayerSpec, xy []int32) (*Boundary, error) {
+	if len(xy)%2 != 0 {
+		return nil, fmt.Errorf("polygon needs an even number of coordinates, got %d", len(xy))
+	}
+	points := make([]int32, len(xy), len(xy)+2)
+	copy(points, xy)
+	if len(points) < 4 || points[0] != points[len(points)-2] || points[1] != points[len(points)-1] {
+		points = append(points, xy[0], xy[1])
+	}
+	if len(points) < 8 {
+		return nil, fmt.Errorf("polygon needs at least 3 distinct points, got %d", len(xy)/2)
+	}
+	boundary := &Boundary{
+		Layer:    layer.Layer,
+		Datatype: layer.Datatype,
+		XY:       points,
+	}
+	s.Elements = append(s.Elements, boundary)
+	return boundary, nil
+}
+
+// AddPath adds a path with flush ends (pathtype 0) and points given as x0, y0, x1, y1, ...
+func (s *Structure) AddPath(layer LayerSpec, width int32, xy []int32) (*Path, error) {
+	if len(xy)%2 != 0 {
+		return nil, fmt.Errorf("path needs an even number of coordinates, got %d", len(xy))
+	}
+	if len(xy) < 4 {
+		return nil, fmt.Errorf("path needs at least 2 points, got %d", len(xy)/2)
+	}
+	path := &Path{
+		Layer:    layer.Layer,
+		Datatype: layer.Datatype,
+		Width:    width,
+		XY:       append([]int32{}, xy...),
+	}
+	s.Elements = append(s.Elements, path)
+	return path, nil
+}
+
+// AddText adds a label at (x, y), the datatype of layer is used as texttype
+func (s *Structure) AddText(layer LayerSpec, x, y int32, text string) *Text {
+	label := &Text{
+		Layer:      layer.Layer,
+		Texttype:   layer.Datatype,
+		Mag:        1,
+		XY:         []int32{x, y},
+		StringBody: text,
+	}
+	s.Elements = append(s.Elements, label)
+	return label
+}
+
+// AddInstance adds a reference to cell placed at (x, y), transformations can be set on the returned SRef
+func (s *Structure) AddInstance(cell string, x, y int32) *SRef {
+	ref := &SRef{
+		Sname: cell,
+		Mag:   1,
+		XY:    []int32{x, y},
+	}
+	s.Elements = append(s.Elements, ref)
+	return ref
+}
+
+// AddArray adds an array of cols x rows references to cell starting at (x, y) with the given column and row pitch
+func (s *Structure) AddArray(cell string, x, y int32, cols, rows int16, colPitch, rowPitch int32) *ARef {
+	ref := &ARef{
+		Sname:  cell,
+		Mag:    1,
+		Colrow: []int16{cols, rows},
+		XY: []int32{
+			x, y,
+			x + int32(cols)*colPitch, y,
+			x, y + int32(rows)*rowPitch,
+		},
+	}
+	s.Elements = append(s.Elements, ref)
+	return ref
+}
@@ -0,0 +1,91 @@
+package gds
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestParseLayerSpec(t *testing.T) {
+	layer, err := ParseLayerSpec("12/3")
+	if err != nil {
+		t.Fatalf("could not parse layer: %v", err)
+	}
+	assertEqual(t, LayerSpec{Layer: 12, Datatype: 3}, layer)
+	assertEqual(t, "12/3", layer.String())
+	for _, broken := range []string{"12", "a/b", "1/2/3", ""} {
+		_, err = ParseLayerSpec(broken)
+		if err == nil {
+			t.Fatalf("could parse broken layer %q", broken)
+		}
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	library := NewLibrary("BUILT", 1e-6, 1e-9)
+	child, err := library.NewCell("child")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	child.AddRect(LayerSpec{1, 0}, 100, 100, 0, 0)
+	_, err = child.AddPolygon(LayerSpec{2, 0}, []int32{0, 0, 100, 0, 0, 100})
+	if err != nil {
+		t.Fatalf("could not add polygon: %v", err)
+	}
+	_, err = child.AddPath(LayerSpec{3, 0}, 10, []int32{0, 0, 100, 0, 100, 100})
+	if err != nil {
+		t.Fatalf("could not add path: %v", err)
+	}
+	child.AddText(LayerSpec{1, 1}, 50, 50, "child")
+
+	top, err := library.NewCell("top")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	top.AddInstance("child", 1000, 0).Angle = 90
+	top.AddArray("child", 0, 1000, 2, 3, 200, 300)
+
+	_, err = library.NewCell("top")
+	if err == nil {
+		t.Fatalf("could create cell with duplicate name")
+	}
+	_, err = child.AddPolygon(LayerSpec{2, 0}, []int32{0, 0, 100, 0})
+	if err == nil {
+		t.Fatalf("could add degenerate polygon")
+	}
+	_, err = child.AddPath(LayerSpec{2, 0}, 10, []int32{0, 0, 100})
+	if err == nil {
+		t.Fatalf("could add path with odd number of coordinates")
+	}
+
+	var written bytes.Buffer
+	err = WriteGDS(&written, library)
+	if err != nil {
+		t.Fatalf("could not write library: %v", err)
+	}
+	records, err := ReadRecords(bytes.NewReader(written.Bytes()))
+	if err != nil {
+		t.Fatalf("could not read records: %v", err)
+	}
+	for _, record := range records {
+		if record.Datatype == "ELFLAGS" || record.Datatype == "PLEX" {
+			t.Fatalf("default record written: %v", record)
+		}
+	}
+	libraryNew, err := ReadGDS(bytes.NewReader(written.Bytes()))
+	if err != nil {
+		t.Fatalf("could not read written library: %v", err)
+	}
+	if library.String() != libraryNew.String() {
+		t.Fatalf("%v not equal to %v", library, libraryNew)
+	}
+	assertEqual(t, 1e-9, libraryNew.Units[1])
+	assertEqual(t, "[0 0 100 0 0 100 0 0]", fmt.Sprint(libraryNew.Structures["child"].Elements[1].GetData()))
+
+	celldata, err := libraryNew.GetCellData("top")
+	if err != nil {
+		t.Fatalf("could not get cell data: %v", err)
+	}
+	assertEqual(t, 7, len(celldata.Polygons["1/0"].Polygons))
+	assertEqual(t, 7, len(celldata.Labels["1/1"].Labels))
+}
@@ -5,27 +5,31 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"reflect"
+	"slices"
 	"strings"
 )
 
-// Convert bits which represents 8-byte real with 1-bit sign, 7-bit exponent and 56-bit mantissa to IEEE754 float64
+// Convert bits which represents 8-byte real with 1-bit sign, 7-bit exponent and 56-bit mantissa to IEEE754 float64.
+// The 56-bit mantissa is rounded to the 53 bits of float64, all exponents are within the range of float64.
 func decodeReal(bits uint64) float64 {
-	sign := 1.0
-	if uint64(bits&0x80_00_00_00_00_00_00_00) > 0 {
-		sign = -1.0
-	}
-	exponent := int8(bits >> 56)
-	rangingFactor := float64(uint64(0b00000001_00000000_00000000_00000000_00000000_00000000_00000000_00000000))
-	mantissa := float64(bits&0x00_ff_ff_ff_ff_ff_ff_ff) / rangingFactor
-	return sign * mantissa * math.Pow(16, math.Abs(float64(exponent))-64)
+	exponent := int((bits>>56)&0x7f) - 64
+	value := math.Ldexp(float64(bits&0x00_ff_ff_ff_ff_ff_ff_ff), 4*exponent-56)
+	if bits&0x80_00_00_00_00_00_00_00 != 0 {
+		return -value
+	}
+	return value
 }
 
 func getRealSlice(data Record) ([]float64, error) {
-	initSlice := make([]uint64, int((data.Size-HEADERSIZE)/8))
+	if len(data.Data)%8 != 0 {
+		return []float64{}, fmt.Errorf("data length %d is not a multiple of 8 bytes", len(data.Data))
+	}
+	initSlice := make([]uint64, len(data.Data)/8)
 	finalSlice := make([]float64, len(initSlice))
 
 	reader := bytes.NewReader(data.Data)
@@ -41,8 +45,11 @@ func getRealSlice(data Record) ([]float64, error) {
 
 func getDataSlice[T any](data Record) ([]T, error) {
 	var typeInit T
-	typeSize := reflect.TypeOf(typeInit).Size()
-	result := make([]T, int((data.Size-HEADERSIZE)/uint16(typeSize)))
+	typeSize := int(reflect.TypeOf(typeInit).Size())
+	if len(data.Data)%typeSize != 0 {
+		return []T{}, fmt.Errorf("data length %d is not a multiple of %d bytes", len(data.Data), typeSize)
+	}
+	result := make([]T, len(data.Data)/typeSize)
 	reader := bytes.NewReader(data.Data)
 	err := binary.Read(reader, binary.BigEndian, &result)
 	if err != nil {
@@ -76,52 +83,181 @@ func getDataString(data Record) (string, error) {
 	return strings.TrimRight(string(data.Data), string(byte(0))), nil
 }
 
-func decodeRecord(reader *bufio.Reader) (*Record, error) {
-	var n int
-	var err error
+// decoder reads records from a stream and keeps track of the position for error reporting
+type decoder struct {
+	options      DecodeOptions
+	warnings     []*DecodeError
+	reader       *bufio.Reader
+	offset       int64 // offset of the next record
+	recordOffset int64 // offset of the last record read
+	structure    string
+	element      int
+	elementType  string
+	propattr     *Record // PROPATTR of the current element waiting for its PROPVALUE
+}
+
+func newDecoder(r io.Reader) *decoder {
+	return &decoder{reader: bufio.NewReader(r), element: -1}
+}
 
-	bSize := make([]byte, 2)
-	n, err = reader.Read(bSize)
-	if err != nil {
-		return nil, fmt.Errorf("could not read size bytes: %v", err)
+// Returns a DecodeError for the last record read, including the current structure and element
+func (d *decoder) errorf(record string, err error) error {
+	return &DecodeError{
+		Offset:      d.recordOffset,
+		Record:      record,
+		Structure:   d.structure,
+		Element:     d.element,
+		ElementType: d.elementType,
+		Err:         err,
 	}
-	if n != 2 {
-		return nil, fmt.Errorf("wrong number of size bytes")
+}
+
+// Collects warnings in lenient mode, does nothing otherwise
+func (d *decoder) warn(err error) {
+	var decodeErr *DecodeError
+	if d.options.Lenient && errors.As(err, &decodeErr) {
+		d.warnings = append(d.warnings, decodeErr)
 	}
+}
 
-	size := binary.BigEndian.Uint16(bSize)
+// Turns the error into a warning in lenient mode, returns it unchanged otherwise
+func (d *decoder) tolerate(err error) error {
+	if !d.options.Lenient {
+		return err
+	}
+	d.warn(err)
+	return nil
+}
+
+// Reports in lenient mode whether the record has an unknown type or data that can not be decoded.
+// Such records are added to the warnings and should be kept as opaque records by the caller.
+func (d *decoder) malformed(record *Record) bool {
+	if !d.options.Lenient {
+		return false
+	}
+	if _, ok := RecordTypesBytes[record.Datatype]; !ok {
+		d.warn(d.errorf(record.Datatype, ErrUnknownRecord))
+		return true
+	}
+	if _, err := record.GetData(); err != nil {
+		d.warn(d.invalidRecord(record, err))
+		return true
+	}
+	return false
+}
 
-	bDatatype := make([]byte, 2)
-	n, err = reader.Read(bDatatype)
+// Adds the property of a PROPATTR and PROPVALUE pair to the element. A PROPVALUE without PROPATTR is an
+// unexpected record, it is kept as opaque record in lenient mode.
+func (d *decoder) decodeProperty(record *Record, info *ElementInfo) error {
+	data, err := record.GetData()
 	if err != nil {
-		return nil, fmt.Errorf("could not read datatype bytes: %v", err)
+		return d.invalidRecord(record, err)
 	}
-	if n != 2 {
-		return nil, fmt.Errorf("wrong number of datatype bytes")
+	if record.Datatype == "PROPATTR" {
+		err = d.orphanedProperty(info)
+		if err != nil {
+			return err
+		}
+		d.propattr = record
+		info.Properties = append(info.Properties, Property{Attribute: data.(int16)})
+		return nil
 	}
-	datatype := hex.EncodeToString(bDatatype)
-	if size < 4 {
-		return nil, fmt.Errorf("size smaller than 4 bytes")
+	if d.propattr == nil {
+		err = d.tolerate(d.unexpectedRecord(record))
+		if err != nil {
+			return err
+		}
+		info.Opaque = append(info.Opaque, *record)
+		return nil
 	}
+	d.propattr = nil
+	info.Properties[len(info.Properties)-1].Value = data.(string)
+	return nil
+}
 
-	datatypeString, ok := RecordTypes[datatype]
-	if !ok {
-		return nil, fmt.Errorf("unknown datatype: %s", datatype)
+// Reports a PROPATTR that was not followed by a PROPVALUE, in lenient mode it is moved to the opaque records
+func (d *decoder) orphanedProperty(info *ElementInfo) error {
+	if d.propattr == nil {
+		return nil
 	}
+	record := d.propattr
+	d.propattr = nil
+	err := d.tolerate(d.errorf(record.Datatype, fmt.Errorf("%w: PROPATTR without PROPVALUE", ErrUnexpectedRecord)))
+	if err != nil {
+		return err
+	}
+	info.Properties = info.Properties[:len(info.Properties)-1]
+	info.Opaque = append(info.Opaque, *record)
+	return nil
+}
 
-	bData := make([]byte, size-4)
+func (d *decoder) unexpectedRecord(record *Record) error {
+	return d.errorf(record.Datatype, ErrUnexpectedRecord)
+}
 
-	n, err = io.ReadFull(reader, bData)
-	if n != int(size-4) {
-		return nil, fmt.Errorf("wrong number of data bytes for %s/%s. expected: %d got: %d", datatype, datatypeString, size-4, n)
+func (d *decoder) invalidRecord(record *Record, err error) error {
+	return d.errorf(record.Datatype, fmt.Errorf("%w: %v", ErrInvalidRecord, err))
+}
+
+// Marks the start of the element with the given index and record type
+func (d *decoder) enterElement(index int, elementType string) {
+	d.element = index
+	d.elementType = elementType
+}
+
+func (d *decoder) leaveElement() {
+	d.element = -1
+	d.elementType = ""
+}
+
+func decodeRecord(d *decoder) (*Record, error) {
+	d.recordOffset = d.offset
+	header := make([]byte, HEADERSIZE)
+	n, err := io.ReadFull(d.reader, header)
+	d.offset += int64(n)
+	if err != nil {
+		return nil, d.errorf("", fmt.Errorf("%w: could not read record header, got %d of %d bytes", ErrTruncated, n, HEADERSIZE))
+	}
+
+	size := binary.BigEndian.Uint16(header[:2])
+	datatype := hex.EncodeToString(header[2:])
+	datatypeString, ok := RecordTypes[datatype]
+	if !ok && !d.options.Lenient {
+		return nil, d.errorf(datatype, ErrUnknownRecord)
+	} else if !ok {
+		// kept as opaque record with the hex code as type
+		datatypeString = datatype
+	}
+	if size < HEADERSIZE {
+		return nil, d.errorf(datatypeString, fmt.Errorf("%w: size %d smaller than %d bytes", ErrInvalidRecord, size, HEADERSIZE))
 	}
+
+	bData := make([]byte, size-HEADERSIZE)
+	n, err = io.ReadFull(d.reader, bData)
+	d.offset += int64(n)
 	if err != nil {
-		return nil, fmt.Errorf("could not read data bytes: %v", err)
+		return nil, d.errorf(datatypeString, fmt.Errorf("%w: expected %d data bytes, got %d", ErrTruncated, size-HEADERSIZE, n))
 	}
 	return &Record{Size: size, Datatype: datatypeString, Data: bData}, nil
 }
 
-func decodeBoundary(reader *bufio.Reader) (*Boundary, error) {
+// Order of optional element records as defined by the stream format
+var optionalRecordOrder = []string{"ELFLAGS", "PLEX", "PRESENTATION", "PATHTYPE", "WIDTH", "BGNEXTN", "ENDEXTN", "STRANS", "MAG", "ANGLE"}
+
+// Adds record name to the list of explicitly present optional records, keeping the stream format order.
+// MAG and ANGLE imply STRANS, which is always written in front of them.
+func markExplicit(explicit []string, name string) []string {
+	result := []string{}
+	implied := (name == "MAG" || name == "ANGLE")
+	for _, optional := range optionalRecordOrder {
+		if optional == name || slices.Contains(explicit, optional) || implied && optional == "STRANS" {
+			result = append(result, optional)
+		}
+	}
+	return result
+}
+
+func decodeBoundary(d *decoder) (*Boundary, error) {
 	boundary := Boundary{
 		ElFlags:  0,
 		Plex:     0,
@@ -131,49 +267,69 @@ func decodeBoundary(reader *bufio.Reader) (*Boundary, error) {
 	}
 OuterLoop:
 	for {
-		newRecord, err := decodeRecord(reader)
+		newRecord, err := decodeRecord(d)
 		if err != nil {
-			return nil, fmt.Errorf("could not decode record: %v", err)
+			return nil, err
+		}
+		boundary.source = append(boundary.source, *newRecord)
+		if d.malformed(newRecord) {
+			boundary.Opaque = append(boundary.Opaque, *newRecord)
+			continue
 		}
 		switch newRecord.Datatype {
 		case "ENDEL":
+			err := d.orphanedProperty(&boundary.ElementInfo)
+			if err != nil {
+				return nil, err
+			}
 			break OuterLoop
+		case "PROPATTR", "PROPVALUE":
+			err := d.decodeProperty(newRecord, &boundary.ElementInfo)
+			if err != nil {
+				return nil, err
+			}
 		case "ELFLAGS":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Boundary/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			boundary.ElFlags = data.(uint16)
+			boundary.explicit = markExplicit(boundary.explicit, newRecord.Datatype)
 		case "PLEX":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Boundary/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			boundary.Plex = data.(int32)
+			boundary.explicit = markExplicit(boundary.explicit, newRecord.Datatype)
 		case "LAYER":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Boundary/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			boundary.Layer = data.(int16)
 		case "DATATYPE":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Boundary/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			boundary.Datatype = data.(int16)
 		case "XY":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Boundary/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			boundary.XY = data.([]int32)
+		default:
+			// unexpected records of boundaries have always been skipped, they are kept as opaque records
+			d.warn(d.unexpectedRecord(newRecord))
+			boundary.Opaque = append(boundary.Opaque, *newRecord)
 		}
 	}
 	return &boundary, nil
 }
 
-func decodePath(reader *bufio.Reader) (*Path, error) {
+func decodePath(d *decoder) (*Path, error) {
 	path := Path{
 		ElFlags:  0,
 		Plex:     0,
@@ -187,75 +343,99 @@ func decodePath(reader *bufio.Reader) (*Path, error) {
 	}
 OuterLoop:
 	for {
-		newRecord, err := decodeRecord(reader)
+		newRecord, err := decodeRecord(d)
 		if err != nil {
-			return nil, fmt.Errorf("could not decode record: %v", err)
+			return nil, err
+		}
+		path.source = append(path.source, *newRecord)
+		if d.malformed(newRecord) {
+			path.Opaque = append(path.Opaque, *newRecord)
+			continue
 		}
 		switch newRecord.Datatype {
 		case "ENDEL":
+			err := d.orphanedProperty(&path.ElementInfo)
+			if err != nil {
+				return nil, err
+			}
 			break OuterLoop
+		case "PROPATTR", "PROPVALUE":
+			err := d.decodeProperty(newRecord, &path.ElementInfo)
+			if err != nil {
+				return nil, err
+			}
 		case "ELFLAGS":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Path/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			path.ElFlags = data.(uint16)
+			path.explicit = markExplicit(path.explicit, newRecord.Datatype)
 		case "PLEX":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Path/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			path.Plex = data.(int32)
+			path.explicit = markExplicit(path.explicit, newRecord.Datatype)
 		case "LAYER":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Path/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			path.Layer = data.(int16)
 		case "DATATYPE":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Path/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			path.Datatype = data.(int16)
 		case "PATHTYPE":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Path/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			path.Pathtype = data.(int16)
+			path.explicit = markExplicit(path.explicit, newRecord.Datatype)
 		case "BGNEXTN":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Path/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			path.Bgnextn = data.(int32)
+			path.explicit = markExplicit(path.explicit, newRecord.Datatype)
 		case "ENDEXTN":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Path/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			path.Endextn = data.(int32)
+			path.explicit = markExplicit(path.explicit, newRecord.Datatype)
 		case "WIDTH":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Path/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			path.Width = data.(int32)
+			path.explicit = markExplicit(path.explicit, newRecord.Datatype)
 		case "XY":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Path/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			path.XY = data.([]int32)
 		default:
-			return nil, fmt.Errorf("could not decode Path/%s: unknown datatype", newRecord.Datatype)
+			err := d.tolerate(d.unexpectedRecord(newRecord))
+			if err != nil {
+				return nil, err
+			}
+			path.Opaque = append(path.Opaque, *newRecord)
 		}
 	}
 	return &path, nil
 }
 
-func decodeSREF(reader *bufio.Reader) (*SRef, error) {
+func decodeSREF(d *decoder) (*SRef, error) {
 	sref := SRef{
 		ElFlags: 0,
 		Plex:    0,
@@ -267,63 +447,86 @@ func decodeSREF(reader *bufio.Reader) (*SRef, error) {
 	}
 OuterLoop:
 	for {
-		newRecord, err := decodeRecord(reader)
+		newRecord, err := decodeRecord(d)
 		if err != nil {
-			return nil, fmt.Errorf("could not decode record: %v", err)
+			return nil, err
+		}
+		sref.source = append(sref.source, *newRecord)
+		if d.malformed(newRecord) {
+			sref.Opaque = append(sref.Opaque, *newRecord)
+			continue
 		}
 		switch newRecord.Datatype {
 		case "ENDEL":
+			err := d.orphanedProperty(&sref.ElementInfo)
+			if err != nil {
+				return nil, err
+			}
 			break OuterLoop
+		case "PROPATTR", "PROPVALUE":
+			err := d.decodeProperty(newRecord, &sref.ElementInfo)
+			if err != nil {
+				return nil, err
+			}
 		case "ELFLAGS":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Sref/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			sref.ElFlags = data.(uint16)
+			sref.explicit = markExplicit(sref.explicit, newRecord.Datatype)
 		case "PLEX":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Sref/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			sref.Plex = data.(int32)
+			sref.explicit = markExplicit(sref.explicit, newRecord.Datatype)
 		case "SNAME":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Sref/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			sref.Sname = data.(string)
 		case "STRANS":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Sref/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			sref.Strans = data.(uint16)
+			sref.explicit = markExplicit(sref.explicit, newRecord.Datatype)
 		case "MAG":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Sref/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			sref.Mag = data.(float64)
+			sref.explicit = markExplicit(sref.explicit, newRecord.Datatype)
 		case "ANGLE":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Sref/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			sref.Angle = data.(float64)
+			sref.explicit = markExplicit(sref.explicit, newRecord.Datatype)
 		case "XY":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Sref/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			sref.XY = data.([]int32)
 		default:
-			return nil, fmt.Errorf("could not decode Sref/%s: unknown datatype", newRecord.Datatype)
+			err := d.tolerate(d.unexpectedRecord(newRecord))
+			if err != nil {
+				return nil, err
+			}
+			sref.Opaque = append(sref.Opaque, *newRecord)
 		}
 	}
 	return &sref, nil
 }
 
-func decodeAREF(reader *bufio.Reader) (*ARef, error) {
+func decodeAREF(d *decoder) (*ARef, error) {
 	aref := ARef{
 		ElFlags: 0,
 		Plex:    0,
@@ -336,69 +539,92 @@ func decodeAREF(reader *bufio.Reader) (*ARef, error) {
 	}
 OuterLoop:
 	for {
-		newRecord, err := decodeRecord(reader)
+		newRecord, err := decodeRecord(d)
 		if err != nil {
-			return nil, fmt.Errorf("could not decode record: %v", err)
+			return nil, err
+		}
+		aref.source = append(aref.source, *newRecord)
+		if d.malformed(newRecord) {
+			aref.Opaque = append(aref.Opaque, *newRecord)
+			continue
 		}
 		switch newRecord.Datatype {
 		case "ENDEL":
+			err := d.orphanedProperty(&aref.ElementInfo)
+			if err != nil {
+				return nil, err
+			}
 			break OuterLoop
+		case "PROPATTR", "PROPVALUE":
+			err := d.decodeProperty(newRecord, &aref.ElementInfo)
+			if err != nil {
+				return nil, err
+			}
 		case "ELFLAGS":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Aref/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			aref.ElFlags = data.(uint16)
+			aref.explicit = markExplicit(aref.explicit, newRecord.Datatype)
 		case "PLEX":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Aref/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			aref.Plex = data.(int32)
+			aref.explicit = markExplicit(aref.explicit, newRecord.Datatype)
 		case "SNAME":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Aref/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			aref.Sname = data.(string)
 		case "STRANS":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Aref/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			aref.Strans = data.(uint16)
+			aref.explicit = markExplicit(aref.explicit, newRecord.Datatype)
 		case "MAG":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Aref/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			aref.Mag = data.(float64)
+			aref.explicit = markExplicit(aref.explicit, newRecord.Datatype)
 		case "ANGLE":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Aref/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			aref.Angle = data.(float64)
+			aref.explicit = markExplicit(aref.explicit, newRecord.Datatype)
 		case "COLROW":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Aref/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			aref.Colrow = data.([]int16)
 		case "XY":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Aref/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			aref.XY = data.([]int32)
 		default:
-			return nil, fmt.Errorf("could not decode Aref/%s: unknown datatype", newRecord.Datatype)
+			err := d.tolerate(d.unexpectedRecord(newRecord))
+			if err != nil {
+				return nil, err
+			}
+			aref.Opaque = append(aref.Opaque, *newRecord)
 		}
 	}
 	return &aref, nil
 }
 
-func decodeText(reader *bufio.Reader) (*Text, error) {
+func decodeText(d *decoder) (*Text, error) {
 	text := Text{
 		ElFlags:      0,
 		Plex:         0,
@@ -413,81 +639,105 @@ func decodeText(reader *bufio.Reader) (*Text, error) {
 	}
 OuterLoop:
 	for {
-		newRecord, err := decodeRecord(reader)
+		newRecord, err := decodeRecord(d)
 		if err != nil {
-			return nil, fmt.Errorf("could not decode record: %v", err)
+			return nil, err
+		}
+		text.source = append(text.source, *newRecord)
+		if d.malformed(newRecord) {
+			text.Opaque = append(text.Opaque, *newRecord)
+			continue
 		}
 		switch newRecord.Datatype {
 		case "ENDEL":
+			err := d.orphanedProperty(&text.ElementInfo)
+			if err != nil {
+				return nil, err
+			}
 			break OuterLoop
+		case "PROPATTR", "PROPVALUE":
+			err := d.decodeProperty(newRecord, &text.ElementInfo)
+			if err != nil {
+				return nil, err
+			}
 		case "ELFLAGS":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Text/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			text.ElFlags = data.(uint16)
+			text.explicit = markExplicit(text.explicit, newRecord.Datatype)
 		case "PLEX":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Text/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			text.Plex = data.(int32)
+			text.explicit = markExplicit(text.explicit, newRecord.Datatype)
 		case "LAYER":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Text/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			text.Layer = data.(int16)
 		case "TEXTTYPE":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Text/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			text.Texttype = data.(int16)
 		case "PRESENTATION":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Text/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			text.Presentation = data.(uint16)
+			text.explicit = markExplicit(text.explicit, newRecord.Datatype)
 		case "STRANS":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Text/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			text.Strans = data.(uint16)
+			text.explicit = markExplicit(text.explicit, newRecord.Datatype)
 		case "MAG":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Text/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			text.Mag = data.(float64)
+			text.explicit = markExplicit(text.explicit, newRecord.Datatype)
 		case "ANGLE":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Text/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			text.Angle = data.(float64)
+			text.explicit = markExplicit(text.explicit, newRecord.Datatype)
 		case "STRINGBODY":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Text/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			text.StringBody = data.(string)
 		case "XY":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Text/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			text.XY = data.([]int32)
 		default:
-			return nil, fmt.Errorf("could not decode Text/%s: unknown datatype", newRecord.Datatype)
+			err := d.tolerate(d.unexpectedRecord(newRecord))
+			if err != nil {
+				return nil, err
+			}
+			text.Opaque = append(text.Opaque, *newRecord)
 		}
 	}
 	return &text, nil
 }
 
-func decodeNode(reader *bufio.Reader) (*Node, error) {
+func decodeNode(d *decoder) (*Node, error) {
 	node := Node{
 		ElFlags:  0,
 		Plex:     0,
@@ -497,51 +747,71 @@ func decodeNode(reader *bufio.Reader) (*Node, error) {
 	}
 OuterLoop:
 	for {
-		newRecord, err := decodeRecord(reader)
+		newRecord, err := decodeRecord(d)
 		if err != nil {
-			return nil, fmt.Errorf("could not decode record: %v", err)
+			return nil, err
+		}
+		node.source = append(node.source, *newRecord)
+		if d.malformed(newRecord) {
+			node.Opaque = append(node.Opaque, *newRecord)
+			continue
 		}
 		switch newRecord.Datatype {
 		case "ENDEL":
+			err := d.orphanedProperty(&node.ElementInfo)
+			if err != nil {
+				return nil, err
+			}
 			break OuterLoop
+		case "PROPATTR", "PROPVALUE":
+			err := d.decodeProperty(newRecord, &node.ElementInfo)
+			if err != nil {
+				return nil, err
+			}
 		case "ELFLAGS":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Node/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			node.ElFlags = data.(uint16)
+			node.explicit = markExplicit(node.explicit, newRecord.Datatype)
 		case "PLEX":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Node/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			node.Plex = data.(int32)
+			node.explicit = markExplicit(node.explicit, newRecord.Datatype)
 		case "LAYER":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Node/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			node.Layer = data.(int16)
 		case "NODETYPE":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Node/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			node.Nodetype = data.(int16)
 		case "XY":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Node/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			node.XY = data.([]int32)
 		default:
-			return nil, fmt.Errorf("could not decode Node/%s: unknown datatype", newRecord.Datatype)
+			err := d.tolerate(d.unexpectedRecord(newRecord))
+			if err != nil {
+				return nil, err
+			}
+			node.Opaque = append(node.Opaque, *newRecord)
 		}
 	}
 	return &node, nil
 }
 
-func decodeBox(reader *bufio.Reader) (*Box, error) {
+func decodeBox(d *decoder) (*Box, error) {
 	box := Box{
 		ElFlags: 0,
 		Plex:    0,
@@ -551,65 +821,91 @@ func decodeBox(reader *bufio.Reader) (*Box, error) {
 	}
 OuterLoop:
 	for {
-		newRecord, err := decodeRecord(reader)
+		newRecord, err := decodeRecord(d)
 		if err != nil {
-			return nil, fmt.Errorf("error decoding record: %v", err)
+			return nil, err
+		}
+		box.source = append(box.source, *newRecord)
+		if d.malformed(newRecord) {
+			box.Opaque = append(box.Opaque, *newRecord)
+			continue
 		}
 		switch newRecord.Datatype {
 		case "ENDEL":
+			err := d.orphanedProperty(&box.ElementInfo)
+			if err != nil {
+				return nil, err
+			}
 			break OuterLoop
+		case "PROPATTR", "PROPVALUE":
+			err := d.decodeProperty(newRecord, &box.ElementInfo)
+			if err != nil {
+				return nil, err
+			}
 		case "ELFLAGS":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Box/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			box.ElFlags = data.(uint16)
+			box.explicit = markExplicit(box.explicit, newRecord.Datatype)
 		case "PLEX":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Box/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			box.Plex = data.(int32)
+			box.explicit = markExplicit(box.explicit, newRecord.Datatype)
 		case "LAYER":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Box/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			box.Layer = data.(int16)
 		case "BOXTYPE":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Box/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			box.Boxtype = data.(int16)
 		case "XY":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Box/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			box.XY = data.([]int32)
 		default:
-			return nil, fmt.Errorf("could not decode Box/%s: unknown datatype", newRecord.Datatype)
+			err := d.tolerate(d.unexpectedRecord(newRecord))
+			if err != nil {
+				return nil, err
+			}
+			box.Opaque = append(box.Opaque, *newRecord)
 		}
 	}
 	return &box, nil
 }
 
-func decodeStructure(reader *bufio.Reader, bgnStrRecord *Record) (*Structure, error) {
+func decodeStructure(d *decoder, bgnStrRecord *Record) (*Structure, error) {
+	d.structure = ""
 	data, err := bgnStrRecord.GetData()
 	if err != nil {
-		return nil, fmt.Errorf("could not decode Structure/BGNSTR: %v", err)
+		return nil, d.invalidRecord(bgnStrRecord, err)
 	}
 	structure := Structure{
 		BgnStr:   data.([]int16),
 		StrName:  "Unknown",
 		Elements: []Element{},
+		source:   []Record{*bgnStrRecord},
 	}
 OuterLoop:
 	for {
-		newRecord, err := decodeRecord(reader)
+		newRecord, err := decodeRecord(d)
 		if err != nil {
-			return nil, fmt.Errorf("could not decode record: %v", err)
+			return nil, err
+		}
+		if d.malformed(newRecord) {
+			structure.Opaque = append(structure.Opaque, *newRecord)
+			continue
 		}
 		switch newRecord.Datatype {
 		case "ENDSTR":
@@ -619,71 +915,72 @@ OuterLoop:
 		case "STRNAME":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Structure/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			structure.StrName = data.(string)
-		case "BOUNDARY":
-			element, err := decodeBoundary(reader)
+			structure.source = append(structure.source, *newRecord)
+			d.structure = structure.StrName
+		case "BOUNDARY", "PATH", "SREF", "AREF", "TEXT", "NODE", "BOX":
+			d.enterElement(len(structure.Elements), newRecord.Datatype)
+			element, err := decodeElement(d, newRecord.Datatype)
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Structure/%s: %v", newRecord.Datatype, err)
+				return nil, err
 			}
+			d.leaveElement()
 			structure.Elements = append(structure.Elements, element)
-		case "PATH":
-			element, err := decodePath(reader)
-			if err != nil {
-				return nil, fmt.Errorf("could not decode Structure/%s: %v", newRecord.Datatype, err)
-			}
-			structure.Elements = append(structure.Elements, element)
-		case "SREF":
-			element, err := decodeSREF(reader)
-			if err != nil {
-				return nil, fmt.Errorf("could not decode Structure/%s: %v", newRecord.Datatype, err)
-			}
-			structure.Elements = append(structure.Elements, element)
-		case "AREF":
-			element, err := decodeAREF(reader)
-			if err != nil {
-				return nil, fmt.Errorf("could not decode Structure/%s: %v", newRecord.Datatype, err)
-			}
-			structure.Elements = append(structure.Elements, element)
-		case "TEXT":
-			element, err := decodeText(reader)
-			if err != nil {
-				return nil, fmt.Errorf("could not decode Structure/%s: %v", newRecord.Datatype, err)
-			}
-			structure.Elements = append(structure.Elements, element)
-		case "NODE":
-			element, err := decodeNode(reader)
-			if err != nil {
-				return nil, fmt.Errorf("could not decode Structure/%s: %v", newRecord.Datatype, err)
-			}
-			structure.Elements = append(structure.Elements, element)
-		case "BOX":
-			element, err := decodeBox(reader)
+		default:
+			err := d.tolerate(d.unexpectedRecord(newRecord))
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Structure/%s: %v", newRecord.Datatype, err)
+				return nil, err
 			}
-			structure.Elements = append(structure.Elements, element)
-		default:
-			return nil, fmt.Errorf("could not decode Structure/%s: unknown datatype", newRecord.Datatype)
+			structure.Opaque = append(structure.Opaque, *newRecord)
 		}
 	}
+	d.structure = ""
 	return &structure, nil
 }
 
-func decodeLibrary(reader *bufio.Reader) (*Library, error) {
+// Decodes the element started by the record of type elementType
+func decodeElement(d *decoder, elementType string) (Element, error) {
+	switch elementType {
+	case "BOUNDARY":
+		return decodeBoundary(d)
+	case "PATH":
+		return decodePath(d)
+	case "SREF":
+		return decodeSREF(d)
+	case "AREF":
+		return decodeAREF(d)
+	case "TEXT":
+		return decodeText(d)
+	case "NODE":
+		return decodeNode(d)
+	case "BOX":
+		return decodeBox(d)
+	default:
+		return nil, fmt.Errorf("%w: %s does not start an element", ErrUnexpectedRecord, elementType)
+	}
+}
+
+func decodeLibrary(d *decoder) (*Library, error) {
 	library := Library{
-		Header:     0,
-		BgnLib:     []int16{},
-		LibName:    "Unknown",
-		Units:      []float64{},
-		Structures: map[string]*Structure{},
+		Header:         0,
+		BgnLib:         []int16{},
+		LibName:        "Unknown",
+		Units:          []float64{},
+		Structures:     map[string]*Structure{},
+		StructureOrder: []string{},
+		Metadata:       []Record{},
 	}
 OuterLoop:
 	for {
-		newRecord, err := decodeRecord(reader)
+		newRecord, err := decodeRecord(d)
 		if err != nil {
-			return nil, fmt.Errorf("could not decode record: %v", err)
+			return nil, err
+		}
+		if d.malformed(newRecord) {
+			library.Opaque = append(library.Opaque, *newRecord)
+			continue
 		}
 		switch newRecord.Datatype {
 		case "ENDLIB":
@@ -691,35 +988,48 @@ OuterLoop:
 		case "HEADER":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Library/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			library.Header = data.(int16)
+			library.source = append(library.source, *newRecord)
 		case "BGNLIB":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Library/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			library.BgnLib = data.([]int16)
+			library.source = append(library.source, *newRecord)
 		case "LIBNAME":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Library/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			library.LibName = data.(string)
+			library.source = append(library.source, *newRecord)
 		case "UNITS":
 			data, err := newRecord.GetData()
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Library/%s: %v", newRecord.Datatype, err)
+				return nil, d.invalidRecord(newRecord, err)
 			}
 			library.Units = data.([]float64)
+			library.source = append(library.source, *newRecord)
+		case "LIBDIRSIZE", "SRFNAME", "LIBSECUR", "REFLIBS", "FONTS", "ATTRTABLE", "GENERATIONS", "FORMAT", "MASK", "ENDMASKS":
+			library.Metadata = append(library.Metadata, *newRecord)
 		case "BGNSTR":
-			element, err := decodeStructure(reader, newRecord)
+			element, err := decodeStructure(d, newRecord)
 			if err != nil {
-				return nil, fmt.Errorf("could not decode Library/%s: %v", newRecord.Datatype, err)
+				return nil, err
+			}
+			if _, ok := library.Structures[element.StrName]; !ok {
+				library.StructureOrder = append(library.StructureOrder, element.StrName)
 			}
 			library.Structures[element.StrName] = element
 		default:
-			return nil, fmt.Errorf("could not decode Library/%s: unknown datatype", newRecord.Datatype)
+			err := d.tolerate(d.unexpectedRecord(newRecord))
+			if err != nil {
+				return nil, err
+			}
+			library.Opaque = append(library.Opaque, *newRecord)
 		}
 	}
 	return &library, nil
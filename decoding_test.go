@@ -1,9 +1,14 @@
 package gds
 
 import (
-	"bufio"
 	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 var (
@@ -40,8 +45,8 @@ var (
 	BrokenRecord = []Record{{Size: 4, Datatype: "BROKEN", Data: []byte{}}}
 )
 
-func mockFilehandler(data []byte) *bufio.Reader {
-	return bufio.NewReader(bytes.NewReader(data))
+func mockFilehandler(data []byte) *decoder {
+	return newDecoder(bytes.NewReader(data))
 }
 
 func TestRecords(t *testing.T) {
@@ -60,6 +65,39 @@ func TestRecords(t *testing.T) {
 	}
 }
 
+func TestRecordGetData(t *testing.T) {
+	for code, name := range RecordTypes {
+		typeBytes, ok := RecordTypesBytes[name]
+		if !ok {
+			t.Fatalf("record type %s missing in RecordTypesBytes", name)
+		}
+		assertEqual(t, code, hex.EncodeToString(typeBytes))
+		data := []byte{}
+		switch typeBytes[1] {
+		case 0x01, 0x02:
+			data = []byte{0, 1}
+		case 0x03:
+			data = []byte{0, 0, 0, 1}
+		case 0x05:
+			data = []byte{0x41, 0x10, 0, 0, 0, 0, 0, 0}
+		case 0x06:
+			data = []byte("AB")
+		}
+		_, err := Record{Size: uint16(HEADERSIZE + len(data)), Datatype: name, Data: data}.GetData()
+		if err != nil {
+			t.Fatalf("could not get data of %s: %v", name, err)
+		}
+	}
+	_, err := Record{Size: 4, Datatype: "BROKEN", Data: []byte{}}.GetData()
+	if !errors.Is(err, ErrUnknownRecord) {
+		t.Fatalf("expected unknown record error, got %v", err)
+	}
+	_, err = Record{Size: 10, Datatype: "XY", Data: []byte{0, 0, 0, 1, 0, 1}}.GetData()
+	if err == nil {
+		t.Fatalf("expected error for XY data of 6 bytes")
+	}
+}
+
 func TestText(t *testing.T) {
 	textTest := Text{
 		ElFlags:      0,
@@ -73,11 +111,11 @@ func TestText(t *testing.T) {
 		XY:           []int32{0, 0, 1, 1},
 		StringBody:   "Test",
 	}
-	recordsText, err := fieldsToRecords(textTest)
+	recordsText, err := textTest.Records()
 	if err != nil {
-		t.Fatalf("error fields to records: %v", err)
+		t.Fatalf("could not produce records: %v", err)
 	}
-	recordsText = append(recordsText, ENDEL)
+	recordsText = recordsText[1:]
 	textNew, err := decodeText(mockFilehandler(recordsToBytes(recordsText)))
 	if err != nil {
 		t.Fatalf("error decoding text %v", err)
@@ -99,11 +137,11 @@ func TestBoundary(t *testing.T) {
 		Datatype: 1,
 		XY:       []int32{0, 1, 2, 3},
 	}
-	recordsBoundary, err := fieldsToRecords(boundaryTest)
+	recordsBoundary, err := boundaryTest.Records()
 	if err != nil {
-		t.Fatalf("error fields to records: %v", err)
+		t.Fatalf("could not produce records: %v", err)
 	}
-	recordsBoundary = append(recordsBoundary, ENDEL)
+	recordsBoundary = recordsBoundary[1:]
 	boundaryNew, err := decodeBoundary(mockFilehandler(recordsToBytes(recordsBoundary)))
 	if err != nil {
 		t.Fatalf("could not decode boundary: %v", err)
@@ -127,11 +165,11 @@ func TestPath(t *testing.T) {
 		Width:    6,
 		XY:       []int32{7, 8, 9, 10},
 	}
-	recordsPath, err := fieldsToRecords(pathTest)
+	recordsPath, err := pathTest.Records()
 	if err != nil {
-		t.Fatalf("error fields to records: %v", err)
+		t.Fatalf("could not produce records: %v", err)
 	}
-	recordsPath = append(recordsPath, ENDEL)
+	recordsPath = recordsPath[1:]
 	pathNew, err := decodePath(mockFilehandler(recordsToBytes(recordsPath)))
 	if err != nil {
 		t.Fatalf("could not decode path: %v", err)
@@ -155,11 +193,11 @@ func TestSref(t *testing.T) {
 		Angle:   5.0,
 		XY:      []int32{6, 7, 8, 9},
 	}
-	recordsSref, err := fieldsToRecords(srefTest)
+	recordsSref, err := srefTest.Records()
 	if err != nil {
-		t.Fatalf("error fields to records: %v", err)
+		t.Fatalf("could not produce records: %v", err)
 	}
-	recordsSref = append(recordsSref, ENDEL)
+	recordsSref = recordsSref[1:]
 	srefNew, err := decodeSREF(mockFilehandler(recordsToBytes(recordsSref)))
 	if err != nil {
 		t.Fatalf("could not decode sref: %v", err)
@@ -184,11 +222,11 @@ func TestAref(t *testing.T) {
 		Colrow:  []int16{0, 0},
 		XY:      []int32{0, 0, 1, 1},
 	}
-	recordsAref, err := fieldsToRecords(arefTest)
+	recordsAref, err := arefTest.Records()
 	if err != nil {
-		t.Fatalf("error fields to records: %v", err)
+		t.Fatalf("could not produce records: %v", err)
 	}
-	recordsAref = append(recordsAref, ENDEL)
+	recordsAref = recordsAref[1:]
 	arefNew, err := decodeAREF(mockFilehandler(recordsToBytes(recordsAref)))
 	if err != nil {
 		t.Fatalf("error decoding aref: %v", err)
@@ -210,11 +248,11 @@ func TestNode(t *testing.T) {
 		Nodetype: 4,
 		XY:       []int32{5, 6, 7, 8},
 	}
-	recordsNode, err := fieldsToRecords(nodeTest)
+	recordsNode, err := nodeTest.Records()
 	if err != nil {
-		t.Fatalf("error fields to records: %v", err)
+		t.Fatalf("could not produce records: %v", err)
 	}
-	recordsNode = append(recordsNode, ENDEL)
+	recordsNode = recordsNode[1:]
 	nodeNew, err := decodeNode(mockFilehandler(recordsToBytes(recordsNode)))
 	if err != nil {
 		t.Fatalf("error decoding node: %v", err)
@@ -236,11 +274,11 @@ func TextBox(t *testing.T) {
 		Boxtype: 4,
 		XY:      []int32{5, 6, 7, 8},
 	}
-	recordsBox, err := fieldsToRecords(boxTest)
+	recordsBox, err := boxTest.Records()
 	if err != nil {
-		t.Fatalf("error fields to records: %v", err)
+		t.Fatalf("could not produce records: %v", err)
 	}
-	recordsBox = append(recordsBox, ENDEL)
+	recordsBox = recordsBox[1:]
 	boxNew, err := decodeBox(mockFilehandler(recordsToBytes(recordsBox)))
 	if err != nil {
 		t.Fatalf("error decoding box: %v", err)
@@ -260,11 +298,10 @@ func TestStructure(t *testing.T) {
 		StrName:  "TestStructure",
 		Elements: TestElements,
 	}
-	recordsStructure, err := fieldsToRecords(structureTest)
+	recordsStructure, err := structureTest.Records()
 	if err != nil {
-		t.Fatalf("error fields to records: %v", err)
+		t.Fatalf("could not produce records: %v", err)
 	}
-	recordsStructure = append(recordsStructure, ENDSTR)
 	structureNew, err := decodeStructure(mockFilehandler(recordsToBytes(recordsStructure)),
 		&Record{Size: 6, Datatype: "BGNSTR", Data: []byte{byte(0x00), byte(0x01), byte(0x00), byte(0x02)}})
 	if err != nil {
@@ -289,11 +326,10 @@ func TestLibrary(t *testing.T) {
 			},
 		},
 	}
-	recordsLibrary, err := fieldsToRecords(libraryTest)
+	recordsLibrary, err := libraryTest.Records()
 	if err != nil {
-		t.Fatalf("error fields to records: %v", err)
+		t.Fatalf("could not produce records: %v", err)
 	}
-	recordsLibrary = append(recordsLibrary, ENDLIB)
 	libraryNew, err := decodeLibrary(mockFilehandler(recordsToBytes(recordsLibrary)))
 	if err != nil {
 		t.Fatalf("could not decode library: %v", err)
@@ -306,3 +342,295 @@ func TestLibrary(t *testing.T) {
 		t.Fatalf("could parse broken record")
 	}
 }
+
+func TestDecodeErrors(t *testing.T) {
+	original, err := os.ReadFile(testFile)
+	if err != nil {
+		t.Fatalf("could not read test gds file: %v", err)
+	}
+	records, err := ReadRecords(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("could not read records: %v", err)
+	}
+	// locate the XY record of the second element of the second structure
+	offset, structures, elements := 0, 0, 0
+	for _, record := range records {
+		if record.Datatype == "BGNSTR" {
+			structures++
+			elements = 0
+		}
+		if record.Datatype == "ENDEL" {
+			elements++
+		}
+		if structures == 2 && elements == 1 && record.Datatype == "XY" {
+			break
+		}
+		offset += int(record.Size)
+	}
+
+	var decodeErr *DecodeError
+	corrupted := bytes.Clone(original)
+	corrupted[offset+2], corrupted[offset+3] = 0x7f, 0x7f
+	_, err = ReadGDS(bytes.NewReader(corrupted))
+	if !errors.Is(err, ErrUnknownRecord) || !errors.As(err, &decodeErr) {
+		t.Fatalf("expected unknown record error, got %v", err)
+	}
+	assertEqual(t, int64(offset), decodeErr.Offset)
+	assertEqual(t, "7f7f", decodeErr.Record)
+	assertEqual(t, "squares", decodeErr.Structure)
+	assertEqual(t, 1, decodeErr.Element)
+	assertEqual(t, "TEXT", decodeErr.ElementType)
+
+	corrupted = bytes.Clone(original)
+	copy(corrupted[offset+2:offset+4], RecordTypesBytes["COLROW"])
+	_, err = ReadGDS(bytes.NewReader(corrupted))
+	if !errors.Is(err, ErrUnexpectedRecord) || !errors.As(err, &decodeErr) {
+		t.Fatalf("expected unexpected record error, got %v", err)
+	}
+	assertEqual(t, "COLROW", decodeErr.Record)
+	assertEqual(t, 1, decodeErr.Element)
+
+	_, err = ReadGDS(bytes.NewReader(original[:offset+6]))
+	if !errors.Is(err, ErrTruncated) || !errors.As(err, &decodeErr) {
+		t.Fatalf("expected truncation error, got %v", err)
+	}
+	assertEqual(t, int64(offset), decodeErr.Offset)
+
+	_, err = ReadGDS(bytes.NewReader(original[:len(original)-4]))
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected truncation error for missing ENDLIB, got %v", err)
+	}
+}
+
+func TestLenientDecoding(t *testing.T) {
+	original, err := os.ReadFile(testFile)
+	if err != nil {
+		t.Fatalf("could not read test gds file: %v", err)
+	}
+	records, err := ReadRecords(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("could not read records: %v", err)
+	}
+	unknown := Record{Size: 8, Datatype: "7f7f", Data: []byte{1, 2, 3, 4}}
+	malformed := Record{Size: 6, Datatype: "WIDTH", Data: []byte{0, 1}}
+	modified := []Record{}
+	for i, record := range records {
+		modified = append(modified, record)
+		// unknown record in the first element, malformed record in the second, unknown record at structure level
+		switch i {
+		case 7:
+			modified = append(modified, unknown)
+		case 14:
+			modified = append(modified, malformed)
+		case 5:
+			modified = append(modified, unknown)
+		}
+	}
+	data := recordsToBytes(modified)
+
+	_, err = ReadGDS(bytes.NewReader(data))
+	if !errors.Is(err, ErrUnknownRecord) {
+		t.Fatalf("expected unknown record error in strict mode, got %v", err)
+	}
+	library, warnings, err := ReadGDSWithOptions(bytes.NewReader(data), DecodeOptions{Lenient: true})
+	if err != nil {
+		t.Fatalf("could not decode in lenient mode: %v", err)
+	}
+	assertEqual(t, 3, len(warnings))
+	assertEqual(t, "paths", warnings[0].Structure)
+	if !errors.Is(warnings[2], ErrInvalidRecord) {
+		t.Fatalf("expected invalid record warning, got %v", warnings[2])
+	}
+	structure := library.Structures["paths"]
+	assertEqual(t, 1, len(structure.Opaque))
+	assertEqual(t, 1, len(structure.Elements[0].(*Path).Opaque))
+	assertEqual(t, 1, len(structure.Elements[1].(*Path).Opaque))
+
+	var written bytes.Buffer
+	err = WriteGDS(&written, library)
+	if err != nil {
+		t.Fatalf("could not write library with opaque records: %v", err)
+	}
+	libraryNew, warningsNew, err := ReadGDSWithOptions(&written, DecodeOptions{Lenient: true})
+	if err != nil {
+		t.Fatalf("could not decode written library in lenient mode: %v", err)
+	}
+	assertEqual(t, len(warnings), len(warningsNew))
+	if library.String() != libraryNew.String() {
+		t.Fatalf("%v not equal to %v", library, libraryNew)
+	}
+}
+
+func TestDecodeProperties(t *testing.T) {
+	library := NewLibrary("LIB", 1e-6, 1e-9)
+	cell, err := library.NewCell("TOP")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	path, err := cell.AddPath(LayerSpec{1, 0}, 10, []int32{0, 0, 100, 0})
+	if err != nil {
+		t.Fatalf("could not add path: %v", err)
+	}
+	path.Properties = []Property{{1, "net1"}, {2, "power"}}
+	ref := cell.AddInstance("TOP", 0, 0)
+	ref.Properties = []Property{{126, "instance 1"}}
+	records, err := library.Records()
+	if err != nil {
+		t.Fatalf("could not produce records: %v", err)
+	}
+	data := recordsToBytes(records)
+
+	for _, options := range []DecodeOptions{{}, {Lenient: true}} {
+		libraryNew, warnings, err := ReadGDSWithOptions(bytes.NewReader(data), options)
+		if err != nil {
+			t.Fatalf("could not decode properties: %v", err)
+		}
+		assertEqual(t, 0, len(warnings))
+		elements := libraryNew.Structures["TOP"].Elements
+		assertEqual(t, "[{1 net1} {2 power}]", fmt.Sprint(elements[0].(*Path).Properties))
+		assertEqual(t, "[{126 instance 1}]", fmt.Sprint(elements[1].(*SRef).Properties))
+		assertEqual(t, 0, len(elements[0].(*Path).Opaque))
+		var written bytes.Buffer
+		err = WriteGDS(&written, libraryNew)
+		if err != nil {
+			t.Fatalf("could not write properties: %v", err)
+		}
+		assertEqualByteSlice(t, data, written.Bytes())
+	}
+
+	// PROPVALUE without PROPATTR and PROPATTR without PROPVALUE
+	propattr := Record{Size: 6, Datatype: "PROPATTR", Data: []byte{0, 3}}
+	propvalue := Record{Size: 6, Datatype: "PROPVALUE", Data: []byte("ab")}
+	for _, inserted := range [][]Record{{propvalue}, {propattr}} {
+		// inserted in front of the properties of the reference
+		modified := []Record{}
+		inReference := false
+		for _, record := range records {
+			modified = append(modified, record)
+			inReference = inReference || record.Datatype == "SREF"
+			if inReference && record.Datatype == "XY" {
+				modified = append(modified, inserted...)
+			}
+		}
+		_, err = ReadGDS(bytes.NewReader(recordsToBytes(modified)))
+		if !errors.Is(err, ErrUnexpectedRecord) {
+			t.Fatalf("expected unexpected record error for %v, got %v", inserted, err)
+		}
+		libraryNew, warnings, err := ReadGDSWithOptions(bytes.NewReader(recordsToBytes(modified)), DecodeOptions{Lenient: true})
+		if err != nil {
+			t.Fatalf("could not decode in lenient mode: %v", err)
+		}
+		assertEqual(t, 1, len(warnings))
+		ref := libraryNew.Structures["TOP"].Elements[1].(*SRef)
+		assertEqual(t, "[{126 instance 1}]", fmt.Sprint(ref.Properties))
+		assertEqual(t, inserted[0].Datatype, ref.Opaque[0].Datatype)
+	}
+}
+
+func FuzzDecodeRecord(f *testing.F) {
+	f.Add(recordsToBytes([]Record{{Size: 6, Datatype: "HEADER", Data: []byte{0x02, 0x58}}}))
+	f.Add([]byte{0x00, 0x04, 0x00, 0x02})                               // HEADER without data
+	f.Add([]byte{0x00, 0x02, 0x10, 0x03})                               // size smaller than the record header
+	f.Add([]byte{0x00, 0x0a, 0x10, 0x03, 0, 0, 0, 1, 0, 1})             // XY with odd number of bytes
+	f.Add([]byte{0x00, 0x04, 0x10, 0x03})                               // XY without points
+	f.Add([]byte{0x00, 0x0c, 0x1c, 0x05, 0xc2, 0x5a, 0, 0, 0, 0, 0, 0}) // ANGLE -90
+	f.Fuzz(func(t *testing.T, data []byte) {
+		record, err := decodeRecord(mockFilehandler(data))
+		if err != nil {
+			return
+		}
+		if int(record.Size) != HEADERSIZE+len(record.Data) {
+			t.Fatalf("record size %d does not match %d data bytes", record.Size, len(record.Data))
+		}
+		assertEqualByteSlice(t, data[:record.Size], record.Bytes())
+		_, _ = record.GetData()
+		_ = record.String()
+	})
+}
+
+func FuzzDecodeLibrary(f *testing.F) {
+	original, err := os.ReadFile(testFile)
+	if err != nil {
+		f.Fatalf("could not read test gds file: %v", err)
+	}
+	f.Add(original)
+	library := NewLibrary("FUZZ", 1e-6, 1e-9)
+	library.SetTimes(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	top, _ := library.NewCell("TOP")
+	cell, _ := library.NewCell("CELL")
+	cell.AddRect(LayerSpec{1, 0}, 0, 0, 10, 10)
+	cell.AddText(LayerSpec{2, 0}, 5, 5, "label").Angle = -90
+	top.AddInstance("CELL", 0, 0).Angle = -90
+	top.AddArray("CELL", 0, 0, 2, 3, 20, 20).Mag = 0.5
+	var built bytes.Buffer
+	err = WriteGDS(&built, library)
+	if err != nil {
+		f.Fatalf("could not write seed library: %v", err)
+	}
+	f.Add(built.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		library, err := decodeLibrary(mockFilehandler(data))
+		if err != nil {
+			return
+		}
+		var written bytes.Buffer
+		err = WriteGDS(&written, library)
+		if err != nil {
+			t.Fatalf("could not write decoded library: %v", err)
+		}
+		libraryNew, err := ReadGDS(&written)
+		if err != nil {
+			t.Fatalf("could not read written library: %v", err)
+		}
+		if !reflect.DeepEqual(withoutSource(library), withoutSource(libraryNew)) {
+			t.Fatalf("library changed in round trip:\n%v\n%v", library, libraryNew)
+		}
+	})
+}
+
+// Copy of the library without the original records, which differ after writing
+func withoutSource(library *Library) Library {
+	result := *library
+	result.source = nil
+	result.Structures = map[string]*Structure{}
+	for name, structure := range library.Structures {
+		s := *structure
+		s.source = nil
+		s.Elements = []Element{}
+		for _, element := range structure.Elements {
+			switch e := asPointer(element).(type) {
+			case *Boundary:
+				c := *e
+				c.source = nil
+				element = &c
+			case *Path:
+				c := *e
+				c.source = nil
+				element = &c
+			case *Text:
+				c := *e
+				c.source = nil
+				element = &c
+			case *Node:
+				c := *e
+				c.source = nil
+				element = &c
+			case *Box:
+				c := *e
+				c.source = nil
+				element = &c
+			case *SRef:
+				c := *e
+				c.source = nil
+				element = &c
+			case *ARef:
+				c := *e
+				c.source = nil
+				element = &c
+			}
+			s.Elements = append(s.Elements, element)
+		}
+		result.Structures[name] = &s
+	}
+	return result
+}
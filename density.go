@@ -0,0 +1,323 @@
+package gds
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+)
+
+// DensityOptions configures Density, lengths are in database units
+type DensityOptions struct {
+	// Edge length of the square windows
+	Window int32
+	// Distance between the lower left corners of neighboring windows, defaults to Window
+	Step int32
+	// Windows with a density (covered fraction between 0 and 1) below Min or above Max are reported
+	// as violations, 0 disables the check
+	Min, Max float64
+	// Area that is covered by windows as x0, y0, x1, y1, defaults to the bounding box of all layers of the cell.
+	// The last window of each row and column is moved back to end at the extent, windows larger than the
+	// extent are clipped.
+	Extent []int32
+}
+
+// DensityWindow is the fraction of the window x0, y0, x1, y1 that is covered by the layer
+type DensityWindow struct {
+	X0, Y0, X1, Y1 int32
+	Density        float64
+}
+
+func (d DensityWindow) String() string {
+	return fmt.Sprintf("(%d, %d)-(%d, %d): %.2f%%", d.X0, d.Y0, d.X1, d.Y1, 100*d.Density)
+}
+
+// DensityMap holds the density of a layer for every window, Windows[row][column] with rows from bottom to top
+// and columns from left to right
+type DensityMap struct {
+	Layer      string
+	Windows    [][]DensityWindow
+	Min, Max   float64
+	Violations []DensityWindow
+}
+
+// Density computes the density of a layer of a cell in a sliding window. All instances are flattened and
+// overlapping shapes are merged, so every point counts once. Paths count with their outline.
+func (l *Library) Density(cell string, layer string, opts DensityOptions) (*DensityMap, error) {
+	if _, err := ParseLayerSpec(layer); err != nil {
+		return nil, err
+	}
+	if opts.Window <= 0 || opts.Step < 0 {
+		return nil, fmt.Errorf("window must be positive and step must not be negative, got %d and %d", opts.Window, opts.Step)
+	}
+	if opts.Step == 0 {
+		opts.Step = opts.Window
+	}
+	layers, err := l.FlattenPolygons(cell)
+	if err != nil {
+		return nil, err
+	}
+	extent := opts.Extent
+	if extent == nil {
+		all := [][]int32{}
+		for _, polygons := range layers {
+			all = append(all, polygons...)
+		}
+		extent = BoundingBox(all)
+	}
+	if len(extent) != 4 || extent[0] >= extent[2] || extent[1] >= extent[3] {
+		return nil, fmt.Errorf("could not compute density of cell %s, empty extent %v", cell, extent)
+	}
+	columns := windowStarts(extent[0], extent[2], opts.Window, opts.Step)
+	rows := windowStarts(extent[1], extent[3], opts.Window, opts.Step)
+
+	// sort the polygons into the windows they overlap
+	buckets := make([][][]int32, len(rows)*len(columns))
+	for _, polygon := range layers[layer] {
+		box := BoundingBox([][]int32{polygon})
+		firstColumn, lastColumn := overlappingWindows(columns, extent[2], opts.Window, box[0], box[2])
+		firstRow, lastRow := overlappingWindows(rows, extent[3], opts.Window, box[1], box[3])
+		for row := firstRow; row < lastRow; row++ {
+			for column := firstColumn; column < lastColumn; column++ {
+				buckets[row*len(columns)+column] = append(buckets[row*len(columns)+column], polygon)
+			}
+		}
+	}
+
+	result := &DensityMap{Layer: layer, Windows: make([][]DensityWindow, len(rows)), Min: math.Inf(1), Max: math.Inf(-1), Violations: []DensityWindow{}}
+	for row, y0 := range rows {
+		result.Windows[row] = make([]DensityWindow, len(columns))
+		for column, x0 := range columns {
+			window := DensityWindow{X0: x0, Y0: y0, X1: min(x0+opts.Window, extent[2]), Y1: min(y0+opts.Window, extent[3])}
+			window.Density = coveredArea(buckets[row*len(columns)+column], window) / windowArea(window)
+			result.Windows[row][column] = window
+			result.Min = min(result.Min, window.Density)
+			result.Max = max(result.Max, window.Density)
+			if window.Density < opts.Min || (opts.Max > 0 && window.Density > opts.Max) {
+				result.Violations = append(result.Violations, window)
+			}
+		}
+	}
+	return result, nil
+}
+
+func windowArea(window DensityWindow) float64 {
+	return float64(window.X1-window.X0) * float64(window.Y1-window.Y0)
+}
+
+// BoundingBox returns the smallest rectangle x0, y0, x1, y1 that contains all polygons, nil if there are no points
+func BoundingBox(polygons [][]int32) []int32 {
+	var box []int32
+	for _, polygon := range polygons {
+		for i := 0; i+1 < len(polygon); i += 2 {
+			if box == nil {
+				box = []int32{polygon[i], polygon[i+1], polygon[i], polygon[i+1]}
+				continue
+			}
+			box[0], box[1] = min(box[0], polygon[i]), min(box[1], polygon[i+1])
+			box[2], box[3] = max(box[2], polygon[i]), max(box[3], polygon[i+1])
+		}
+	}
+	return box
+}
+
+// Returns the lower coordinates of windows covering lo to hi, the last window ends at hi
+func windowStarts(lo, hi, window, step int32) []int32 {
+	starts := []int32{lo}
+	for start := lo; start+window < hi; {
+		start = min(start+step, hi-window)
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+// Returns the range of windows that overlap the interval lo to hi
+func overlappingWindows(starts []int32, end int32, window int32, lo, hi int32) (int, int) {
+	first := sort.Search(len(starts), func(i int) bool { return min(starts[i]+window, end) > lo })
+	last := sort.Search(len(starts), func(i int) bool { return starts[i] >= hi })
+	return first, max(first, last)
+}
+
+// Non-vertical polygon edge with x0 < x1, dir is 1 if the edge runs in positive x direction
+type sweepEdge struct {
+	x0, y0, x1, y1 float64
+	dir            int
+	polygon        int
+}
+
+func (e sweepEdge) y(x float64) float64 {
+	return e.y0 + (e.y1-e.y0)*(x-e.x0)/(e.x1-e.x0)
+}
+
+// Returns the area of the union of all polygons inside a window. The window is cut into vertical strips at
+// all vertices, edge crossings and crossings with the window border. Inside a strip no edges cross, so the
+// covered length changes linearly and the area of a strip is its width times the covered length at its center.
+// Polygons are filled with the nonzero winding rule.
+func coveredArea(polygons [][]int32, window DensityWindow) float64 {
+	wx0, wy0, wx1, wy1 := float64(window.X0), float64(window.Y0), float64(window.X1), float64(window.Y1)
+	edges := []sweepEdge{}
+	xs := []float64{wx0, wx1}
+	for p, polygon := range polygons {
+		n := len(polygon) / 2
+		for i := range n {
+			j := (i + 1) % n
+			e := sweepEdge{float64(polygon[2*i]), float64(polygon[2*i+1]), float64(polygon[2*j]), float64(polygon[2*j+1]), 1, p}
+			xs = append(xs, e.x0)
+			if e.x0 == e.x1 {
+				continue
+			}
+			if e.x0 > e.x1 {
+				e = sweepEdge{e.x1, e.y1, e.x0, e.y0, -1, p}
+			}
+			for _, border := range []float64{wy0, wy1} {
+				if (e.y0 < border) != (e.y1 < border) {
+					xs = append(xs, e.x0+(e.x1-e.x0)*(border-e.y0)/(e.y1-e.y0))
+				}
+			}
+			edges = append(edges, e)
+		}
+	}
+	for i, a := range edges {
+		if a.y0 == a.y1 {
+			continue // horizontal edges only cross sloped edges, which find them
+		}
+		for j, b := range edges {
+			if i == j || (b.y0 != b.y1 && j < i) {
+				continue
+			}
+			lo, hi := max(a.x0, b.x0), min(a.x1, b.x1)
+			if lo >= hi {
+				continue
+			}
+			// the difference of both edges changes sign inside the common range
+			da, db := a.y(lo)-b.y(lo), a.y(hi)-b.y(hi)
+			if (da < 0 && db > 0) || (da > 0 && db < 0) {
+				xs = append(xs, lo+(hi-lo)*da/(da-db))
+			}
+		}
+	}
+	slices.Sort(xs)
+	xs = slices.Compact(xs)
+	slices.SortFunc(edges, func(a, b sweepEdge) int {
+		switch {
+		case a.x0 < b.x0:
+			return -1
+		case a.x0 > b.x0:
+			return 1
+		}
+		return 0
+	})
+
+	type crossing struct {
+		y       float64
+		dir     int
+		polygon int
+	}
+	area := 0.0
+	active := []sweepEdge{}
+	next := 0
+	winding := make([]int, len(polygons))
+	for k := 0; k+1 < len(xs); k++ {
+		x0, x1 := xs[k], xs[k+1]
+		if x0 < wx0 || x1 > wx1 {
+			continue
+		}
+		mid := (x0 + x1) / 2
+		for next < len(edges) && edges[next].x0 < mid {
+			active = append(active, edges[next])
+			next++
+		}
+		crossings := []crossing{}
+		remaining := active[:0]
+		for _, e := range active {
+			if e.x1 <= mid {
+				continue
+			}
+			remaining = append(remaining, e)
+			crossings = append(crossings, crossing{e.y(mid), e.dir, e.polygon})
+		}
+		active = remaining
+		sort.Slice(crossings, func(i, j int) bool { return crossings[i].y < crossings[j].y })
+		// count the polygons with nonzero winding number from bottom to top
+		covered, length := 0, 0.0
+		for i, c := range crossings {
+			before := winding[c.polygon] != 0
+			winding[c.polygon] += c.dir
+			switch after := winding[c.polygon] != 0; {
+			case !before && after:
+				covered++
+			case before && !after:
+				covered--
+			}
+			if covered > 0 && i+1 < len(crossings) {
+				lo, hi := max(c.y, wy0), min(crossings[i+1].y, wy1)
+				length += max(hi-lo, 0)
+			}
+		}
+		for _, c := range crossings {
+			winding[c.polygon] = 0
+		}
+		area += length * (x1 - x0)
+	}
+	return area
+}
+
+// Finds polygons near a rectangle by sorting their bounding boxes into square buckets
+type polygonIndex struct {
+	size     int32
+	polygons [][]int32
+	boxes    [][]int32
+	buckets  map[[2]int32][]int
+}
+
+func newPolygonIndex(polygons [][]int32, size int32) *polygonIndex {
+	index := &polygonIndex{size: max(size, 1), polygons: polygons, boxes: make([][]int32, len(polygons)), buckets: map[[2]int32][]int{}}
+	for i, polygon := range polygons {
+		box := BoundingBox([][]int32{polygon})
+		if box == nil {
+			continue
+		}
+		index.boxes[i] = box
+		for bx := floorDiv(box[0], index.size); bx <= floorDiv(box[2], index.size); bx++ {
+			for by := floorDiv(box[1], index.size); by <= floorDiv(box[3], index.size); by++ {
+				index.buckets[[2]int32{bx, by}] = append(index.buckets[[2]int32{bx, by}], i)
+			}
+		}
+	}
+	return index
+}
+
+// Returns the polygons whose bounding boxes overlap the rectangle x0, y0, x1, y1 with positive area
+func (p *polygonIndex) query(box []int32) [][]int32 {
+	indices := p.queryIndices(box)
+	result := make([][]int32, len(indices))
+	for i, index := range indices {
+		result[i] = p.polygons[index]
+	}
+	return result
+}
+
+func (p *polygonIndex) queryIndices(box []int32) []int {
+	result := []int{}
+	seen := map[int]bool{}
+	for bx := floorDiv(box[0], p.size); bx <= floorDiv(box[2], p.size); bx++ {
+		for by := floorDiv(box[1], p.size); by <= floorDiv(box[3], p.size); by++ {
+			for _, i := range p.buckets[[2]int32{bx, by}] {
+				other := p.boxes[i]
+				if seen[i] || other[0] >= box[2] || other[2] <= box[0] || other[1] >= box[3] || other[3] <= box[1] {
+					continue
+				}
+				seen[i] = true
+				result = append(result, i)
+			}
+		}
+	}
+	return result
+}
+
+func floorDiv(a, b int32) int32 {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+	return a / b
+}
@@ -0,0 +1,72 @@
+package gds
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCoveredArea(t *testing.T) {
+	window := DensityWindow{X0: 0, Y0: 0, X1: 100, Y1: 100}
+	overlapping := [][]int32{
+		{0, 0, 60, 0, 60, 60, 0, 60},
+		{40, 40, 40, 80, 80, 80, 80, 40}, // clockwise
+	}
+	assertEqual(t, 3600.0+1600-400, coveredArea(overlapping, window))
+	// a triangle crossing the window border and a diamond overlapping it
+	sloped := [][]int32{
+		{-50, 0, 150, 0, 50, 100},
+		{50, 50, 100, 100, 50, 150, 0, 100},
+	}
+	assertEqual(t, 7500.0+2500-1250, coveredArea(sloped, window))
+	// a self-overlapping polygon counts once
+	twice := [][]int32{{0, 0, 10, 0, 10, 10, 0, 10, 0, 0, 10, 0, 10, 10, 0, 10}}
+	assertEqual(t, 100.0, coveredArea(twice, window))
+}
+
+func TestDensity(t *testing.T) {
+	library := NewLibrary("DENSITY", 1e-6, 1e-9)
+	tile, err := library.NewCell("TILE")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	tile.AddRect(LayerSpec{1, 0}, 0, 0, 50, 50)
+	tile.AddRect(LayerSpec{1, 0}, 25, 25, 75, 75)
+	top, err := library.NewCell("TOP")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	top.AddRect(LayerSpec{2, 0}, 0, 0, 400, 200)
+	top.AddArray("TILE", 0, 0, 2, 2, 100, 100)
+
+	density, err := library.Density("TOP", "1/0", DensityOptions{Window: 200, Step: 100, Min: 0.1, Max: 0.25})
+	if err != nil {
+		t.Fatalf("could not compute density: %v", err)
+	}
+	assertEqual(t, 1, len(density.Windows))
+	assertEqual(t, 3, len(density.Windows[0]))
+	// each tile covers 4375, the extent is taken from the bounding box of all layers
+	assertEqual(t, 4*4375.0/40000, density.Windows[0][0].Density)
+	assertEqual(t, 2*4375.0/40000, density.Windows[0][1].Density)
+	assertEqual(t, 0.0, density.Windows[0][2].Density)
+	assertEqual(t, 0.0, density.Min)
+	assertEqual(t, 2, len(density.Violations))
+
+	rotated := top.AddInstance("TILE", 300, 20)
+	rotated.Angle = 45
+	density, err = library.Density("TOP", "1/0", DensityOptions{Window: 200, Step: 100})
+	if err != nil {
+		t.Fatalf("could not compute density: %v", err)
+	}
+	if math.Abs(density.Windows[0][2].Density-4375.0/40000) > 1e-3 {
+		t.Fatalf("rotated instance should count in the last window, got %v", density.Windows[0][2])
+	}
+
+	_, err = library.Density("TOP", "1/0", DensityOptions{})
+	if err == nil {
+		t.Fatalf("could compute density without window")
+	}
+	_, err = library.Density("TOP", "metal1", DensityOptions{Window: 100})
+	if err == nil {
+		t.Fatalf("could compute density of invalid layer")
+	}
+}
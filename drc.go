@@ -0,0 +1,455 @@
+package gds
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// DRCKind selects the measurement of a DRCRule
+type DRCKind int
+
+const (
+	// Minimum distance between opposite edges inside shapes of Layer
+	DRCWidth DRCKind = iota
+	// Minimum distance between separate shapes of Layer
+	DRCSpace
+	// Minimum distance between edges of the same shape of Layer facing each other across a gap
+	DRCNotch
+	// Minimum distance between shapes of Layer and shapes of Other
+	DRCSeparation
+	// Minimum distance by which shapes of Other extend beyond shapes of Layer, shapes of Layer must lie inside Other
+	DRCEnclosure
+	// Minimum area of shapes of Layer
+	DRCArea
+)
+
+func (k DRCKind) String() string {
+	switch k {
+	case DRCWidth:
+		return "width"
+	case DRCSpace:
+		return "space"
+	case DRCNotch:
+		return "notch"
+	case DRCSeparation:
+		return "separation"
+	case DRCEnclosure:
+		return "enclosure"
+	case DRCArea:
+		return "area"
+	}
+	return fmt.Sprintf("DRCKind(%d)", int(k))
+}
+
+// DRCRule is a single design rule. Value is a distance in database units or, for DRCArea,
+// an area in square database units.
+type DRCRule struct {
+	Name  string
+	Kind  DRCKind
+	Layer LayerSpec
+	// Second layer of DRCSeparation and DRCEnclosure
+	Other LayerSpec
+	Value float64
+}
+
+// DRCMarker is a rule violation in top cell coordinates. Edges holds the violating edge pair as
+// x0, y0, x1, y1 each or a single edge of a shape that is not enclosed, area violations have no edges.
+type DRCMarker struct {
+	Rule  string
+	Kind  DRCKind
+	Layer string
+	// Measured distance or area, 0 for shapes that are not enclosed
+	Value float64
+	Edges [][4]int32
+	// Bounding box of the violation as x0, y0, x1, y1
+	Box []int32
+}
+
+func (d DRCMarker) String() string {
+	return fmt.Sprintf("%s (%v on %s): %g at %v", d.Rule, d.Kind, d.Layer, d.Value, d.Box)
+}
+
+// CheckDRC flattens top and checks all rules. Shapes of a layer are merged before checking, so overlapping and
+// abutting shapes count as one. Distances are measured between edges that face each other with an angle of more
+// than 90° (Euclidean metric), edge pairs that touch are skipped except for enclosure.
+func (l *Library) CheckDRC(top string, rules []DRCRule) ([]DRCMarker, error) {
+	layers, err := l.FlattenPolygons(top)
+	if err != nil {
+		return nil, fmt.Errorf("could not check design rules of cell %s: %v", top, err)
+	}
+	regions := map[string]*drcRegion{}
+	region := func(layer LayerSpec) *drcRegion {
+		if r, ok := regions[layer.String()]; ok {
+			return r
+		}
+		r := newDRCRegion(layers[layer.String()])
+		regions[layer.String()] = r
+		return r
+	}
+	markers := []DRCMarker{}
+	for _, rule := range rules {
+		if rule.Value < 0 {
+			return nil, fmt.Errorf("rule %s has negative value %g", rule.Name, rule.Value)
+		}
+		add := func(value float64, edges ...drcEdge) {
+			marker := DRCMarker{Rule: rule.Name, Kind: rule.Kind, Layer: rule.Layer.String(), Value: value, Edges: [][4]int32{}}
+			points := []int32{}
+			for _, e := range edges {
+				edge := [4]int32{roundInt32(e.x0), roundInt32(e.y0), roundInt32(e.x1), roundInt32(e.y1)}
+				marker.Edges = append(marker.Edges, edge)
+				points = append(points, edge[:]...)
+			}
+			marker.Box = BoundingBox([][]int32{points})
+			markers = append(markers, marker)
+		}
+		r := region(rule.Layer)
+		switch rule.Kind {
+		case DRCWidth, DRCSpace, DRCNotch:
+			edgePairs(r.edges, r.edges, rule.Value, func(a, b drcEdge, distance float64, p, q [2]float64) {
+				sameShape := a.component == b.component
+				switch {
+				case rule.Kind == DRCWidth && sameShape && facing(a, p, q) && facing(b, q, p):
+				case rule.Kind == DRCSpace && !sameShape && facing(a, q, p) && facing(b, p, q):
+				case rule.Kind == DRCNotch && sameShape && facing(a, q, p) && facing(b, p, q):
+				default:
+					return
+				}
+				if distance > 0 && direction(a, b) < 0 {
+					add(distance, a, b)
+				}
+			})
+		case DRCSeparation:
+			edgePairs(r.edges, region(rule.Other).edges, rule.Value, func(a, b drcEdge, distance float64, p, q [2]float64) {
+				if distance > 0 && direction(a, b) < 0 && facing(a, q, p) && facing(b, p, q) {
+					add(distance, a, b)
+				}
+			})
+		case DRCEnclosure:
+			other := region(rule.Other)
+			edgePairs(r.edges, other.edges, rule.Value, func(a, b drcEdge, distance float64, p, q [2]float64) {
+				if direction(a, b) > 0 && (distance == 0 || (facing(a, q, p) && facing(b, q, p))) {
+					add(distance, a, b)
+				}
+			})
+			for _, e := range r.edges {
+				// a point just inside the shape next to the edge
+				x, y, nx, ny := e.midpoint()
+				if !other.contains(x+drcEpsilon*nx, y+drcEpsilon*ny) {
+					add(0, e)
+				}
+			}
+		case DRCArea:
+			for _, polygons := range r.components() {
+				box := BoundingBox(polygons)
+				area := coveredArea(polygons, DensityWindow{X0: box[0], Y0: box[1], X1: box[2], Y1: box[3]})
+				if area < rule.Value {
+					markers = append(markers, DRCMarker{Rule: rule.Name, Kind: rule.Kind, Layer: rule.Layer.String(), Value: area, Edges: [][4]int32{}, Box: box})
+				}
+			}
+		default:
+			return nil, fmt.Errorf("rule %s has unknown kind %v", rule.Name, rule.Kind)
+		}
+	}
+	return markers, nil
+}
+
+// Distance from an edge at which points are classified as inside or outside of a region
+const drcEpsilon = 0.25
+
+// Boundary edge of a merged region, the inside of the region is left of the edge
+type drcEdge struct {
+	x0, y0, x1, y1 float64
+	// index of the connected group of polygons the edge belongs to
+	component int
+}
+
+// Returns the midpoint and the unit normal pointing into the region
+func (e drcEdge) midpoint() (float64, float64, float64, float64) {
+	length := math.Hypot(e.x1-e.x0, e.y1-e.y0)
+	return (e.x0 + e.x1) / 2, (e.y0 + e.y1) / 2, -(e.y1 - e.y0) / length, (e.x1 - e.x0) / length
+}
+
+// Reports whether to lies on the inner side of edge e, seen from the point from on e
+func facing(e drcEdge, from, to [2]float64) bool {
+	_, _, nx, ny := e.midpoint()
+	return (to[0]-from[0])*nx+(to[1]-from[1])*ny > 0
+}
+
+// Cosine of the angle between the edge directions, negative for edges running in opposite directions.
+// Values within the rounding error of transformed coordinates are returned as 0.
+func direction(a, b drcEdge) float64 {
+	cos := ((a.x1-a.x0)*(b.x1-b.x0) + (a.y1-a.y0)*(b.y1-b.y0)) / math.Hypot(a.x1-a.x0, a.y1-a.y0) / math.Hypot(b.x1-b.x0, b.y1-b.y0)
+	if math.Abs(cos) < 0.01 {
+		return 0
+	}
+	return cos
+}
+
+func roundInt32(value float64) int32 {
+	return int32(math.Round(value))
+}
+
+// Shapes of a layer merged into connected components
+type drcRegion struct {
+	polygons  [][]int32
+	component []int
+	index     *polygonIndex
+	edges     []drcEdge
+}
+
+func newDRCRegion(polygons [][]int32) *drcRegion {
+	r := &drcRegion{polygons: polygons, component: make([]int, len(polygons)), index: newPolygonIndex(polygons, averageSize(polygons))}
+	// union find over polygons that overlap or touch
+	parent := make([]int, len(polygons))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i, polygon := range polygons {
+		box := BoundingBox([][]int32{polygon})
+		if box == nil {
+			continue
+		}
+		for _, j := range r.index.queryIndices([]int32{box[0] - 1, box[1] - 1, box[2] + 1, box[3] + 1}) {
+			if find(i) != find(j) && polygonsTouch(polygon, polygons[j]) {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+	for i := range polygons {
+		r.component[i] = find(i)
+	}
+
+	seen := map[[4]float64]bool{}
+	for i, polygon := range polygons {
+		n := len(polygon) / 2
+		box := BoundingBox([][]int32{polygon})
+		if n < 3 {
+			continue
+		}
+		nearby := r.index.query([]int32{box[0] - 1, box[1] - 1, box[2] + 1, box[3] + 1})
+		for k := range n {
+			l := (k + 1) % n
+			ax, ay, bx, by := float64(polygon[2*k]), float64(polygon[2*k+1]), float64(polygon[2*l]), float64(polygon[2*l+1])
+			if ax == bx && ay == by {
+				continue
+			}
+			for _, piece := range splitEdge(ax, ay, bx, by, nearby) {
+				e := drcEdge{x0: ax + piece[0]*(bx-ax), y0: ay + piece[0]*(by-ay), x1: ax + piece[1]*(bx-ax), y1: ay + piece[1]*(by-ay), component: r.component[i]}
+				x, y, nx, ny := e.midpoint()
+				left := r.contains(x+drcEpsilon*nx, y+drcEpsilon*ny)
+				right := r.contains(x-drcEpsilon*nx, y-drcEpsilon*ny)
+				if left == right {
+					continue
+				}
+				if !left {
+					e.x0, e.y0, e.x1, e.y1 = e.x1, e.y1, e.x0, e.y0
+				}
+				key := [4]float64{e.x0, e.y0, e.x1, e.y1}
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				r.edges = append(r.edges, e)
+			}
+		}
+	}
+	return r
+}
+
+// Average of width and height of the bounding boxes, used as bucket size of the index
+func averageSize(polygons [][]int32) int32 {
+	total, count := 0.0, 0
+	for _, polygon := range polygons {
+		if box := BoundingBox([][]int32{polygon}); box != nil {
+			total += float64(box[2]-box[0]) + float64(box[3]-box[1])
+			count += 2
+		}
+	}
+	if count == 0 {
+		return 1
+	}
+	return int32(max(total/float64(count), 1))
+}
+
+// Returns the polygons of every connected component
+func (r *drcRegion) components() [][][]int32 {
+	groups := map[int][][]int32{}
+	order := []int{}
+	for i, polygon := range r.polygons {
+		c := r.component[i]
+		if _, ok := groups[c]; !ok {
+			order = append(order, c)
+		}
+		groups[c] = append(groups[c], polygon)
+	}
+	result := make([][][]int32, len(order))
+	for i, c := range order {
+		result[i] = groups[c]
+	}
+	return result
+}
+
+// Reports whether a point lies inside any polygon of the region with the nonzero winding rule
+func (r *drcRegion) contains(x, y float64) bool {
+	box := []int32{int32(math.Floor(x)), int32(math.Floor(y)), int32(math.Floor(x)) + 1, int32(math.Floor(y)) + 1}
+	for _, polygon := range r.index.query(box) {
+		if windingNumber(polygon, x, y) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func windingNumber(polygon []int32, x, y float64) int {
+	winding := 0
+	n := len(polygon) / 2
+	for i := range n {
+		j := (i + 1) % n
+		ax, ay, bx, by := float64(polygon[2*i]), float64(polygon[2*i+1]), float64(polygon[2*j]), float64(polygon[2*j+1])
+		side := (bx-ax)*(y-ay) - (by-ay)*(x-ax)
+		if ay <= y && by > y && side > 0 {
+			winding++
+		} else if ay > y && by <= y && side < 0 {
+			winding--
+		}
+	}
+	return winding
+}
+
+func polygonsTouch(a, b []int32) bool {
+	n, m := len(a)/2, len(b)/2
+	for i := range n {
+		k := (i + 1) % n
+		for j := range m {
+			l := (j + 1) % m
+			_, _, ok := segmentIntersection(int64(a[2*i]), int64(a[2*i+1]), int64(a[2*k]), int64(a[2*k+1]),
+				int64(b[2*j]), int64(b[2*j+1]), int64(b[2*l]), int64(b[2*l+1]))
+			if ok {
+				return true
+			}
+		}
+	}
+	// one polygon lies inside the other
+	return (m > 0 && windingNumber(a, float64(b[0]), float64(b[1])) != 0) || (n > 0 && windingNumber(b, float64(a[0]), float64(a[1])) != 0)
+}
+
+// Splits the edge a-b at all points where edges of the polygons cross or touch it, returns the
+// pieces as ranges of the edge parameter from 0 at a to 1 at b
+func splitEdge(ax, ay, bx, by float64, polygons [][]int32) [][2]float64 {
+	cuts := []float64{0, 1}
+	dx, dy := bx-ax, by-ay
+	length2 := dx*dx + dy*dy
+	for _, polygon := range polygons {
+		n := len(polygon) / 2
+		for i := range n {
+			j := (i + 1) % n
+			cx, cy, ex, ey := float64(polygon[2*i]), float64(polygon[2*i+1]), float64(polygon[2*j]), float64(polygon[2*j+1])
+			// endpoints of the other edge on a-b
+			for _, point := range [][2]float64{{cx, cy}, {ex, ey}} {
+				if (point[0]-ax)*dy-(point[1]-ay)*dx == 0 {
+					cuts = append(cuts, ((point[0]-ax)*dx+(point[1]-ay)*dy)/length2)
+				}
+			}
+			// proper crossings
+			denominator := dx*(ey-cy) - dy*(ex-cx)
+			if denominator == 0 {
+				continue
+			}
+			t := ((cx-ax)*(ey-cy) - (cy-ay)*(ex-cx)) / denominator
+			u := ((cx-ax)*dy - (cy-ay)*dx) / denominator
+			if u >= 0 && u <= 1 {
+				cuts = append(cuts, t)
+			}
+		}
+	}
+	cuts = slices.DeleteFunc(cuts, func(t float64) bool { return t < 0 || t > 1 })
+	slices.Sort(cuts)
+	cuts = slices.Compact(cuts)
+	pieces := make([][2]float64, 0, len(cuts)-1)
+	for i := 0; i+1 < len(cuts); i++ {
+		pieces = append(pieces, [2]float64{cuts[i], cuts[i+1]})
+	}
+	return pieces
+}
+
+// Calls check for all pairs of edges from as and bs closer than limit with their closest points.
+// Pairs of the same slice are visited once.
+func edgePairs(as, bs []drcEdge, limit float64, check func(a, b drcEdge, distance float64, p, q [2]float64)) {
+	same := len(as) > 0 && len(bs) > 0 && &as[0] == &bs[0]
+	boxes := make([][]int32, len(bs))
+	for i, e := range bs {
+		boxes[i] = []int32{int32(math.Floor(min(e.x0, e.x1))), int32(math.Floor(min(e.y0, e.y1))), int32(math.Ceil(max(e.x0, e.x1))), int32(math.Ceil(max(e.y0, e.y1)))}
+	}
+	index := newPolygonIndex(boxes, int32(max(limit, 1)))
+	margin := int32(math.Ceil(limit)) + 1
+	for i, a := range as {
+		box := []int32{int32(math.Floor(min(a.x0, a.x1))) - margin, int32(math.Floor(min(a.y0, a.y1))) - margin,
+			int32(math.Ceil(max(a.x0, a.x1))) + margin, int32(math.Ceil(max(a.y0, a.y1))) + margin}
+		candidates := index.queryIndices(box)
+		slices.Sort(candidates)
+		for _, j := range candidates {
+			if same && j <= i {
+				continue
+			}
+			distance, p, q := segmentDistance(a, bs[j])
+			if distance < limit {
+				check(a, bs[j], distance, p, q)
+			}
+		}
+	}
+}
+
+// Returns the distance between two segments and the closest points on a and b
+func segmentDistance(a, b drcEdge) (float64, [2]float64, [2]float64) {
+	if x, y, ok := segmentIntersectionFloat(a, b); ok {
+		return 0, [2]float64{x, y}, [2]float64{x, y}
+	}
+	best := math.Inf(1)
+	var p, q [2]float64
+	try := func(px, py float64, e drcEdge, swap bool) {
+		cx, cy := closestPoint(e, px, py)
+		if d := math.Hypot(cx-px, cy-py); d < best {
+			best = d
+			if swap {
+				p, q = [2]float64{cx, cy}, [2]float64{px, py}
+			} else {
+				p, q = [2]float64{px, py}, [2]float64{cx, cy}
+			}
+		}
+	}
+	try(a.x0, a.y0, b, false)
+	try(a.x1, a.y1, b, false)
+	try(b.x0, b.y0, a, true)
+	try(b.x1, b.y1, a, true)
+	return best, p, q
+}
+
+func closestPoint(e drcEdge, x, y float64) (float64, float64) {
+	dx, dy := e.x1-e.x0, e.y1-e.y0
+	t := ((x-e.x0)*dx + (y-e.y0)*dy) / (dx*dx + dy*dy)
+	t = min(max(t, 0), 1)
+	return e.x0 + t*dx, e.y0 + t*dy
+}
+
+func segmentIntersectionFloat(a, b drcEdge) (float64, float64, bool) {
+	dx, dy := a.x1-a.x0, a.y1-a.y0
+	ex, ey := b.x1-b.x0, b.y1-b.y0
+	denominator := dx*ey - dy*ex
+	if denominator == 0 {
+		return 0, 0, false
+	}
+	t := ((b.x0-a.x0)*ey - (b.y0-a.y0)*ex) / denominator
+	u := ((b.x0-a.x0)*dy - (b.y0-a.y0)*dx) / denominator
+	if t < 0 || t > 1 || u < 0 || u > 1 {
+		return 0, 0, false
+	}
+	return a.x0 + t*dx, a.y0 + t*dy, true
+}
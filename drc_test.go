@@ -0,0 +1,150 @@
+package gds
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func drcLibrary(t *testing.T) *Library {
+	library := NewLibrary("DRC", 1e-6, 1e-9)
+	top, err := library.NewCell("TOP")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	metal, via := LayerSpec{1, 0}, LayerSpec{2, 0}
+	top.AddRect(metal, 0, 0, 100, 10)  // narrow
+	top.AddRect(metal, 0, 30, 100, 60) // 20 above the narrow one
+	// abutting halves that are only wide enough together
+	top.AddRect(metal, 200, 0, 210, 50)
+	top.AddRect(metal, 210, 0, 230, 50)
+	_, err = top.AddPolygon(metal, []int32{400, 0, 460, 0, 460, 50, 440, 50, 440, 20, 420, 20, 420, 50, 400, 50})
+	if err != nil {
+		t.Fatalf("could not add polygon: %v", err)
+	}
+	top.AddRect(metal, 600, 0, 610, 10) // small
+	top.AddRect(via, 50, 40, 60, 50)
+	top.AddRect(via, 700, 0, 710, 10) // not enclosed
+	return library
+}
+
+func markersByRule(markers []DRCMarker) map[string]int {
+	rules := map[string]int{}
+	for _, marker := range markers {
+		rules[marker.Rule]++
+	}
+	return rules
+}
+
+func TestCheckDRC(t *testing.T) {
+	library := drcLibrary(t)
+	metal, via := LayerSpec{1, 0}, LayerSpec{2, 0}
+	markers, err := library.CheckDRC("TOP", []DRCRule{
+		{Name: "M1.W", Kind: DRCWidth, Layer: metal, Value: 20},
+		{Name: "M1.S", Kind: DRCSpace, Layer: metal, Value: 25},
+		{Name: "M1.N", Kind: DRCNotch, Layer: metal, Value: 25},
+		{Name: "M1.A", Kind: DRCArea, Layer: metal, Value: 500},
+		{Name: "V1.M1.EN", Kind: DRCEnclosure, Layer: via, Other: metal, Value: 15},
+		{Name: "V1.M1.SEP", Kind: DRCSeparation, Layer: via, Other: metal, Value: 100},
+	})
+	if err != nil {
+		t.Fatalf("could not check design rules: %v", err)
+	}
+	rules := markersByRule(markers)
+	// the narrow rectangle once and the small square in both directions
+	assertEqual(t, 3, rules["M1.W"])
+	assertEqual(t, 1, rules["M1.S"])
+	assertEqual(t, 1, rules["M1.N"])
+	assertEqual(t, 1, rules["M1.A"])
+	// the via inside the wide rectangle at top and bottom, the other via with all four edges
+	assertEqual(t, 6, rules["V1.M1.EN"])
+	// both vias are close to a metal shape they are not inside of
+	assertEqual(t, 2, rules["V1.M1.SEP"])
+	for _, marker := range markers {
+		switch marker.Rule {
+		case "M1.S":
+			assertEqual(t, 20.0, marker.Value)
+			assertEqual(t, 2, len(marker.Edges))
+		case "M1.N":
+			assertEqual(t, "[420 20 440 50]", fmt.Sprint(marker.Box))
+		case "M1.A":
+			assertEqual(t, 100.0, marker.Value)
+		}
+	}
+
+	assertEqual(t, 90.0, markers[len(markers)-1].Value)
+
+	_, err = library.CheckDRC("TOP", []DRCRule{{Name: "X", Kind: DRCKind(42), Layer: metal, Value: 1}})
+	if err == nil {
+		t.Fatalf("could check unknown rule kind")
+	}
+}
+
+func TestCheckDRCRotated(t *testing.T) {
+	library := NewLibrary("DRC", 1e-6, 1e-9)
+	cell, err := library.NewCell("CELL")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	cell.AddRect(LayerSpec{1, 0}, 0, 0, 1000, 100)
+	cell.AddRect(LayerSpec{1, 0}, 0, 130, 1000, 300)
+	top, err := library.NewCell("TOP")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	top.AddInstance("CELL", 0, 0).Angle = 30
+	markers, err := library.CheckDRC("TOP", []DRCRule{
+		{Name: "W", Kind: DRCWidth, Layer: LayerSpec{1, 0}, Value: 120},
+		{Name: "S", Kind: DRCSpace, Layer: LayerSpec{1, 0}, Value: 40},
+	})
+	if err != nil {
+		t.Fatalf("could not check design rules: %v", err)
+	}
+	// perpendicular edges at the corners stay unreported despite rounded coordinates
+	rules := markersByRule(markers)
+	assertEqual(t, 1, rules["W"])
+	assertEqual(t, 1, rules["S"])
+}
+
+func TestDRCReport(t *testing.T) {
+	library := drcLibrary(t)
+	markers, err := library.CheckDRC("TOP", []DRCRule{
+		{Name: "M1.S", Kind: DRCSpace, Layer: LayerSpec{1, 0}, Value: 25},
+		{Name: "M1_A", Kind: DRCArea, Layer: LayerSpec{1, 0}, Value: 500},
+	})
+	if err != nil {
+		t.Fatalf("could not check design rules: %v", err)
+	}
+	assertEqual(t, 2, len(markers))
+
+	var buffer bytes.Buffer
+	err = WriteLyrdb(&buffer, library, "TOP", markers)
+	if err != nil {
+		t.Fatalf("could not write report: %v", err)
+	}
+	report := buffer.String()
+	for _, expected := range []string{
+		"<top-cell>TOP</top-cell>",
+		"<name>M1.S</name>",
+		"<category>&#39;M1.S&#39;</category>",
+		"<category>M1_A</category>",
+		"<value>edge-pair: (",
+		"<value>box: (0.6,0;0.61,0.01)</value>",
+	} {
+		if !strings.Contains(report, expected) {
+			t.Fatalf("report does not contain %s:\n%s", expected, report)
+		}
+	}
+
+	err = library.AddMarkers("TOP", LayerSpec{100, 0}, 1, markers)
+	if err != nil {
+		t.Fatalf("could not add markers: %v", err)
+	}
+	cell, err := library.GetCellData("TOP")
+	if err != nil {
+		t.Fatalf("could not get cell data: %v", err)
+	}
+	assertEqual(t, 2, len(cell.Polygons["100/0"].Polygons))
+	assertEqual(t, "M1.S", cell.Labels["100/0"].Labels[0])
+}
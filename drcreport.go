@@ -0,0 +1,131 @@
+package gds
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// AddMarkers draws the markers into cell on layer, every marker becomes a rectangle around its bounding box and a
+// label with the rule name at its center. Markers without extent are enlarged to size in every direction.
+func (l *Library) AddMarkers(cell string, layer LayerSpec, size int32, markers []DRCMarker) error {
+	structure, ok := l.Structures[cell]
+	if !ok {
+		return fmt.Errorf("cell with name %s does not exist", cell)
+	}
+	for _, marker := range markers {
+		if len(marker.Box) != 4 {
+			return fmt.Errorf("marker %v has no bounding box", marker)
+		}
+		x0, y0, x1, y1 := marker.Box[0], marker.Box[1], marker.Box[2], marker.Box[3]
+		if x0 == x1 {
+			x0, x1 = x0-size, x1+size
+		}
+		if y0 == y1 {
+			y0, y1 = y0-size, y1+size
+		}
+		structure.AddRect(layer, x0, y0, x1, y1)
+		structure.AddText(layer, x0+(x1-x0)/2, y0+(y1-y0)/2, marker.Rule)
+	}
+	return nil
+}
+
+// Elements of the KLayout report database format, see https://www.klayout.de/rdb_format.html
+type lyrdbReport struct {
+	XMLName     xml.Name        `xml:"report-database"`
+	Description string          `xml:"description"`
+	Generator   string          `xml:"generator"`
+	TopCell     string          `xml:"top-cell"`
+	Tags        struct{}        `xml:"tags"`
+	Categories  []lyrdbCategory `xml:"categories>category"`
+	Cells       []lyrdbCell     `xml:"cells>cell"`
+	Items       []lyrdbItem     `xml:"items>item"`
+}
+
+type lyrdbCategory struct {
+	Name        string   `xml:"name"`
+	Description string   `xml:"description"`
+	Categories  struct{} `xml:"categories"`
+}
+
+type lyrdbCell struct {
+	Name       string   `xml:"name"`
+	Variant    string   `xml:"variant"`
+	References struct{} `xml:"references"`
+}
+
+type lyrdbItem struct {
+	Tags         struct{} `xml:"tags"`
+	Category     string   `xml:"category"`
+	Cell         string   `xml:"cell"`
+	Visited      bool     `xml:"visited"`
+	Multiplicity int      `xml:"multiplicity"`
+	Values       []string `xml:"values>value"`
+}
+
+var plainCategoryName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// WriteLyrdb writes the markers as KLayout report database (.lyrdb) for top, one category per rule.
+// Coordinates are converted to micrometers with the database unit of the library.
+func WriteLyrdb(w io.Writer, lib *Library, top string, markers []DRCMarker) error {
+	if len(lib.Units) != 2 || lib.Units[1] <= 0 {
+		return fmt.Errorf("could not write report, library has invalid units %v", lib.Units)
+	}
+	scale := lib.Units[1] / 1e-6
+	point := func(x, y int32) string {
+		return fmt.Sprintf("%g,%g", float64(x)*scale, float64(y)*scale)
+	}
+	edge := func(e [4]int32) string {
+		return fmt.Sprintf("(%s;%s)", point(e[0], e[1]), point(e[2], e[3]))
+	}
+	report := lyrdbReport{
+		Description: "Design rule check of " + top,
+		Generator:   "go-gds",
+		TopCell:     top,
+		Categories:  []lyrdbCategory{},
+		Cells:       []lyrdbCell{{Name: top}},
+		Items:       []lyrdbItem{},
+	}
+	known := map[string]bool{}
+	for _, marker := range markers {
+		if !known[marker.Rule] {
+			known[marker.Rule] = true
+			report.Categories = append(report.Categories, lyrdbCategory{Name: marker.Rule, Description: fmt.Sprintf("%v on %s", marker.Kind, marker.Layer)})
+		}
+		category := marker.Rule
+		// dots separate sub-categories, other names are quoted
+		if !plainCategoryName.MatchString(category) {
+			category = "'" + strings.ReplaceAll(category, "'", "\\'") + "'"
+		}
+		var value string
+		switch {
+		case len(marker.Edges) == 2:
+			value = fmt.Sprintf("edge-pair: %s/%s", edge(marker.Edges[0]), edge(marker.Edges[1]))
+		case len(marker.Edges) == 1:
+			value = "edge: " + edge(marker.Edges[0])
+		case len(marker.Box) == 4:
+			value = fmt.Sprintf("box: (%s;%s)", point(marker.Box[0], marker.Box[1]), point(marker.Box[2], marker.Box[3]))
+		default:
+			return fmt.Errorf("marker %v has no location", marker)
+		}
+		report.Items = append(report.Items, lyrdbItem{
+			Category:     category,
+			Cell:         top,
+			Multiplicity: 1,
+			Values:       []string{value, fmt.Sprintf("float: %g", marker.Value)},
+		})
+	}
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return fmt.Errorf("could not write report: %v", err)
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", " ")
+	err = encoder.Encode(report)
+	if err != nil {
+		return fmt.Errorf("could not write report: %v", err)
+	}
+	return nil
+}
@@ -1,47 +1,122 @@
 package gds
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"math"
 	"reflect"
-	"strconv"
-	"strings"
+	"slices"
 )
 
-func fieldsToRecords(data any) ([]Record, error) {
-	records := []Record{}
-	v := reflect.ValueOf(data)
-	for i := range v.NumField() {
-		if v.Type().Field(i).Name == "Elements" {
-			for _, element := range v.Field(i).Interface().([]Element) {
-				newRecords, err := element.Records()
-				if err != nil {
-					return []Record{}, err
-				}
-				records = append(records, newRecords...)
+// Collects the records of an element, structure or library, callers add them in the order required by the
+// stream format. The first conversion error is kept and returned by done.
+type recordEncoder struct {
+	records []Record
+	// optional records that were present when the element was read
+	explicit []string
+	err      error
+}
+
+func (e *recordEncoder) add(name string, value any) {
+	if e.err != nil {
+		return
+	}
+	data, err := gotypeToBytes(value)
+	if err != nil {
+		e.err = fmt.Errorf("could not convert %s to record: %v", name, err)
+		return
+	}
+	if len(data) > math.MaxUint16-HEADERSIZE {
+		e.err = fmt.Errorf("could not convert %s to record: %d bytes exceed the maximum record size", name, len(data))
+		return
+	}
+	if e.records == nil {
+		e.records = make([]Record, 0, 8)
+	}
+	e.records = append(e.records, Record{Size: uint16(HEADERSIZE + len(data)), Datatype: name, Data: data})
+}
+
+// Optional records are written if they were present in the decoded stream or if they differ from their default value
+func (e *recordEncoder) needed(name string, isDefault bool) bool {
+	return !isDefault || slices.Contains(e.explicit, name)
+}
+
+func (e *recordEncoder) optional(name string, value any, isDefault bool) {
+	if e.needed(name, isDefault) {
+		e.add(name, value)
+	}
+}
+
+// Adds a PROPATTR and PROPVALUE record for every property
+func (e *recordEncoder) properties(properties []Property) {
+	for _, property := range properties {
+		e.add("PROPATTR", property.Attribute)
+		e.add("PROPVALUE", property.Value)
+	}
+}
+
+// Adds STRANS, MAG and ANGLE, STRANS is additionally written whenever MAG or ANGLE are written
+func (e *recordEncoder) transformation(strans uint16, mag float64, angle float64) {
+	magNeeded := e.needed("MAG", mag == 1)
+	angleNeeded := e.needed("ANGLE", angle == 0)
+	if magNeeded || angleNeeded || e.needed("STRANS", strans == 0) {
+		e.add("STRANS", strans)
+	}
+	if magNeeded {
+		e.add("MAG", mag)
+	}
+	if angleNeeded {
+		e.add("ANGLE", angle)
+	}
+}
+
+// Returns the collected records, replaced by the original records where the values are unchanged
+func (e *recordEncoder) done(source []Record) ([]Record, error) {
+	if e.err != nil {
+		return []Record{}, e.err
+	}
+	return reuseSource(e.records, source), nil
+}
+
+// Replaces records by the records they were decoded from if both hold the same value.
+// Keeps equivalent but differently encoded data (e.g. reals with non-normalized mantissa) byte-identical on round trip.
+func reuseSource(records []Record, source []Record) []Record {
+	if len(source) == 0 {
+		return records
+	}
+	occurrences := map[string]int{}
+	result := make([]Record, len(records))
+	for i, record := range records {
+		result[i] = record
+		n := occurrences[record.Datatype]
+		occurrences[record.Datatype]++
+		for _, sourceRecord := range source {
+			if sourceRecord.Datatype != record.Datatype {
+				continue
 			}
-		} else if v.Type().Field(i).Name == "Structures" {
-			for _, structure := range v.Field(i).Interface().(map[string]*Structure) {
-				newRecords, err := structure.Records()
-				if err != nil {
-					return []Record{}, err
-				}
-				records = append(records, newRecords...)
+			if n > 0 {
+				n--
+				continue
 			}
-		} else {
-			data, err := gotypeToBytes(v.Field(i).Interface())
+			if bytes.Equal(sourceRecord.Data, record.Data) {
+				break
+			}
+			sourceData, err := sourceRecord.GetData()
+			if err != nil {
+				break
+			}
+			data, err := record.GetData()
 			if err != nil {
-				return []Record{}, fmt.Errorf("could not convert field %s to record: %v", v.Type().Field(i).Name, err)
+				break
 			}
-			newRecord := Record{
-				Size:     uint16(4 + len(data)),
-				Datatype: strings.ToUpper(v.Type().Field(i).Name),
-				Data:     data,
+			if reflect.DeepEqual(sourceData, data) {
+				result[i] = sourceRecord
 			}
-			records = append(records, newRecord)
+			break
 		}
 	}
-	return records, nil
+	return result
 }
 
 // only used for testing
@@ -54,65 +129,47 @@ func recordsToBytes(records []Record) []byte {
 }
 
 func gotypeToBytes(value any) ([]byte, error) {
-	switch reflect.TypeOf(value) {
-	case reflect.TypeOf(int16(0)):
-		return []byte{byte(value.(int16) >> 8), byte(value.(int16))}, nil
-	case reflect.TypeOf(uint16(0)):
-		return []byte{byte(value.(uint16) >> 8), byte(value.(uint16))}, nil
-	case reflect.TypeOf(int32(0)):
-		return []byte{
-			byte(value.(int32) >> 24),
-			byte(value.(int32) >> 16),
-			byte(value.(int32) >> 8),
-			byte(value.(int32)),
-		}, nil
-	case reflect.TypeOf(float64(0)):
-		encodedValue, err := encodeReal(value.(float64))
+	switch v := value.(type) {
+	case int16:
+		return binary.BigEndian.AppendUint16(nil, uint16(v)), nil
+	case uint16:
+		return binary.BigEndian.AppendUint16(nil, v), nil
+	case int32:
+		return binary.BigEndian.AppendUint32(nil, uint32(v)), nil
+	case float64:
+		encodedValue, err := encodeReal(v)
 		return bitsToByteArray(encodedValue), err
-	case reflect.TypeOf(""):
-		bytes := []byte(value.(string))
+	case string:
+		bytes := make([]byte, len(v), len(v)+1)
+		copy(bytes, v)
 		if len(bytes)%2 == 1 {
 			bytes = append(bytes, byte(0))
 		}
 		return bytes, nil
-	case reflect.TypeOf([]int16{}):
-		var data []byte
-		var err error
-		returnSlice := []byte{}
-		for _, v := range value.([]int16) {
-			data, err = gotypeToBytes(v)
-			if err != nil {
-				return []byte{}, err
-			}
-			returnSlice = append(returnSlice, data...)
+	case []int16:
+		returnSlice := make([]byte, 0, 2*len(v))
+		for _, number := range v {
+			returnSlice = binary.BigEndian.AppendUint16(returnSlice, uint16(number))
 		}
 		return returnSlice, nil
-	case reflect.TypeOf([]int32{}):
-		var data []byte
-		var err error
-		returnSlice := []byte{}
-		for _, v := range value.([]int32) {
-			data, err = gotypeToBytes(v)
-			if err != nil {
-				return []byte{}, err
-			}
-			returnSlice = append(returnSlice, data...)
+	case []int32:
+		returnSlice := make([]byte, 0, 4*len(v))
+		for _, number := range v {
+			returnSlice = binary.BigEndian.AppendUint32(returnSlice, uint32(number))
 		}
 		return returnSlice, nil
-	case reflect.TypeOf([]float64{}):
-		var data []byte
-		var err error
-		returnSlice := []byte{}
-		for _, v := range value.([]float64) {
-			data, err = gotypeToBytes(v)
+	case []float64:
+		returnSlice := make([]byte, 0, 8*len(v))
+		for _, number := range v {
+			encodedValue, err := encodeReal(number)
 			if err != nil {
 				return []byte{}, err
 			}
-			returnSlice = append(returnSlice, data...)
+			returnSlice = binary.BigEndian.AppendUint64(returnSlice, encodedValue)
 		}
 		return returnSlice, nil
 	default:
-		return []byte{}, fmt.Errorf("could not convert gotype to bytes, datatype not supported by GDSII: %v", reflect.TypeOf(value))
+		return []byte{}, fmt.Errorf("could not convert gotype to bytes, datatype not supported by GDSII: %T", value)
 	}
 }
 
@@ -129,34 +186,39 @@ func bitsToByteArray(i uint64) []byte {
 	}
 }
 
-// Convert IEEE754 float64 to 8-byte real with 1-bit sign, 7-bit exponent and 56-bit mantissa
+// Convert IEEE754 float64 to 8-byte real with 1-bit sign, 7-bit exponent and 56-bit mantissa.
+// The exponent is excess-64 to base 16, values are normalized so that the first hex digit of the mantissa is not zero.
+// Values below 16^-65 are denormalized if this is exact, values that do not fit into the exponent range return an error.
 func encodeReal(fl float64) (uint64, error) {
+	if math.IsNaN(fl) || math.IsInf(fl, 0) {
+		return 0, fmt.Errorf("value %v can not be represented as 8-byte real", fl)
+	}
 	if fl == 0.0 {
 		return uint64(0x00_00_00_00_00_00_00_00), nil
 	}
-	valueScientifc := fmt.Sprintf("%b", math.Abs(fl))
-	sign := uint64(0x00_00_00_00_00_00_00_00)
-	if fl < 0 {
-		sign = uint64(0x80_00_00_00_00_00_00_00)
+	bits := math.Float64bits(fl)
+	sign := bits & 0x80_00_00_00_00_00_00_00
+	exponent2 := int((bits >> 52) & 0x7ff)
+	if exponent2 == 0 {
+		return 0, fmt.Errorf("value %v is below the range of 8-byte reals", fl)
 	}
-	parts := strings.Split(valueScientifc, "p")
-	factor, err := strconv.ParseUint(parts[0], 10, 64)
-	if err != nil {
-		return 0, fmt.Errorf("could not parse magnitude: %v", err)
+	// fl = mantissa * 2^exponent2 with the implicit leading bit at bit 52
+	mantissa := bits&0x00_0f_ff_ff_ff_ff_ff_ff | 0x00_10_00_00_00_00_00_00
+	exponent2 -= 1075
+	// shift the leading bit into the first hex digit (bits 52-55) so that exponent2+56 becomes a multiple of 4
+	shift := ((exponent2+56)%4 + 4) % 4
+	mantissa <<= shift
+	exponent16 := (exponent2-shift+56)/4 + 64
+	if exponent16 > 0x7f {
+		return 0, fmt.Errorf("value %v exceeds the range of 8-byte reals", fl)
 	}
-	exp, err := strconv.ParseInt(parts[1], 10, 64)
-	if err != nil {
-		return 0, fmt.Errorf("could not parse exponent: %v", err)
-	}
-	factor = factor << 11
-	newExp := int64((exp + 53) / 4)
-	expRemainder := (exp + 53) % 4
-	if expRemainder > 0 {
-		factor = factor >> (4 - expRemainder)
-		newExp++
-	} else if expRemainder < 0 {
-		factor = factor >> (-expRemainder)
-	}
-	newExpUint := uint64(newExp + 64)
-	return uint64(sign | (factor >> 8) | (newExpUint << 56)), nil
+	if exponent16 < 0 {
+		shift = -4 * exponent16
+		if shift >= 56 || mantissa&(1<<shift-1) != 0 {
+			return 0, fmt.Errorf("value %v is below the range of 8-byte reals", fl)
+		}
+		mantissa >>= shift
+		exponent16 = 0
+	}
+	return sign | uint64(exponent16)<<56 | mantissa, nil
 }
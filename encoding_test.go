@@ -2,6 +2,8 @@ package gds
 
 import (
 	"bytes"
+	"math"
+	"strings"
 	"testing"
 )
 
@@ -50,6 +52,18 @@ func TestEncodeReal(t *testing.T) {
 	assertEqual(t, uint64(0b00000000_00000000_00000000_00000000_00000000_00000000_00000000_00000000), ignoreError(encodeReal(0.0)))
 }
 
+func TestEncodeRealRange(t *testing.T) {
+	assertEqual(t, uint64(0x3e_41_89_37_4b_c6_a7_f0), ignoreError(encodeReal(0.001)))
+	assertEqual(t, uint64(0x00_00_00_00_00_00_00_01), ignoreError(encodeReal(math.Ldexp(1, -312))))
+	assertEqual(t, uint64(0x7f_ff_ff_ff_ff_ff_ff_f8), ignoreError(encodeReal(math.Ldexp(1-math.Ldexp(1, -53), 252))))
+	for _, value := range []float64{math.Pow(16, 63), -math.Pow(16, 63), math.Ldexp(1, -313), 1e-300, math.Inf(1), math.NaN()} {
+		_, err := encodeReal(value)
+		if err == nil {
+			t.Fatalf("expected error for out of range value %v", value)
+		}
+	}
+}
+
 func TestDecodeReal(t *testing.T) {
 	assertEqual(t, 0.5, decodeReal(uint64(0b01000000_10000000_00000000_00000000_00000000_00000000_00000000_00000000)))
 	assertEqual(t, -0.5, decodeReal(uint64(0b11000000_10000000_00000000_00000000_00000000_00000000_00000000_00000000)))
@@ -90,3 +104,84 @@ func TestGotypeToBytes(t *testing.T) {
 	assertEqualByteSlice(t, testString, ignoreError(gotypeToBytes("test123")))
 	assertEqualByteSlice(t, []byte("test1234"), ignoreError(gotypeToBytes("test1234")))
 }
+
+func FuzzReal(f *testing.F) {
+	f.Add(uint64(0x40_80_00_00_00_00_00_00)) // 0.5
+	f.Add(uint64(0xc0_80_00_00_00_00_00_00)) // -0.5
+	f.Add(uint64(0xc2_5a_00_00_00_00_00_00)) // -90
+	f.Add(uint64(0x3e_41_89_37_4b_c6_a7_ef)) // 0.001
+	f.Add(uint64(0x00_00_00_00_00_00_00_01)) // smallest unnormalized value
+	f.Add(uint64(0x7f_ff_ff_ff_ff_ff_ff_ff)) // largest value
+	f.Add(uint64(0x7f_10_00_00_00_00_00_00)) // 16^62
+	f.Fuzz(func(t *testing.T, bits uint64) {
+		value := decodeReal(bits)
+		encoded, err := encodeReal(value)
+		if err != nil && math.Abs(value) >= math.Pow(16, 63) {
+			// mantissas close to 1 round up to 16^63 in float64, which is just out of range
+			return
+		}
+		if err != nil {
+			t.Fatalf("could not encode %v decoded from %016x: %v", value, bits, err)
+		}
+		assertEqual(t, value, decodeReal(encoded))
+	})
+}
+
+var benchmarkSum float64
+
+var benchmarkReals = []float64{0.001, 1e-9, 90, -270, 0.5, 1.5, 100, 123456.789}
+
+func BenchmarkEncodeReal(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_, err := encodeReal(benchmarkReals[i%len(benchmarkReals)])
+		if err != nil {
+			b.Fatalf("could not encode real: %v", err)
+		}
+	}
+}
+
+func BenchmarkDecodeReal(b *testing.B) {
+	bits := make([]uint64, len(benchmarkReals))
+	for i, value := range benchmarkReals {
+		bits[i], _ = encodeReal(value)
+	}
+	b.ResetTimer()
+	sum := 0.0
+	for i := 0; i < b.N; i++ {
+		sum += decodeReal(bits[i%len(bits)])
+	}
+	benchmarkSum = sum
+}
+
+func TestElementRecords(t *testing.T) {
+	tests := []struct {
+		element Element
+		records []string
+	}{
+		{Boundary{Layer: 1, XY: []int32{0, 0, 1, 0, 1, 1, 0, 0}}, []string{"BOUNDARY", "LAYER", "DATATYPE", "XY", "ENDEL"}},
+		{Path{ElFlags: 1, Layer: 1, Pathtype: 4, Width: 10, Endextn: 5, XY: []int32{0, 0, 10, 0}},
+			[]string{"PATH", "ELFLAGS", "LAYER", "DATATYPE", "PATHTYPE", "WIDTH", "ENDEXTN", "XY", "ENDEL"}},
+		{Path{Layer: 1, Pathtype: -1, Width: -1, XY: []int32{0, 0, 10, 0}, ElementInfo: ElementInfo{explicit: []string{"BGNEXTN"}}},
+			[]string{"PATH", "LAYER", "DATATYPE", "BGNEXTN", "XY", "ENDEL"}},
+		{Path{Layer: 1, XY: []int32{0, 0, 10, 0}}, []string{"PATH", "LAYER", "DATATYPE", "PATHTYPE", "WIDTH", "XY", "ENDEL"}},
+		{Text{Layer: 1, Mag: 1, XY: []int32{0, 0}, StringBody: "A"}, []string{"TEXT", "LAYER", "TEXTTYPE", "XY", "STRINGBODY", "ENDEL"}},
+		{Text{Layer: 1, Presentation: 2, Mag: 2, XY: []int32{0, 0}, StringBody: "A"},
+			[]string{"TEXT", "LAYER", "TEXTTYPE", "PRESENTATION", "STRANS", "MAG", "XY", "STRINGBODY", "ENDEL"}},
+		{SRef{Sname: "A", Mag: 1, Angle: 90, XY: []int32{0, 0}}, []string{"SREF", "SNAME", "STRANS", "ANGLE", "XY", "ENDEL"}},
+		{ARef{Plex: 3, Sname: "A", Strans: 0x8000, Mag: 1, Colrow: []int16{1, 1}, XY: []int32{0, 0, 1, 0, 0, 1}},
+			[]string{"AREF", "PLEX", "SNAME", "STRANS", "COLROW", "XY", "ENDEL"}},
+		{Box{Layer: 1, XY: []int32{0, 0, 1, 0, 1, 1, 0, 1, 0, 0}}, []string{"BOX", "LAYER", "BOXTYPE", "XY", "ENDEL"}},
+		{Node{Layer: 1, XY: []int32{0, 0}}, []string{"NODE", "LAYER", "NODETYPE", "XY", "ENDEL"}},
+	}
+	for _, test := range tests {
+		records, err := test.element.Records()
+		if err != nil {
+			t.Fatalf("could not produce records for %v: %v", test.element, err)
+		}
+		names := []string{}
+		for _, record := range records {
+			names = append(names, record.Datatype)
+		}
+		assertEqual(t, strings.Join(test.records, " "), strings.Join(names, " "))
+	}
+}
@@ -0,0 +1,47 @@
+package gds
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Causes of decode failures, use errors.Is to check for them
+var (
+	// record type is not part of RecordTypes
+	ErrUnknownRecord = errors.New("unknown record type")
+	// stream ended in the middle of a record or before ENDLIB
+	ErrTruncated = errors.New("truncated stream")
+	// known record that is not allowed at this position
+	ErrUnexpectedRecord = errors.New("unexpected record")
+	// record size or data does not match its record type
+	ErrInvalidRecord = errors.New("invalid record")
+)
+
+// DecodeError describes where decoding failed, use errors.As to retrieve it
+type DecodeError struct {
+	Offset      int64  // byte offset of the record in the stream
+	Record      string // record type, hex code for unknown records
+	Structure   string // enclosing structure, empty outside of structures or before STRNAME
+	Element     int    // index of the enclosing element in Structure.Elements, -1 outside of elements
+	ElementType string // record type that started the enclosing element, e.g. BOUNDARY
+	Err         error
+}
+
+func (e *DecodeError) Error() string {
+	position := []string{fmt.Sprintf("offset %d", e.Offset)}
+	if e.Record != "" {
+		position = append(position, "record "+e.Record)
+	}
+	if e.Structure != "" {
+		position = append(position, "structure "+e.Structure)
+	}
+	if e.Element >= 0 {
+		position = append(position, fmt.Sprintf("element %d (%s)", e.Element, e.ElementType))
+	}
+	return fmt.Sprintf("could not decode GDSII stream: %v at %s", e.Err, strings.Join(position, ", "))
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
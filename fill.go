@@ -0,0 +1,180 @@
+package gds
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// FillOptions configures Fill, lengths are in database units
+type FillOptions struct {
+	// Layer of the fill squares, existing shapes on this layer count towards the density
+	Layer LayerSpec
+	// Edge length of a fill square and gap between neighboring squares
+	Size, Spacing int32
+	// Minimum distance between fill squares and shapes on Layer or Blockages, measured along x and y
+	KeepOut int32
+	// Additional layers that fill must keep out of, e.g. other metal layers or a fill blockage layer
+	Blockages []LayerSpec
+	// Windows of the density check, fill is added to every window below Target
+	Density DensityOptions
+	// Density that every window should reach, between 0 and 1
+	Target float64
+	// Name of the new fill structure, defaults to the top cell name with suffix _FILL
+	Name string
+	// Places a unit cell holding a single square with references instead of boundaries,
+	// horizontal runs of squares become arrays
+	UseCell bool
+}
+
+// Fill adds dummy fill squares on a layer of top until every density window reaches the target or runs out of
+// free sites. Squares are placed on a regular grid inside the density extent and keep their distance to existing
+// shapes. The squares are collected in a new structure that is referenced at the origin of top and returned.
+func (l *Library) Fill(top string, opts FillOptions) (*Structure, error) {
+	topStructure, ok := l.Structures[top]
+	if !ok {
+		return nil, fmt.Errorf("cell with name %s does not exist", top)
+	}
+	if opts.Size <= 0 || opts.Spacing < 0 || opts.KeepOut < 0 {
+		return nil, fmt.Errorf("fill needs a positive size and no negative spacing or keep out, got %d, %d and %d", opts.Size, opts.Spacing, opts.KeepOut)
+	}
+	if opts.Target <= 0 || opts.Target > 1 {
+		return nil, fmt.Errorf("fill target density must be between 0 and 1, got %g", opts.Target)
+	}
+	if opts.Name == "" {
+		opts.Name = top + "_FILL"
+	}
+	unitName := opts.Name + "_UNIT"
+	for _, name := range []string{opts.Name, unitName} {
+		if _, ok := l.Structures[name]; ok && (name == opts.Name || opts.UseCell) {
+			return nil, fmt.Errorf("cell with name %s already exists", name)
+		}
+	}
+	density, err := l.Density(top, opts.Layer.String(), opts.Density)
+	if err != nil {
+		return nil, fmt.Errorf("could not fill cell %s: %v", top, err)
+	}
+	layers, err := l.FlattenPolygons(top)
+	if err != nil {
+		return nil, fmt.Errorf("could not fill cell %s: %v", top, err)
+	}
+	obstacles := layers[opts.Layer.String()]
+	for _, blockage := range opts.Blockages {
+		obstacles = append(obstacles, layers[blockage.String()]...)
+	}
+	pitch := opts.Size + opts.Spacing
+	index := newPolygonIndex(obstacles, max(pitch, opts.Density.Window/4))
+
+	rows, columns := len(density.Windows), len(density.Windows[0])
+	covered := make([]float64, rows*columns)
+	for row := range rows {
+		for column, window := range density.Windows[row] {
+			covered[row*columns+column] = window.Density * windowArea(window)
+		}
+	}
+	rowStarts, columnStarts := make([]int32, rows), make([]int32, columns)
+	for row := range rows {
+		rowStarts[row] = density.Windows[row][0].Y0
+	}
+	for column := range columns {
+		columnStarts[column] = density.Windows[0][column].X0
+	}
+	extent := []int32{density.Windows[0][0].X0, density.Windows[0][0].Y0, density.Windows[rows-1][columns-1].X1, density.Windows[rows-1][columns-1].Y1}
+
+	// free sites are checked once, sites are placed at most once even if their windows overlap
+	free := map[[2]int32]bool{}
+	isFree := func(x, y int32) bool {
+		site := [2]int32{x, y}
+		if result, ok := free[site]; ok {
+			return result
+		}
+		box := []int32{x - opts.KeepOut, y - opts.KeepOut, x + opts.Size + opts.KeepOut, y + opts.Size + opts.KeepOut}
+		nearby := index.query(box)
+		result := len(nearby) == 0 || coveredArea(nearby, DensityWindow{X0: box[0], Y0: box[1], X1: box[2], Y1: box[3]}) == 0
+		free[site] = result
+		return result
+	}
+	placed := [][2]int32{}
+	for row := range rows {
+		for column := range columns {
+			window := density.Windows[row][column]
+			target := opts.Target * windowArea(window)
+			// first site of the global grid inside the window
+			x0 := extent[0] + (window.X0-extent[0]+pitch-1)/pitch*pitch
+			y0 := extent[1] + (window.Y0-extent[1]+pitch-1)/pitch*pitch
+			for y := y0; y+opts.Size <= window.Y1 && covered[row*columns+column] < target; y += pitch {
+				for x := x0; x+opts.Size <= window.X1 && covered[row*columns+column] < target; x += pitch {
+					if !isFree(x, y) {
+						continue
+					}
+					free[[2]int32{x, y}] = false
+					placed = append(placed, [2]int32{x, y})
+					// the square adds to every window that contains it
+					firstColumn, lastColumn := overlappingWindows(columnStarts, extent[2], opts.Density.Window, x, x+opts.Size)
+					firstRow, lastRow := overlappingWindows(rowStarts, extent[3], opts.Density.Window, y, y+opts.Size)
+					for r := firstRow; r < lastRow; r++ {
+						for c := firstColumn; c < lastColumn; c++ {
+							other := density.Windows[r][c]
+							width := min(x+opts.Size, other.X1) - max(x, other.X0)
+							height := min(y+opts.Size, other.Y1) - max(y, other.Y0)
+							covered[r*columns+c] += float64(width) * float64(height)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	fill, err := l.NewCell(opts.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.UseCell {
+		for _, site := range placed {
+			fill.AddRect(opts.Layer, site[0], site[1], site[0]+opts.Size, site[1]+opts.Size)
+		}
+	} else {
+		unit, err := l.NewCell(unitName)
+		if err != nil {
+			return nil, err
+		}
+		unit.AddRect(opts.Layer, 0, 0, opts.Size, opts.Size)
+		for _, run := range fillRuns(placed, pitch) {
+			if run.count == 1 {
+				fill.AddInstance(unitName, run.x, run.y)
+				continue
+			}
+			fill.AddArray(unitName, run.x, run.y, int16(run.count), 1, pitch, pitch)
+		}
+	}
+	topStructure.AddInstance(opts.Name, 0, 0)
+	return fill, nil
+}
+
+type fillRun struct {
+	x, y  int32
+	count int
+}
+
+// Groups sites into horizontal runs of neighbors, runs are limited to the column count of an array
+func fillRuns(sites [][2]int32, pitch int32) []fillRun {
+	sorted := slices.Clone(sites)
+	slices.SortFunc(sorted, func(a, b [2]int32) int {
+		if a[1] != b[1] {
+			return cmp.Compare(a[1], b[1])
+		}
+		return cmp.Compare(a[0], b[0])
+	})
+	runs := []fillRun{}
+	for _, site := range sorted {
+		if n := len(runs); n > 0 {
+			last := &runs[n-1]
+			if last.y == site[1] && last.x+int32(last.count)*pitch == site[0] && last.count < 32767 {
+				last.count++
+				continue
+			}
+		}
+		runs = append(runs, fillRun{x: site[0], y: site[1], count: 1})
+	}
+	return runs
+}
@@ -0,0 +1,94 @@
+package gds
+
+import (
+	"testing"
+)
+
+func fillLibrary(t *testing.T) *Library {
+	library := NewLibrary("FILL", 1e-6, 1e-9)
+	top, err := library.NewCell("TOP")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	top.AddRect(LayerSpec{1, 0}, 0, 0, 400, 100)
+	top.AddRect(LayerSpec{10, 0}, 0, 0, 400, 400)
+	top.AddRect(LayerSpec{5, 0}, 200, 200, 400, 400) // fill blockage
+	return library
+}
+
+func TestFill(t *testing.T) {
+	library := fillLibrary(t)
+	opts := FillOptions{
+		Layer:     LayerSpec{1, 0},
+		Size:      20,
+		Spacing:   10,
+		KeepOut:   20,
+		Blockages: []LayerSpec{{5, 0}},
+		Density:   DensityOptions{Window: 200},
+		Target:    0.3,
+	}
+	fill, err := library.Fill("TOP", opts)
+	if err != nil {
+		t.Fatalf("could not fill: %v", err)
+	}
+	assertEqual(t, "TOP_FILL", fill.StrName)
+	ref := library.Structures["TOP"].Elements[3].(*SRef)
+	assertEqual(t, "TOP_FILL", ref.Sname)
+
+	density, err := library.Density("TOP", "1/0", opts.Density)
+	if err != nil {
+		t.Fatalf("could not compute density: %v", err)
+	}
+	// the lower windows are half covered, the upper right window is blocked
+	assertEqual(t, 0.5, density.Windows[0][0].Density)
+	if density.Windows[1][0].Density < opts.Target {
+		t.Fatalf("upper left window was not filled to the target, got %v", density.Windows[1][0])
+	}
+	assertEqual(t, 0.0, density.Windows[1][1].Density)
+	layers, err := library.FlattenPolygons("TOP")
+	if err != nil {
+		t.Fatalf("could not flatten: %v", err)
+	}
+	for _, polygon := range layers["1/0"][1:] {
+		box := BoundingBox([][]int32{polygon})
+		if box[1] < 100+opts.KeepOut || (box[2]+opts.KeepOut > 200 && box[3]+opts.KeepOut > 200) {
+			t.Fatalf("fill square %v violates keep out", box)
+		}
+	}
+
+	_, err = library.Fill("TOP", opts)
+	if err == nil {
+		t.Fatalf("could fill twice into the same cell")
+	}
+}
+
+func TestFillUseCell(t *testing.T) {
+	library := fillLibrary(t)
+	fill, err := library.Fill("TOP", FillOptions{
+		Layer:   LayerSpec{1, 0},
+		Size:    20,
+		Spacing: 20,
+		Density: DensityOptions{Window: 400},
+		Target:  0.4,
+		Name:    "DUMMY",
+		UseCell: true,
+	})
+	if err != nil {
+		t.Fatalf("could not fill: %v", err)
+	}
+	assertEqual(t, 1, len(library.Structures["DUMMY_UNIT"].Elements))
+	metrics, err := library.LayerMetrics("TOP")
+	if err != nil {
+		t.Fatalf("could not compute metrics: %v", err)
+	}
+	if metrics["1/0"].Area < 0.4*400*400 {
+		t.Fatalf("fill did not reach the target, got %v", metrics["1/0"])
+	}
+	for _, element := range fill.Elements {
+		if ref, ok := element.(*ARef); ok {
+			assertEqual(t, int16(1), ref.Colrow[1])
+			continue
+		}
+		assertEqual(t, "DUMMY_UNIT", element.(*SRef).Sname)
+	}
+}
@@ -0,0 +1,347 @@
+package gds
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Checks all boundaries and paths against the point limit. Oversized elements are either reported as error
+// or, if fracture is set, replaced by several smaller elements in a copy of the affected structure.
+func (l Library) limitPoints(maxPoints int, fracture bool) (Library, error) {
+	if maxPoints <= 0 {
+		maxPoints = MaxXYPoints
+	}
+	if maxPoints > MaxXYPoints {
+		return l, fmt.Errorf("point limit %d exceeds the maximum of %d points per XY record", maxPoints, MaxXYPoints)
+	}
+	if maxPoints < 5 {
+		return l, fmt.Errorf("point limit %d is too small, boundaries need at least 5 points", maxPoints)
+	}
+	structures := map[string]*Structure{}
+	for name, structure := range l.Structures {
+		structures[name] = structure
+		elements := []Element{}
+		changed := false
+		for i, element := range structure.Elements {
+			xy, _ := element.GetData().([]int32)
+			if len(xy)/2 <= maxPoints {
+				elements = append(elements, element)
+				continue
+			}
+			switch e := asPointer(element).(type) {
+			case *Boundary:
+				if !fracture {
+					return l, fmt.Errorf("boundary %d of structure %s has %d points, limit is %d", i, name, len(xy)/2, maxPoints)
+				}
+				pieces, err := FractureBoundary(e, maxPoints)
+				if err != nil {
+					return l, fmt.Errorf("could not fracture boundary %d of structure %s: %v", i, name, err)
+				}
+				for _, piece := range pieces {
+					elements = append(elements, piece)
+				}
+				changed = true
+			case *Path:
+				if !fracture {
+					return l, fmt.Errorf("path %d of structure %s has %d points, limit is %d", i, name, len(xy)/2, maxPoints)
+				}
+				pieces, joints := SplitPath(e, maxPoints)
+				for _, piece := range pieces {
+					elements = append(elements, piece)
+				}
+				for _, joint := range joints {
+					elements = append(elements, joint)
+				}
+				changed = true
+			default:
+				elements = append(elements, element)
+			}
+		}
+		if changed {
+			limited := *structure
+			limited.Elements = elements
+			structures[name] = &limited
+		}
+	}
+	l.Structures = structures
+	return l, nil
+}
+
+// FractureBoundary splits a boundary into several boundaries with at most maxPoints points each (including
+// the closing point). The polygon is cut recursively by horizontal or vertical lines through the median vertex.
+// Each cut point is computed once and shared by the pieces on both sides of the cut, so pieces meet without gaps.
+// Fracturing is not exact for non-Manhattan polygons: cut points on sloped edges are rounded to the database grid,
+// which moves the sloped edges of the pieces by up to half a database unit against the original edge.
+func FractureBoundary(boundary *Boundary, maxPoints int) ([]*Boundary, error) {
+	if maxPoints < 5 {
+		return nil, fmt.Errorf("point limit %d is too small, boundaries need at least 5 points", maxPoints)
+	}
+	ring := openRing(boundary.XY)
+	if len(ring) < 6 {
+		return nil, fmt.Errorf("boundary needs at least 3 points, got %d", len(ring)/2)
+	}
+	rings, err := fractureRing(ring, maxPoints-1, 0)
+	if err != nil {
+		return nil, err
+	}
+	pieces := make([]*Boundary, 0, len(rings))
+	for _, piece := range rings {
+		fractured := *boundary
+		fractured.XY = append(piece, piece[0], piece[1])
+		fractured.source = nil
+		pieces = append(pieces, &fractured)
+	}
+	return pieces, nil
+}
+
+// Removes the closing point of a polygon if present
+func openRing(xy []int32) []int32 {
+	n := len(xy) - len(xy)%2
+	if n >= 4 && xy[0] == xy[n-2] && xy[1] == xy[n-1] {
+		n -= 2
+	}
+	return append([]int32{}, xy[:n]...)
+}
+
+func fractureRing(ring []int32, maxVertices int, depth int) ([][]int32, error) {
+	if len(ring)/2 <= maxVertices {
+		return [][]int32{ring}, nil
+	}
+	if depth > 64 {
+		return nil, fmt.Errorf("could not reduce polygon below %d points", maxVertices)
+	}
+	xmin, ymin, xmax, ymax := bounds(ring)
+	axes := []int{0, 1}
+	if ymax-ymin > xmax-xmin {
+		axes = []int{1, 0}
+	}
+	for _, axis := range axes {
+		cut, ok := cutCoordinate(ring, axis)
+		if !ok {
+			continue
+		}
+		pieces := splitRing(ring, axis, cut)
+		if len(pieces) < 2 {
+			continue
+		}
+		result := [][]int32{}
+		for _, piece := range pieces {
+			fractured, err := fractureRing(piece, maxVertices, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, fractured...)
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("could not find a cut line for polygon with %d points", len(ring)/2)
+}
+
+func bounds(xy []int32) (xmin, ymin, xmax, ymax int32) {
+	xmin, ymin = math.MaxInt32, math.MaxInt32
+	xmax, ymax = math.MinInt32, math.MinInt32
+	for i := 0; i+1 < len(xy); i += 2 {
+		xmin, xmax = min(xmin, xy[i]), max(xmax, xy[i])
+		ymin, ymax = min(ymin, xy[i+1]), max(ymax, xy[i+1])
+	}
+	return xmin, ymin, xmax, ymax
+}
+
+// Finds an integer coordinate close to the median vertex that is not used by any vertex on the given axis
+func cutCoordinate(ring []int32, axis int) (int32, bool) {
+	values := make([]int32, 0, len(ring)/2)
+	used := map[int32]bool{}
+	for i := axis; i < len(ring); i += 2 {
+		values = append(values, ring[i])
+		used[ring[i]] = true
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	lo, hi := values[0], values[len(values)-1]
+	median := values[len(values)/2]
+	for offset := int64(0); offset <= int64(hi)-int64(lo); offset++ {
+		for _, candidate := range []int64{int64(median) - offset, int64(median) + offset} {
+			if candidate > int64(lo) && candidate < int64(hi) && !used[int32(candidate)] {
+				return int32(candidate), true
+			}
+		}
+	}
+	return 0, false
+}
+
+type splitNode struct {
+	x, y     int32
+	crossing int // index into sorted crossings or -1
+}
+
+// Splits a simple polygon without vertices on the cut line into the pieces on both sides of the line.
+// Crossing points are sorted along the line and paired, the pieces are traced by jumping between pairs.
+func splitRing(ring []int32, axis int, cut int32) [][]int32 {
+	n := len(ring) / 2
+	nodes := []splitNode{}
+	crossings := []int{}
+	for i := range n {
+		j := (i + 1) % n
+		x0, y0, x1, y1 := ring[2*i], ring[2*i+1], ring[2*j], ring[2*j+1]
+		nodes = append(nodes, splitNode{x: x0, y: y0, crossing: -1})
+		a0, a1 := x0, x1
+		if axis == 1 {
+			a0, a1 = y0, y1
+		}
+		// the rounded crossing is a single node traced into the pieces on both sides of the cut
+		if (a0 < cut) != (a1 < cut) {
+			t := float64(cut-a0) / float64(a1-a0)
+			node := splitNode{x: cut, y: cut, crossing: 0}
+			if axis == 0 {
+				node.y = int32(math.Round(float64(y0) + t*float64(y1-y0)))
+			} else {
+				node.x = int32(math.Round(float64(x0) + t*float64(x1-x0)))
+			}
+			crossings = append(crossings, len(nodes))
+			nodes = append(nodes, node)
+		}
+	}
+	if len(crossings) < 2 {
+		return [][]int32{ring}
+	}
+	along := func(node splitNode) int32 {
+		if axis == 0 {
+			return node.y
+		}
+		return node.x
+	}
+	sort.SliceStable(crossings, func(i, j int) bool { return along(nodes[crossings[i]]) < along(nodes[crossings[j]]) })
+	for i, index := range crossings {
+		nodes[index].crossing = i
+	}
+
+	visited := make([]bool, len(nodes))
+	pieces := [][]int32{}
+	for start := range nodes {
+		if visited[start] || nodes[start].crossing >= 0 {
+			continue
+		}
+		piece := []int32{}
+		current := start
+		for steps := 0; steps <= 2*len(nodes); steps++ {
+			if visited[current] && current == start && len(piece) > 0 {
+				break
+			}
+			visited[current] = true
+			node := nodes[current]
+			piece = append(piece, node.x, node.y)
+			if node.crossing >= 0 {
+				partner := crossings[node.crossing^1]
+				piece = append(piece, nodes[partner].x, nodes[partner].y)
+				current = partner
+			}
+			current = (current + 1) % len(nodes)
+		}
+		pieces = append(pieces, removeDuplicatePoints(piece))
+	}
+	return pieces
+}
+
+// Removes consecutive duplicate points of an open ring
+func removeDuplicatePoints(ring []int32) []int32 {
+	result := []int32{}
+	n := len(ring) / 2
+	for i := range n {
+		j := (i + n - 1) % n
+		if ring[2*i] == ring[2*j] && ring[2*i+1] == ring[2*j+1] {
+			continue
+		}
+		result = append(result, ring[2*i], ring[2*i+1])
+	}
+	return result
+}
+
+// SplitPath splits a path into several paths with at most maxPoints points each, consecutive paths share
+// the vertex at which they were split. Pieces end flush at the split vertices and round paths keep their
+// round ends. Where a miter join leaves a gap between two flush ends, the joint is covered by a boundary
+// on the layer of the path. The outer corners of the joint are rounded to the database grid.
+func SplitPath(path *Path, maxPoints int) ([]*Path, []*Boundary) {
+	maxPoints = max(maxPoints, 2)
+	n := len(path.XY) / 2
+	if n <= maxPoints {
+		return []*Path{path}, nil
+	}
+	halfWidth := path.width() / 2
+	if halfWidth < 0 {
+		halfWidth = -halfWidth
+	}
+	bgnextn, endextn := int32(0), int32(0)
+	switch path.pathtype() {
+	case 2:
+		bgnextn, endextn = halfWidth, halfWidth
+	case 4:
+		bgnextn, endextn = path.Bgnextn, path.Endextn
+	}
+	pieces := []*Path{}
+	joints := []*Boundary{}
+	for start := 0; start < n-1; start += maxPoints - 1 {
+		end := min(start+maxPoints, n)
+		piece := *path
+		piece.XY = append([]int32{}, path.XY[2*start:2*end]...)
+		piece.source = nil
+		if path.pathtype() == 2 || path.pathtype() == 4 {
+			piece.Pathtype = 4
+			piece.Bgnextn, piece.Endextn = 0, 0
+			if start == 0 {
+				piece.Bgnextn = bgnextn
+			}
+			if end == n {
+				piece.Endextn = endextn
+			}
+		}
+		pieces = append(pieces, &piece)
+		if end == n || path.pathtype() == 1 {
+			continue
+		}
+		joint := miterJoint(path.XY, end-1, math.Abs(float64(path.width()))/2)
+		if joint != nil {
+			joints = append(joints, &Boundary{ElFlags: path.ElFlags, Plex: path.Plex, Layer: path.Layer, Datatype: path.Datatype, XY: joint})
+		}
+	}
+	return pieces, joints
+}
+
+// Returns the part of the miter join at vertex k that lies outside the flush ends of both adjacent segments:
+// the vertex, the outer corners of both ends and the miter point. Straight joints and reversals have no gap
+// and return nil.
+func miterJoint(xy []int32, k int, halfWidth float64) []int32 {
+	n := len(xy) / 2
+	same := func(i int) bool { return xy[2*i] == xy[2*k] && xy[2*i+1] == xy[2*k+1] }
+	i := k - 1
+	for i >= 0 && same(i) {
+		i--
+	}
+	j := k + 1
+	for j < n && same(j) {
+		j++
+	}
+	if i < 0 || j >= n || halfWidth == 0 {
+		return nil
+	}
+	x, y := float64(xy[2*k]), float64(xy[2*k+1])
+	ax, ay := x-float64(xy[2*i]), y-float64(xy[2*i+1])
+	length := math.Hypot(ax, ay)
+	ax, ay = ax/length, ay/length
+	bx, by := float64(xy[2*j])-x, float64(xy[2*j+1])-y
+	length = math.Hypot(bx, by)
+	bx, by = bx/length, by/length
+	cross, dot := ax*by-ay*bx, ax*bx+ay*by
+	if math.Abs(cross) < 1e-9 {
+		return nil
+	}
+	// offset along the left normal, the outer side is on the right for left turns
+	side := -math.Copysign(halfWidth, cross)
+	round := func(v float64) int32 { return int32(math.Round(v)) }
+	return []int32{
+		xy[2*k], xy[2*k+1],
+		round(x - ay*side), round(y + ax*side),
+		round(x - (ay+by)*side/(1+dot)), round(y + (ax+bx)*side/(1+dot)),
+		round(x - by*side), round(y + bx*side),
+		xy[2*k], xy[2*k+1],
+	}
+}
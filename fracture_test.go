@@ -0,0 +1,164 @@
+package gds
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// Comb shaped polygon with teeth pointing up, has 4*teeth+2 distinct points
+func combPolygon(teeth int) []int32 {
+	xy := []int32{0, 0, int32(teeth) * 200, 0}
+	for i := teeth - 1; i >= 0; i-- {
+		x := int32(i * 200)
+		xy = append(xy, x+200, 1000, x+100, 1000, x+100, 100, x, 100)
+	}
+	return append(xy, 0, 0)
+}
+
+func absArea(xy []int32) float64 {
+	return math.Abs(float64(signedArea(xy))) / 2
+}
+
+func TestFractureBoundary(t *testing.T) {
+	boundary := &Boundary{Layer: 1, Datatype: 0, XY: combPolygon(50)}
+	pieces, err := FractureBoundary(boundary, 20)
+	if err != nil {
+		t.Fatalf("could not fracture boundary: %v", err)
+	}
+	if len(pieces) < 2 {
+		t.Fatalf("expected several pieces, got %d", len(pieces))
+	}
+	area := 0.0
+	for _, piece := range pieces {
+		n := len(piece.XY)
+		if n/2 > 20 {
+			t.Fatalf("piece has %d points", n/2)
+		}
+		if piece.XY[0] != piece.XY[n-2] || piece.XY[1] != piece.XY[n-1] {
+			t.Fatalf("piece is not closed: %v", piece.XY)
+		}
+		if piece.Layer != 1 {
+			t.Fatalf("piece lost its layer: %v", piece)
+		}
+		area += absArea(piece.XY)
+	}
+	assertEqual(t, absArea(boundary.XY), area)
+}
+
+func TestFractureBoundarySloped(t *testing.T) {
+	// saw teeth with sloped flanks, cuts cross the flanks off grid
+	xy := []int32{0, 0}
+	for i := range int32(20) {
+		xy = append(xy, 300*i+100, 1000, 300*i+300, 7)
+	}
+	xy = append(xy, 6000, -500, 0, -500, 0, 0)
+	boundary := &Boundary{Layer: 1, Datatype: 0, XY: xy}
+	pieces, err := FractureBoundary(boundary, 10)
+	if err != nil {
+		t.Fatalf("could not fracture boundary: %v", err)
+	}
+	original := map[[2]int32]bool{}
+	for i := 0; i < len(xy); i += 2 {
+		original[[2]int32{xy[i], xy[i+1]}] = true
+	}
+	if len(pieces) < 3 {
+		t.Fatalf("expected several pieces, got %d", len(pieces))
+	}
+	// cut points are shared by the pieces on both sides of the cut
+	count := map[[2]int32]int{}
+	for _, piece := range pieces {
+		for i := 0; i+2 < len(piece.XY); i += 2 {
+			count[[2]int32{piece.XY[i], piece.XY[i+1]}]++
+		}
+	}
+	for point, n := range count {
+		if !original[point] && n < 2 {
+			t.Fatalf("cut point %v is used by a single piece", point)
+		}
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	xy := []int32{}
+	for i := range 25 {
+		xy = append(xy, int32(i*100), int32(i%2*100))
+	}
+	path := &Path{Layer: 1, Datatype: 0, Pathtype: 0, Width: 20, XY: xy}
+	pieces, joints := SplitPath(path, 10)
+	assertEqual(t, 3, len(pieces))
+	assertEqual(t, int16(0), pieces[0].Pathtype)
+	assertEqual(t, 2, len(joints))
+	assertEqual(t, "[900 100 893 107 900 114 907 107 900 100]", fmt.Sprint(joints[0].XY))
+	for i := 1; i < len(pieces); i++ {
+		previous := pieces[i-1].XY
+		if previous[len(previous)-2] != pieces[i].XY[0] || previous[len(previous)-1] != pieces[i].XY[1] {
+			t.Fatalf("piece %d does not start at the end of the previous piece", i)
+		}
+	}
+	assertEqual(t, 25*2+2*2, len(pieces[0].XY)+len(pieces[1].XY)+len(pieces[2].XY))
+}
+
+func TestSplitPathJoints(t *testing.T) {
+	for _, xy := range [][]int32{
+		{0, 0, 4000, 0, 8000, 4000}, // 45 degree joint
+		{0, 0, 4000, 0, 800, 1600},  // acute joint
+	} {
+		for _, pathtype := range []int16{0, 2, 4} {
+			path := &Path{Layer: 1, Datatype: 0, Pathtype: pathtype, Width: 1000, Bgnextn: 300, Endextn: 700, XY: xy}
+			pieces, joints := SplitPath(path, 2)
+			polygons := [][]int32{}
+			for _, piece := range pieces {
+				polygons = append(polygons, PathOutline(piece))
+			}
+			for _, joint := range joints {
+				polygons = append(polygons, joint.XY)
+			}
+			outline := PathOutline(path)
+			window := DensityWindow{X0: -10000, Y0: -10000, X1: 10000, Y1: 10000}
+			expected := coveredArea([][]int32{outline}, window)
+			area := coveredArea(polygons, window)
+			// outlines of sloped sides are rounded to the grid, which moves them by up to half a database unit
+			if math.Abs(area-expected) > PolygonPerimeter(outline)/2 {
+				t.Fatalf("pieces of pathtype %d path %v cover %v instead of %v", pathtype, xy, area, expected)
+			}
+		}
+	}
+}
+
+func TestWriteMaxPoints(t *testing.T) {
+	library := NewLibrary("LIB", 1e-6, 1e-9)
+	cell, err := library.NewCell("big")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	_, err = cell.AddPolygon(LayerSpec{1, 0}, combPolygon(100))
+	if err != nil {
+		t.Fatalf("could not add polygon: %v", err)
+	}
+	var written bytes.Buffer
+	err = WriteGDSWithOptions(&written, library, WriteOptions{MaxPoints: 200})
+	if err == nil {
+		t.Fatalf("could write polygon exceeding the point limit")
+	}
+	written.Reset()
+	err = WriteGDSWithOptions(&written, library, WriteOptions{MaxPoints: 200, Fracture: true})
+	if err != nil {
+		t.Fatalf("could not write fractured polygon: %v", err)
+	}
+	libraryNew, err := ReadGDS(&written)
+	if err != nil {
+		t.Fatalf("could not read fractured library: %v", err)
+	}
+	if len(libraryNew.Structures["big"].Elements) < 3 {
+		t.Fatalf("expected fractured polygon, got %d elements", len(libraryNew.Structures["big"].Elements))
+	}
+	assertEqual(t, 1, len(cell.Elements))
+
+	cell.Elements[0].(*Boundary).XY = make([]int32, 2*(MaxXYPoints+10))
+	err = WriteGDS(&written, library)
+	if err == nil {
+		t.Fatalf("could write boundary exceeding the XY record size")
+	}
+}
@@ -2,31 +2,51 @@ package gds
 
 import (
 	"bufio"
+	"encoding/binary"
 	"fmt"
-	"os"
+	"io"
+	"time"
 )
 
 // https://www.artwork.com/gdsii/gdsii/index.htm
 // https://boolean.klaasholwerda.nl/interface/bnf/gdsformat.html
 // http://bitsavers.informatik.uni-stuttgart.de/pdf/calma/GDS_II_Stream_Format_Manual_6.0_Feb87.pdf
 
-func ReadGDS(f *os.File) (*Library, error) {
+func ReadGDS(f io.Reader) (*Library, error) {
 	var err error
 
-	reader := bufio.NewReader(f)
-	library, err := decodeLibrary(reader)
+	library, err := decodeLibrary(newDecoder(f))
 	if err != nil {
 		return nil, err
 	}
 	return library, nil
 }
 
-func ReadRecords(f *os.File) ([]Record, error) {
+// DecodeOptions controls how ReadGDSWithOptions decodes a stream
+type DecodeOptions struct {
+	// Keeps records of unknown type, with malformed data or at unexpected positions as opaque records
+	// of the enclosing element, structure or library and reports them as warnings instead of failing.
+	// Truncated streams are still reported as error.
+	Lenient bool
+}
+
+// ReadGDSWithOptions reads a library like ReadGDS and returns the records skipped in lenient mode as warnings
+func ReadGDSWithOptions(f io.Reader, opts DecodeOptions) (*Library, []*DecodeError, error) {
+	d := newDecoder(f)
+	d.options = opts
+	library, err := decodeLibrary(d)
+	if err != nil {
+		return nil, d.warnings, err
+	}
+	return library, d.warnings, nil
+}
+
+func ReadRecords(f io.Reader) ([]Record, error) {
 	records := []Record{}
-	reader := bufio.NewReader(f)
+	d := newDecoder(f)
 OuterLoop:
 	for {
-		record, err := decodeRecord(reader)
+		record, err := decodeRecord(d)
 		if err != nil {
 			return nil, err
 		}
@@ -38,19 +58,49 @@ OuterLoop:
 	return records, nil
 }
 
-func WriteGDS(f *os.File, lib *Library) error {
-	writer := bufio.NewWriter(f)
-	records, err := lib.Records()
+// WriteOptions controls how WriteGDSWithOptions serializes a library
+type WriteOptions struct {
+	// Order in which structures are written, defaults to OrderInput
+	Order StructureOrder
+	// Replaces all BGNLIB and BGNSTR timestamps if set, use time.Now() or a fixed time for reproducible output
+	Timestamp time.Time
+	// Maximum number of points of boundaries and paths, defaults to MaxXYPoints. Legacy tools may require 200 or 600.
+	MaxPoints int
+	// Splits boundaries and paths exceeding MaxPoints into several elements instead of returning an error
+	Fracture bool
+}
+
+func WriteGDS(f io.Writer, lib *Library) error {
+	return WriteGDSWithOptions(f, lib, WriteOptions{})
+}
+
+func WriteGDSWithOptions(f io.Writer, lib *Library, opts WriteOptions) error {
+	records, err := lib.RecordsWithOptions(opts)
 	if err != nil {
 		return fmt.Errorf("could not write GDSII file: %v", err)
 	}
+	return WriteRecords(f, records)
+}
+
+// WriteRecords writes records as binary stream without checking their order
+func WriteRecords(f io.Writer, records []Record) error {
+	writer := bufio.NewWriter(f)
+	header := make([]byte, HEADERSIZE)
 	for _, record := range records {
-		_, err := writer.Write(record.Bytes())
+		binary.BigEndian.PutUint16(header, record.Size)
+		copy(header[2:], recordTypeBytes(record.Datatype))
+		_, err := writer.Write(header)
+		if err == nil {
+			_, err = writer.Write(record.Data)
+		}
 		if err != nil {
 			return fmt.Errorf("could not write record %v to file: %v", record, err)
 		}
 	}
-	writer.Flush()
+	err := writer.Flush()
+	if err != nil {
+		return fmt.Errorf("could not write GDSII file: %v", err)
+	}
 	return nil
 }
 
@@ -103,6 +153,7 @@ func (l Library) GetCellData(cell string) (*CellData, error) {
 			resolveARef(&l, data, element.(*ARef))
 		}
 	}
+	data.Layers = data.collectLayers()
 	return data, nil
 }
 
@@ -1,11 +1,11 @@
 package gds
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"testing"
-
-	svg "github.com/ajstarks/svgo"
 )
 
 const testFile = "klayout_test.gds"
@@ -110,44 +110,15 @@ func TestDrawPolygons(t *testing.T) {
 		t.Fatalf("could not parse gds file: %v", err)
 	}
 
-	layermapPolygons, err := library.GetLayermapPolygons("top")
-	if err != nil {
-		t.Fatalf("could not get layermap polygons: %v", err)
-	}
-
 	fhSVG, err := os.Create("test.svg")
 	if err != nil {
 		t.Fatalf("could not generate svg")
 	}
-	colormap := []string{"black", "blue", "red", "yellow", "cyan", "magenta", "purple", "green", "orange"}
-	width := 25000
-	height := 25000
-	canvas := svg.New(fhSVG)
-	canvas.Start(width, height)
-	j := 0
-	for _, v := range layermapPolygons {
-		for _, poly := range v.Polygons {
-			var x, y []int
-			for i := 0; i < len(poly); i += 2 {
-				x = append(x, int(poly[i]))
-				y = append(y, int(poly[i+1]))
-			}
-			canvas.Polygon(x, y, fmt.Sprintf("stroke-width:0.1%%;fill:none;stroke:%s", colormap[j]))
-		}
-		j++
-	}
-
-	layermapLabels, err := library.GetLayermapLabels("top")
+	defer fhSVG.Close()
+	err = WriteSVG(fhSVG, library, "top", SVGOptions{Background: "black"})
 	if err != nil {
-		t.Fatalf("could not get layermap polygons: %v", err)
-	}
-	for _, v := range layermapLabels {
-		for i := range len(v.Labels) {
-			canvas.Text(int(v.LabelCoords[i][0]), int(v.LabelCoords[i][1]), v.Labels[i], "dominant-baseline:middle;text-anchor:middle;font-size:100px;fill:white")
-		}
+		t.Fatalf("could not draw cell: %v", err)
 	}
-
-	canvas.End()
 }
 
 func TestReadRecords(t *testing.T) {
@@ -192,3 +163,167 @@ func TestWriteGDS(t *testing.T) {
 		t.Fatalf("could not delete gds_test file")
 	}
 }
+
+func TestCellDataLayers(t *testing.T) {
+	fh, err := os.Open(testFile)
+	if err != nil {
+		t.Fatalf("could not open test gds file: %v", err)
+	}
+	defer fh.Close()
+
+	library, err := ReadGDS(fh)
+	if err != nil {
+		t.Fatalf("could not parse gds file: %v", err)
+	}
+	celldata, err := library.GetCellData("top")
+	if err != nil {
+		t.Fatalf("could not get cell data: %v", err)
+	}
+	expected := []string{"1/0", "2/0", "3/0", "4/0", "5/0", "6/0", "7/0", "8/0", "9/0"}
+	if fmt.Sprint(celldata.Layers) != fmt.Sprint(expected) {
+		t.Fatalf("%v not equal to %v", celldata.Layers, expected)
+	}
+
+	err = celldata.SetLayerEnabled("1/0", false)
+	if err != nil {
+		t.Fatalf("could not disable layer: %v", err)
+	}
+	if celldata.Polygons["1/0"].Enabled || celldata.Paths["1/0"].Enabled || celldata.Labels["1/0"].Enabled {
+		t.Fatalf("layer 1/0 still enabled")
+	}
+	if len(celldata.EnabledLayers()) != len(expected)-1 {
+		t.Fatalf("expected %d enabled layers, got %v", len(expected)-1, celldata.EnabledLayers())
+	}
+	enabled, err := celldata.ToggleLayer("1/0")
+	if err != nil || !enabled {
+		t.Fatalf("could not toggle layer 1/0: %v", err)
+	}
+	err = celldata.SetLayerEnabled("99/0", false)
+	if err == nil {
+		t.Fatalf("could disable non-existing layer")
+	}
+}
+
+func TestWriteOrder(t *testing.T) {
+	fh, err := os.Open(testFile)
+	if err != nil {
+		t.Fatalf("could not open test gds file: %v", err)
+	}
+	defer fh.Close()
+
+	library, err := ReadGDS(fh)
+	if err != nil {
+		t.Fatalf("could not parse gds file: %v", err)
+	}
+	for _, order := range []StructureOrder{OrderInput, OrderAlphabetical, OrderBottomUp} {
+		first, err := library.RecordsWithOptions(WriteOptions{Order: order})
+		if err != nil {
+			t.Fatalf("could not produce records in %v order: %v", order, err)
+		}
+		second, err := library.RecordsWithOptions(WriteOptions{Order: order})
+		if err != nil {
+			t.Fatalf("could not produce records in %v order: %v", order, err)
+		}
+		assertEqualByteSlice(t, recordsToBytes(first), recordsToBytes(second))
+	}
+
+	names, err := library.StructureNames(OrderInput)
+	if err != nil {
+		t.Fatalf("could not get structure names: %v", err)
+	}
+	if fmt.Sprint(names) != fmt.Sprint(library.StructureOrder) {
+		t.Fatalf("%v not equal to %v", names, library.StructureOrder)
+	}
+
+	names, err = library.StructureNames(OrderBottomUp)
+	if err != nil {
+		t.Fatalf("could not get structure names: %v", err)
+	}
+	position := map[string]int{}
+	for i, name := range names {
+		position[name] = i
+	}
+	for _, name := range names {
+		for _, element := range library.Structures[name].Elements {
+			if ref, ok := element.(Reference); ok && position[ref.GetSname()] > position[name] {
+				t.Fatalf("structure %s written before its child %s", name, ref.GetSname())
+			}
+		}
+	}
+
+	library.Structures["squares"].Elements = append(library.Structures["squares"].Elements, &SRef{Sname: "top", XY: []int32{0, 0}})
+	_, err = library.StructureNames(OrderBottomUp)
+	if err == nil {
+		t.Fatalf("could sort library with reference cycle")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	original, err := os.ReadFile(testFile)
+	if err != nil {
+		t.Fatalf("could not read test gds file: %v", err)
+	}
+	library, err := ReadGDS(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("could not parse gds file: %v", err)
+	}
+	var written bytes.Buffer
+	err = WriteGDS(&written, library)
+	if err != nil {
+		t.Fatalf("could not write library: %v", err)
+	}
+	if !bytes.Equal(original, written.Bytes()) {
+		originalRecords, _ := ReadRecords(bytes.NewReader(original))
+		writtenRecords, _ := ReadRecords(bytes.NewReader(written.Bytes()))
+		for i := range min(len(originalRecords), len(writtenRecords)) {
+			if originalRecords[i].String() != writtenRecords[i].String() {
+				t.Fatalf("record %d differs: %v != %v", i, originalRecords[i], writtenRecords[i])
+			}
+		}
+		t.Fatalf("written file differs from %s: %d != %d bytes", testFile, written.Len(), len(original))
+	}
+}
+
+func FuzzReadGDS(f *testing.F) {
+	original, err := os.ReadFile(testFile)
+	if err != nil {
+		f.Fatalf("could not read test gds file: %v", err)
+	}
+	f.Add(original)
+	f.Add(original[:len(original)/2])
+	f.Add(recordsToBytes([]Record{{Size: 6, Datatype: "LIBDIRSIZE", Data: []byte{0, 1}}, {Size: 4, Datatype: "ELKEY", Data: []byte{}}}))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		library, err := ReadGDS(bytes.NewReader(data))
+		if err == nil {
+			_ = library.String()
+		}
+		records, err := ReadRecords(bytes.NewReader(data))
+		if err == nil {
+			for _, record := range records {
+				_ = record.String()
+			}
+		}
+		_, _, _ = ReadGDSWithOptions(bytes.NewReader(data), DecodeOptions{Lenient: true})
+	})
+}
+
+func BenchmarkWriteGDS(b *testing.B) {
+	library := NewLibrary("BENCH", 1e-6, 1e-9)
+	cell, _ := library.NewCell("CELL")
+	for i := range int32(10000) {
+		cell.AddRect(LayerSpec{1, 0}, i*10, 0, i*10+5, 5)
+		cell.AddPath(LayerSpec{2, 0}, 2, []int32{i * 10, 10, i*10 + 5, 10, i*10 + 5, 20})
+		cell.AddText(LayerSpec{3, 0}, i*10, 30, "label")
+	}
+	top, _ := library.NewCell("TOP")
+	for i := range int32(1000) {
+		top.AddInstance("CELL", 0, i*100).Angle = 90
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := WriteGDS(io.Discard, library)
+		if err != nil {
+			b.Fatalf("could not write library: %v", err)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package gds
+
+import (
+	"fmt"
+	"math"
+)
+
+// Geometry rules checked by CheckPolygon in addition to the stream format rules of Validate
+const (
+	RuleSelfIntersection ViolationRule = "self-intersection"
+	RuleDuplicatePoint   ViolationRule = "duplicate-point"
+	RuleCollinear        ViolationRule = "collinear"
+	RuleAcuteAngle       ViolationRule = "acute-angle"
+)
+
+// GeometryOptions configures CheckPolygon
+type GeometryOptions struct {
+	// Interior angles below MinAngle (in degrees) are reported as acute, 0 disables the check
+	MinAngle float64
+}
+
+// PolygonIssue describes a geometry problem at a vertex of a polygon. Vertex indexes the points of the
+// polygon without the closing point, it is -1 for issues concerning the whole polygon.
+// X and Y hold the position of the vertex or, for self-intersections, of the intersection.
+type PolygonIssue struct {
+	Rule    ViolationRule
+	Vertex  int
+	X, Y    int32
+	Message string
+}
+
+func (p PolygonIssue) String() string {
+	if p.Vertex < 0 {
+		return fmt.Sprintf("%s: %s", p.Rule, p.Message)
+	}
+	return fmt.Sprintf("vertex %d (%d, %d): %s: %s", p.Vertex, p.X, p.Y, p.Rule, p.Message)
+}
+
+// GeometryViolation is a PolygonIssue of an element in a cell, Element is the index into Structure.Elements
+// or into PolygonLayer.Polygons
+type GeometryViolation struct {
+	Cell    string
+	Element int
+	PolygonIssue
+}
+
+func (g GeometryViolation) String() string {
+	return fmt.Sprintf("%s[%d]: %v", g.Cell, g.Element, g.PolygonIssue)
+}
+
+// CheckGeometry runs CheckPolygon on all boundaries and boxes of the library, structures are checked in input order
+func CheckGeometry(lib *Library, opts GeometryOptions) []GeometryViolation {
+	violations := []GeometryViolation{}
+	names, _ := lib.StructureNames(OrderInput)
+	for _, name := range names {
+		for i, element := range lib.Structures[name].Elements {
+			polygon, ok := element.(Polygon)
+			if !ok {
+				continue
+			}
+			for _, issue := range CheckPolygon(polygon.GetPoints(), opts) {
+				violations = append(violations, GeometryViolation{Cell: name, Element: i, PolygonIssue: issue})
+			}
+		}
+	}
+	return violations
+}
+
+// CheckGeometry runs CheckPolygon on all polygons of the layer, e.g. on flattened output of GetLayermapPolygons
+func (p PolygonLayer) CheckGeometry(opts GeometryOptions) []GeometryViolation {
+	violations := []GeometryViolation{}
+	for i, polygon := range p.Polygons {
+		for _, issue := range CheckPolygon(polygon, opts) {
+			violations = append(violations, GeometryViolation{Element: i, PolygonIssue: issue})
+		}
+	}
+	return violations
+}
+
+// CheckPolygon reports repeated points, collinear points, acute angles, zero area and self-intersections of a
+// polygon given as x0, y0, x1, y1, ..., the closing point is optional
+func CheckPolygon(xy []int32, opts GeometryOptions) []PolygonIssue {
+	issues := []PolygonIssue{}
+	ring := openRing(xy)
+	n := len(ring) / 2
+	report := func(rule ViolationRule, vertex int, format string, args ...any) {
+		issue := PolygonIssue{Rule: rule, Vertex: vertex, Message: fmt.Sprintf(format, args...)}
+		if vertex >= 0 {
+			issue.X, issue.Y = ring[2*vertex], ring[2*vertex+1]
+		}
+		issues = append(issues, issue)
+	}
+	if n < 3 {
+		report(RuleDegenerate, -1, "polygon needs at least 3 points, got %d", n)
+		return issues
+	}
+	for i := range n {
+		j := (i + 1) % n
+		if ring[2*i] == ring[2*j] && ring[2*i+1] == ring[2*j+1] {
+			report(RuleDuplicatePoint, j, "point repeats the previous point")
+		}
+	}
+	area := signedArea(ring)
+	if area == 0 {
+		report(RuleDegenerate, -1, "polygon has zero area")
+	}
+	for i := range n {
+		prev, next, ok := distinctNeighbors(ring, i)
+		if !ok {
+			continue
+		}
+		px, py := int64(ring[2*i]), int64(ring[2*i+1])
+		ax, ay := int64(ring[2*prev])-px, int64(ring[2*prev+1])-py
+		bx, by := int64(ring[2*next])-px, int64(ring[2*next+1])-py
+		cross := ay*bx - ax*by // cross product of incoming and outgoing edge
+		dot := ax*bx + ay*by
+		if cross == 0 {
+			if dot > 0 {
+				report(RuleCollinear, i, "spike, the polygon turns back on itself")
+			} else {
+				report(RuleCollinear, i, "point lies on the line between its neighbors")
+			}
+			continue
+		}
+		if opts.MinAngle <= 0 || area == 0 {
+			continue
+		}
+		angle := math.Atan2(math.Abs(float64(cross)), float64(dot)) * 180 / math.Pi
+		if (cross > 0) != (area > 0) {
+			angle = 360 - angle
+		}
+		if angle < opts.MinAngle {
+			report(RuleAcuteAngle, i, "interior angle %.2f° is below %.2f°", angle, opts.MinAngle)
+		}
+	}
+	for _, crossing := range selfIntersections(ring) {
+		report(RuleSelfIntersection, crossing.edge, "edge starting at vertex %d intersects edge starting at vertex %d at (%d, %d)",
+			crossing.edge, crossing.other, crossing.x, crossing.y)
+		issues[len(issues)-1].X, issues[len(issues)-1].Y = crossing.x, crossing.y
+	}
+	return issues
+}
+
+// Returns the indices of the nearest points before and after vertex i that differ from it
+func distinctNeighbors(ring []int32, i int) (int, int, bool) {
+	n := len(ring) / 2
+	differs := func(j int) bool { return ring[2*j] != ring[2*i] || ring[2*j+1] != ring[2*i+1] }
+	prev, next := -1, -1
+	for k := 1; k < n; k++ {
+		if j := (i - k + n) % n; prev < 0 && differs(j) {
+			prev = j
+		}
+		if j := (i + k) % n; next < 0 && differs(j) {
+			next = j
+		}
+	}
+	if prev < 0 || next < 0 || prev == next {
+		return 0, 0, false
+	}
+	// skip repeated points, only the first of several equal points is checked
+	if j := (i - 1 + n) % n; !differs(j) {
+		return 0, 0, false
+	}
+	return prev, next, true
+}
+
+type edgeCrossing struct {
+	edge, other int
+	x, y        int32
+}
+
+// Finds pairs of non-adjacent edges that intersect or touch. Repeated points are skipped, edges are identified
+// by the index of their first point in the ring.
+func selfIntersections(ring []int32) []edgeCrossing {
+	n := len(ring) / 2
+	vertices := []int{}
+	for i := range n {
+		j := (i + 1) % n
+		if ring[2*i] != ring[2*j] || ring[2*i+1] != ring[2*j+1] {
+			vertices = append(vertices, i)
+		}
+	}
+	m := len(vertices)
+	point := func(k int) (int64, int64) {
+		i := vertices[k%m]
+		return int64(ring[2*i]), int64(ring[2*i+1])
+	}
+	crossings := []edgeCrossing{}
+	for k := range m {
+		ax, ay := point(k)
+		bx, by := point(k + 1)
+		for l := k + 2; l < m; l++ {
+			if k == 0 && l == m-1 {
+				continue // edges share the first vertex
+			}
+			cx, cy := point(l)
+			dx, dy := point(l + 1)
+			x, y, ok := segmentIntersection(ax, ay, bx, by, cx, cy, dx, dy)
+			if ok {
+				crossings = append(crossings, edgeCrossing{edge: vertices[k], other: vertices[l], x: x, y: y})
+			}
+		}
+	}
+	return crossings
+}
+
+// Orientation of c relative to the line a-b: 1 left, -1 right, 0 collinear
+func orientation(ax, ay, bx, by, cx, cy int64) int {
+	cross := (bx-ax)*(cy-ay) - (by-ay)*(cx-ax)
+	switch {
+	case cross > 0:
+		return 1
+	case cross < 0:
+		return -1
+	default:
+		return 0
+	}
+}
+
+func onSegment(ax, ay, bx, by, cx, cy int64) bool {
+	return min(ax, bx) <= cx && cx <= max(ax, bx) && min(ay, by) <= cy && cy <= max(ay, by)
+}
+
+// Returns a common point of the segments a-b and c-d, rounded to the grid
+func segmentIntersection(ax, ay, bx, by, cx, cy, dx, dy int64) (int32, int32, bool) {
+	o1 := orientation(ax, ay, bx, by, cx, cy)
+	o2 := orientation(ax, ay, bx, by, dx, dy)
+	o3 := orientation(cx, cy, dx, dy, ax, ay)
+	o4 := orientation(cx, cy, dx, dy, bx, by)
+	switch {
+	case o1 != o2 && o3 != o4 && o1 != 0 && o2 != 0 && o3 != 0 && o4 != 0:
+		t := float64((cx-ax)*(dy-cy)-(cy-ay)*(dx-cx)) / float64((bx-ax)*(dy-cy)-(by-ay)*(dx-cx))
+		return int32(math.Round(float64(ax) + t*float64(bx-ax))), int32(math.Round(float64(ay) + t*float64(by-ay))), true
+	case o1 == 0 && onSegment(ax, ay, bx, by, cx, cy):
+		return int32(cx), int32(cy), true
+	case o2 == 0 && onSegment(ax, ay, bx, by, dx, dy):
+		return int32(dx), int32(dy), true
+	case o3 == 0 && onSegment(cx, cy, dx, dy, ax, ay):
+		return int32(ax), int32(ay), true
+	case o4 == 0 && onSegment(cx, cy, dx, dy, bx, by):
+		return int32(bx), int32(by), true
+	}
+	return 0, 0, false
+}
+
+// RemoveDuplicatePoints removes consecutive repeated points of a polygon, a closing point is kept if present
+func RemoveDuplicatePoints(xy []int32) []int32 {
+	closed := isClosed(xy)
+	ring := removeDuplicatePoints(openRing(xy))
+	if closed && len(ring) >= 2 {
+		ring = append(ring, ring[0], ring[1])
+	}
+	return ring
+}
+
+// RemoveCollinearPoints removes repeated points and points on the line between their neighbors, including
+// spikes where the polygon turns back on itself. A closing point is kept if present.
+func RemoveCollinearPoints(xy []int32) []int32 {
+	closed := isClosed(xy)
+	ring := openRing(xy)
+	// every point is checked against the last two kept points, dropping the last one while it is collinear
+	kept := make([]int32, 0, len(ring)+2)
+	for i := 0; i+1 < len(ring); i += 2 {
+		for len(kept) >= 4 && collinearPoints(kept, len(kept)-4, len(kept)-2, ring, i) {
+			kept = kept[:len(kept)-2]
+		}
+		if len(kept) >= 2 && kept[len(kept)-2] == ring[i] && kept[len(kept)-1] == ring[i+1] {
+			continue
+		}
+		kept = append(kept, ring[i], ring[i+1])
+	}
+	// the ends of the ring are checked against each other
+	start := 0
+	for len(kept)-start >= 4 {
+		n := len(kept)
+		if kept[n-2] == kept[start] && kept[n-1] == kept[start+1] {
+			kept = kept[:n-2]
+		} else if len(kept)-start < 6 {
+			break
+		} else if collinearPoints(kept, n-4, n-2, kept, start) {
+			kept = kept[:n-2]
+		} else if collinearPoints(kept, n-2, start, kept, start+2) {
+			start += 2
+		} else {
+			break
+		}
+	}
+	ring = kept[start:]
+	if closed && len(ring) >= 2 {
+		ring = append(ring, ring[0], ring[1])
+	}
+	return ring
+}
+
+// collinearPoints reports whether the points at offsets a and b of xy and the point at offset c of next are collinear
+func collinearPoints(xy []int32, a, b int, next []int32, c int) bool {
+	return orientation(int64(xy[a]), int64(xy[a+1]), int64(xy[b]), int64(xy[b+1]), int64(next[c]), int64(next[c+1])) == 0
+}
+
+func isClosed(xy []int32) bool {
+	n := len(xy) - len(xy)%2
+	return n >= 4 && xy[0] == xy[n-2] && xy[1] == xy[n-1]
+}
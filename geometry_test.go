@@ -0,0 +1,103 @@
+package gds
+
+import (
+	"fmt"
+	"testing"
+)
+
+func issueRules(issues []PolygonIssue) map[ViolationRule]int {
+	rules := map[ViolationRule]int{}
+	for _, issue := range issues {
+		rules[issue.Rule]++
+	}
+	return rules
+}
+
+func TestCheckPolygon(t *testing.T) {
+	square := []int32{0, 0, 10, 0, 10, 10, 0, 10, 0, 0}
+	assertEqual(t, 0, len(CheckPolygon(square, GeometryOptions{MinAngle: 90})))
+
+	bowtie := []int32{0, 0, 10, 10, 10, 0, 0, 10, 0, 0}
+	issues := CheckPolygon(bowtie, GeometryOptions{})
+	rules := issueRules(issues)
+	assertEqual(t, 1, rules[RuleSelfIntersection])
+	assertEqual(t, 1, rules[RuleDegenerate])
+	for _, issue := range issues {
+		if issue.Rule == RuleSelfIntersection {
+			assertEqual(t, int32(5), issue.X)
+			assertEqual(t, int32(5), issue.Y)
+		}
+	}
+
+	repeated := []int32{0, 0, 10, 0, 10, 0, 10, 10, 5, 10, 0, 10, 0, 0}
+	issues = CheckPolygon(repeated, GeometryOptions{})
+	rules = issueRules(issues)
+	assertEqual(t, 2, len(issues))
+	assertEqual(t, 1, rules[RuleDuplicatePoint])
+	assertEqual(t, 1, rules[RuleCollinear])
+	assertEqual(t, 4, issues[1].Vertex)
+
+	spike := []int32{0, 0, 10, 0, 10, 10, 10, 20, 10, 10, 0, 10}
+	// the spike tip and the point where it leaves the boundary, the overlapping edges touch each other
+	rules = issueRules(CheckPolygon(spike, GeometryOptions{}))
+	assertEqual(t, 2, rules[RuleCollinear])
+	assertEqual(t, 3, rules[RuleSelfIntersection])
+
+	// clockwise triangle with a 45° corner at the origin
+	triangle := []int32{0, 0, 10, 10, 10, 0}
+	issues = CheckPolygon(triangle, GeometryOptions{MinAngle: 60})
+	assertEqual(t, 2, len(issues))
+	assertEqual(t, RuleAcuteAngle, issues[0].Rule)
+	assertEqual(t, 0, issues[0].Vertex)
+	assertEqual(t, RuleAcuteAngle, issues[1].Rule)
+	assertEqual(t, 1, issues[1].Vertex)
+
+	// L-shape has a reflex corner of 270°, which is no acute angle
+	lshape := []int32{0, 0, 20, 0, 20, 10, 10, 10, 10, 20, 0, 20}
+	assertEqual(t, 0, len(CheckPolygon(lshape, GeometryOptions{MinAngle: 90})))
+}
+
+func TestCheckGeometry(t *testing.T) {
+	library := NewLibrary("LIB", 1e-6, 1e-9)
+	cell, _ := library.NewCell("CELL")
+	cell.AddRect(LayerSpec{1, 0}, 0, 0, 10, 10)
+	cell.AddPolygon(LayerSpec{1, 0}, []int32{0, 0, 10, 10, 10, 0, 0, 10})
+	cell.AddPath(LayerSpec{2, 0}, 10, []int32{0, 0, 0, 0})
+	violations := CheckGeometry(library, GeometryOptions{})
+	assertEqual(t, 2, len(violations))
+	assertEqual(t, "CELL", violations[0].Cell)
+	assertEqual(t, 1, violations[0].Element)
+
+	layermap, err := library.GetLayermapPolygons("CELL")
+	if err != nil {
+		t.Fatalf("could not get polygons: %v", err)
+	}
+	assertEqual(t, 2, len(layermap["1/0"].CheckGeometry(GeometryOptions{})))
+}
+
+func TestRemoveCollinearPoints(t *testing.T) {
+	repeated := []int32{0, 0, 10, 0, 10, 0, 10, 10, 5, 10, 0, 10, 0, 0}
+	cleaned := RemoveDuplicatePoints(repeated)
+	assertEqual(t, 12, len(cleaned))
+	cleaned = RemoveCollinearPoints(repeated)
+	assertEqual(t, 10, len(cleaned))
+	assertEqual(t, 0, len(CheckPolygon(cleaned, GeometryOptions{})))
+
+	spike := []int32{0, 0, 10, 0, 10, 10, 10, 20, 10, 10, 0, 10}
+	cleaned = RemoveCollinearPoints(spike)
+	assertEqual(t, 8, len(cleaned))
+	assertEqual(t, 0, len(CheckPolygon(cleaned, GeometryOptions{})))
+
+	// the first point lies on the closing edge
+	wrapped := []int32{5, 0, 10, 0, 10, 10, 0, 10, 0, 0, 0, 0}
+	cleaned = RemoveCollinearPoints(wrapped)
+	assertEqual(t, "[10 0 10 10 0 10 0 0]", fmt.Sprint(cleaned))
+
+	dense := []int32{}
+	for x := range int32(100000) {
+		dense = append(dense, x, 0)
+	}
+	dense = append(dense, 100000, 0, 100000, 10, 0, 10)
+	cleaned = RemoveCollinearPoints(dense)
+	assertEqual(t, "[0 0 100000 0 100000 10 0 10]", fmt.Sprint(cleaned))
+}
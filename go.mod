@@ -2,4 +2,4 @@ module github.com/gluek/go-gds
 
 go 1.22.0
 
-require github.com/ajstarks/svgo v0.0.0-20211024235047-1546f124cd8b // indirect
+require github.com/ajstarks/svgo v0.0.0-20211024235047-1546f124cd8b
@@ -0,0 +1,183 @@
+package gds
+
+import (
+	"fmt"
+	"math"
+)
+
+// RuleOffGrid is reported by SnapToGrid for elements that could not be moved to the grid
+const RuleOffGrid ViolationRule = "off-grid"
+
+// GridViolation is a vertex that does not lie on the manufacturing grid in top cell coordinates
+type GridViolation struct {
+	Cell    string       // structure that contains the element
+	Element int          // index into Structure.Elements
+	Path    InstancePath // instance of Cell that places the vertex off grid
+	Vertex  int
+	X, Y    float64 // position in top cell coordinates
+}
+
+func (g GridViolation) String() string {
+	return fmt.Sprintf("%v: %s[%d] vertex %d at (%g, %g) is off grid", g.Path, g.Cell, g.Element, g.Vertex, g.X, g.Y)
+}
+
+// CheckGrid reports all vertices of boundaries, boxes and paths below top that are not on a multiple of grid
+// (in database units) after applying the transforms of all references. Vertices that are on grid in their own
+// cell can be placed off grid by references with non-Manhattan angles, magnifications or off-grid origins.
+func (l *Library) CheckGrid(top string, grid int32) ([]GridViolation, error) {
+	if grid <= 0 {
+		return nil, fmt.Errorf("grid must be positive, got %d", grid)
+	}
+	violations := []GridViolation{}
+	err := l.WalkInstances(top, func(instance Instance) error {
+		for i, element := range instance.Structure.Elements {
+			var xy []int32
+			switch e := asPointer(element).(type) {
+			case *Boundary:
+				xy = openRing(e.XY)
+			case *Box:
+				xy = openRing(e.XY)
+			case *Path:
+				xy = e.XY
+			default:
+				continue
+			}
+			for vertex := 0; vertex+1 < len(xy); vertex += 2 {
+				x, y := instance.Transform.Apply(float64(xy[vertex]), float64(xy[vertex+1]))
+				if !onGrid(x, grid) || !onGrid(y, grid) {
+					violations = append(violations, GridViolation{
+						Cell:    instance.Structure.StrName,
+						Element: i,
+						Path:    instance.Path,
+						Vertex:  vertex / 2,
+						X:       x,
+						Y:       y,
+					})
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not check grid of cell %s: %v", top, err)
+	}
+	return violations, nil
+}
+
+// Tolerates rounding errors of transformed coordinates
+func onGrid(value float64, grid int32) bool {
+	return math.Abs(value-float64(grid)*math.Round(value/float64(grid))) < 1e-6*max(1, math.Abs(value))
+}
+
+func snap(value int32, grid int32) int32 {
+	return int32(math.Round(float64(value)/float64(grid))) * grid
+}
+
+// SnapPolygon moves all points of a polygon to the nearest multiple of grid and removes points that become
+// repeated or collinear. ok is false if the snapped polygon degenerates or intersects itself.
+func SnapPolygon(xy []int32, grid int32) ([]int32, bool) {
+	snapped := RemoveCollinearPoints(snapPoints(xy, grid))
+	if !validSnap(snapped) {
+		return xy, false
+	}
+	return snapped, true
+}
+
+// Reports whether a snapped polygon still has an area and does not intersect itself
+func validSnap(xy []int32) bool {
+	ring := openRing(xy)
+	return len(ring) >= 6 && signedArea(xy) != 0 && len(selfIntersections(ring)) == 0
+}
+
+// SnapToGrid snaps all polygons of the layer to grid, e.g. after flattening rotated instances with
+// GetLayermapPolygons. Polygons that would become invalid are left unchanged, their indices are returned.
+func (p *PolygonLayer) SnapToGrid(grid int32) []int {
+	failed := []int{}
+	for i, polygon := range p.Polygons {
+		snapped, ok := SnapPolygon(polygon, grid)
+		if !ok {
+			failed = append(failed, i)
+			continue
+		}
+		p.Polygons[i] = snapped
+	}
+	return failed
+}
+
+// SnapToGrid moves all coordinates of all structures to the nearest multiple of grid: boundary and box vertices,
+// path points, text positions, reference origins and array pitches. Boundaries and boxes that would become invalid
+// are left unchanged and reported. Off-grid vertices caused by rotated or magnified references remain, flatten
+// them with FlattenPolygons and snap the resulting polygons with SnapPolygon instead.
+func (l *Library) SnapToGrid(grid int32) ([]Violation, error) {
+	if grid <= 0 {
+		return nil, fmt.Errorf("grid must be positive, got %d", grid)
+	}
+	violations := []Violation{}
+	names, _ := l.StructureNames(OrderInput)
+	for _, name := range names {
+		structure := l.Structures[name]
+		for i, element := range structure.Elements {
+			pointer := asPointer(element)
+			switch e := pointer.(type) {
+			case *Boundary:
+				snapped, ok := SnapPolygon(e.XY, grid)
+				if !ok {
+					violations = append(violations, Violation{Cell: name, Element: i, Rule: RuleOffGrid, Message: "boundary degenerates when snapped to grid"})
+					continue
+				}
+				e.XY = snapped
+			case *Box:
+				snapped := snapPoints(e.XY, grid)
+				if !validSnap(snapped) {
+					violations = append(violations, Violation{Cell: name, Element: i, Rule: RuleOffGrid, Message: "box degenerates when snapped to grid"})
+					continue
+				}
+				e.XY = snapped
+			case *Path:
+				e.XY = removeRepeatedPathPoints(snapPoints(e.XY, grid))
+			case *Text:
+				e.XY = snapPoints(e.XY, grid)
+			case *SRef:
+				e.XY = snapPoints(e.XY, grid)
+			case *ARef:
+				if len(e.XY) != 6 || len(e.Colrow) != 2 || e.Colrow[0] < 1 || e.Colrow[1] < 1 {
+					violations = append(violations, Violation{Cell: name, Element: i, Rule: RuleOffGrid, Message: "invalid array can not be snapped"})
+					continue
+				}
+				// snap the pitch instead of the displaced points, so that every placement lands on grid
+				x0, y0 := snap(e.XY[0], grid), snap(e.XY[1], grid)
+				cols, rows := int32(e.Colrow[0]), int32(e.Colrow[1])
+				e.XY = []int32{
+					x0, y0,
+					x0 + snap((e.XY[2]-e.XY[0])/cols, grid)*cols, y0 + snap((e.XY[3]-e.XY[1])/cols, grid)*cols,
+					x0 + snap((e.XY[4]-e.XY[0])/rows, grid)*rows, y0 + snap((e.XY[5]-e.XY[1])/rows, grid)*rows,
+				}
+			default:
+				continue
+			}
+			structure.Elements[i] = pointer
+		}
+	}
+	return violations, nil
+}
+
+func snapPoints(xy []int32, grid int32) []int32 {
+	snapped := make([]int32, len(xy))
+	for i, value := range xy {
+		snapped[i] = snap(value, grid)
+	}
+	return snapped
+}
+
+// Removes consecutive repeated points of a path
+func removeRepeatedPathPoints(xy []int32) []int32 {
+	result := []int32{}
+	for i := 0; i+1 < len(xy); i += 2 {
+		n := len(result)
+		if n >= 2 && result[n-2] == xy[i] && result[n-1] == xy[i+1] {
+			continue
+		}
+		result = append(result, xy[i], xy[i+1])
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package gds
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestTransformCompose(t *testing.T) {
+	outer := Transform{X: 100, Y: 0, Mag: 2, Angle: 90}
+	inner := Transform{X: 10, Y: 0, Mag: 1, Angle: 0, Mirror: true}
+	composed := outer.Compose(inner)
+	for _, point := range [][2]float64{{0, 0}, {1, 0}, {0, 1}, {3, -7}} {
+		ix, iy := inner.Apply(point[0], point[1])
+		ex, ey := outer.Apply(ix, iy)
+		x, y := composed.Apply(point[0], point[1])
+		if math.Abs(x-ex) > 1e-9 || math.Abs(y-ey) > 1e-9 {
+			t.Fatalf("composed transform maps %v to (%g, %g), expected (%g, %g)", point, x, y, ex, ey)
+		}
+	}
+	assertEqual(t, true, composed.Mirror)
+	assertEqual(t, true, composed.Manhattan())
+	assertEqual(t, false, Transform{Mag: 1, Angle: 45}.Manhattan())
+}
+
+func gridLibrary(t *testing.T) *Library {
+	library := NewLibrary("GRID", 1e-6, 1e-9)
+	cell, err := library.NewCell("CELL")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	cell.AddRect(LayerSpec{1, 0}, 0, 0, 100, 50)
+	top, err := library.NewCell("TOP")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	top.AddInstance("CELL", 0, 0)
+	top.AddInstance("CELL", 1000, 0).Angle = 45
+	top.AddArray("CELL", 0, 1000, 2, 1, 502, 500)
+	return library
+}
+
+func TestCheckGrid(t *testing.T) {
+	library := gridLibrary(t)
+	violations, err := library.CheckGrid("TOP", 5)
+	if err != nil {
+		t.Fatalf("could not check grid: %v", err)
+	}
+	paths := map[string]int{}
+	for _, violation := range violations {
+		assertEqual(t, "CELL", violation.Cell)
+		paths[violation.Path.String()]++
+	}
+	// the rotated instance moves all vertices but the origin off grid, the second array column is shifted by 2
+	assertEqual(t, 2, len(paths))
+	assertEqual(t, 3, paths["TOP/CELL#1"])
+	assertEqual(t, 4, paths["TOP/CELL#2[1,0]"])
+
+	_, err = library.CheckGrid("MISSING", 5)
+	if err == nil {
+		t.Fatalf("could check grid of missing cell")
+	}
+	library.Structures["CELL"].AddInstance("TOP", 0, 0)
+	_, err = library.CheckGrid("TOP", 5)
+	if err == nil {
+		t.Fatalf("could check grid of cyclic hierarchy")
+	}
+}
+
+func TestSnapPolygon(t *testing.T) {
+	snapped, ok := SnapPolygon([]int32{1, -2, 99, 1, 102, 48, 3, 52, 1, -2}, 5)
+	assertEqual(t, true, ok)
+	assertEqual(t, fmt.Sprint([]int32{0, 0, 100, 0, 100, 50, 5, 50, 0, 0}), fmt.Sprint(snapped))
+
+	// a sliver narrower than the grid collapses
+	sliver := []int32{0, 0, 100, 0, 100, 2, 0, 2, 0, 0}
+	snapped, ok = SnapPolygon(sliver, 5)
+	assertEqual(t, false, ok)
+	assertEqual(t, fmt.Sprint(sliver), fmt.Sprint(snapped))
+
+	layer := PolygonLayer{Enabled: true, Polygons: [][]int32{{1, 1, 11, 1, 11, 11, 1, 11}, sliver}}
+	assertEqual(t, fmt.Sprint([]int{1}), fmt.Sprint(layer.SnapToGrid(5)))
+	assertEqual(t, fmt.Sprint([]int32{0, 0, 10, 0, 10, 10, 0, 10}), fmt.Sprint(layer.Polygons[0]))
+}
+
+func TestLibrarySnapToGrid(t *testing.T) {
+	library := gridLibrary(t)
+	cell := library.Structures["CELL"]
+	cell.AddRect(LayerSpec{1, 0}, 0, 0, 100, 2)
+	path, err := cell.AddPath(LayerSpec{2, 0}, 10, []int32{0, 0, 1, 1, 52, 1})
+	if err != nil {
+		t.Fatalf("could not add path: %v", err)
+	}
+	cell.Elements = append(cell.Elements,
+		Text{Layer: 3, XY: []int32{7, 7}, StringBody: "label", Mag: 1},
+		&Box{Layer: 4, XY: []int32{0, 0, 100, 0, 100, 2, 0, 2, 0, 0}},
+		&Box{Layer: 4, XY: []int32{1, 1, 99, 1, 99, 49, 1, 49, 1, 1}})
+	violations, err := library.SnapToGrid(5)
+	if err != nil {
+		t.Fatalf("could not snap library: %v", err)
+	}
+	assertEqual(t, 2, len(violations))
+	assertEqual(t, 1, violations[0].Element)
+	assertEqual(t, "box degenerates when snapped to grid", violations[1].Message)
+	assertEqual(t, fmt.Sprint([]int32{0, 0, 100, 0, 100, 2, 0, 2, 0, 0}), fmt.Sprint(cell.Elements[4].(*Box).XY))
+	assertEqual(t, fmt.Sprint([]int32{0, 0, 100, 0, 100, 50, 0, 50, 0, 0}), fmt.Sprint(cell.Elements[5].(*Box).XY))
+	assertEqual(t, fmt.Sprint([]int32{0, 0, 50, 0}), fmt.Sprint(path.XY))
+	assertEqual(t, fmt.Sprint([]int32{5, 5}), fmt.Sprint(cell.Elements[3].(*Text).XY))
+	assertEqual(t, fmt.Sprint([]int32{0, 1000, 1000, 1000, 0, 1500}), fmt.Sprint(library.Structures["TOP"].Elements[2].(*ARef).XY))
+
+	gridViolations, err := library.CheckGrid("TOP", 5)
+	if err != nil {
+		t.Fatalf("could not check grid: %v", err)
+	}
+	// only the rotated instance and the slivers that could not be snapped remain off grid
+	for _, violation := range gridViolations {
+		if violation.Path.String() != "TOP/CELL#1" && violation.Element != 4 {
+			assertEqual(t, 1, violation.Element)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package gds
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Transform maps coordinates of a referenced structure into the coordinates of its parent.
+// Points are mirrored at the x-axis first, then magnified, rotated counter-clockwise by Angle degrees and shifted.
+type Transform struct {
+	X, Y   float64
+	Mag    float64
+	Angle  float64
+	Mirror bool
+}
+
+// IdentityTransform leaves all points unchanged
+func IdentityTransform() Transform {
+	return Transform{Mag: 1}
+}
+
+// Returns the transform of a reference placed at (x, y) with the given STRANS flags, magnification and angle
+func referenceTransform(x, y int32, strans uint16, mag float64, angle float64) Transform {
+	return Transform{X: float64(x), Y: float64(y), Mag: mag, Angle: angle, Mirror: strans&0x8000 != 0}
+}
+
+// Apply transforms a single point
+func (t Transform) Apply(x, y float64) (float64, float64) {
+	if t.Mirror {
+		y = -y
+	}
+	sin, cos := sinCos(t.Angle)
+	return (x*cos-y*sin)*t.Mag + t.X, (x*sin+y*cos)*t.Mag + t.Y
+}
+
+// Sine and cosine of an angle in degrees, exact for multiples of 90°
+func sinCos(angle float64) (float64, float64) {
+	switch math.Mod(math.Mod(angle, 360)+360, 360) {
+	case 0:
+		return 0, 1
+	case 90:
+		return 1, 0
+	case 180:
+		return 0, -1
+	case 270:
+		return -1, 0
+	}
+	return math.Sincos(angle * math.Pi / 180)
+}
+
+// Compose returns the transform that applies inner first and t afterwards,
+// e.g. the transform of a reference inside a structure that is itself placed with t
+func (t Transform) Compose(inner Transform) Transform {
+	x, y := t.Apply(inner.X, inner.Y)
+	angle := t.Angle + inner.Angle
+	if t.Mirror {
+		angle = t.Angle - inner.Angle
+	}
+	return Transform{
+		X:      x,
+		Y:      y,
+		Mag:    t.Mag * inner.Mag,
+		Angle:  math.Mod(angle+360, 360),
+		Mirror: t.Mirror != inner.Mirror,
+	}
+}
+
+// Manhattan reports whether the transform maps horizontal and vertical edges to horizontal and vertical edges
+func (t Transform) Manhattan() bool {
+	return math.Abs(math.Remainder(t.Angle, 90)) < 1e-9
+}
+
+// InstancePath names the references leading from the top cell to an instance, e.g. TOP/CELL#2/VIA#0[1,3].
+// Each step is the referenced structure, the index of the reference in the parent's elements and,
+// for arrays, the column and row.
+type InstancePath []string
+
+func (p InstancePath) String() string {
+	return strings.Join(p, "/")
+}
+
+// Instance is a single placement of a structure below a top cell
+type Instance struct {
+	Structure *Structure
+	Path      InstancePath
+	// maps coordinates of Structure to coordinates of the top cell
+	Transform Transform
+}
+
+// WalkInstances calls visit for the top cell and for every placement of a structure below it, arrays are
+// expanded into single placements. The walk stops at the first error returned by visit.
+// References to undefined structures and reference cycles are reported as error.
+func (l *Library) WalkInstances(top string, visit func(Instance) error) error {
+	structure, ok := l.Structures[top]
+	if !ok {
+		return fmt.Errorf("cell with name %s does not exist", top)
+	}
+	return l.walkInstances(Instance{Structure: structure, Path: InstancePath{top}, Transform: IdentityTransform()}, map[string]bool{}, visit)
+}
+
+func (l *Library) walkInstances(instance Instance, visiting map[string]bool, visit func(Instance) error) error {
+	name := instance.Structure.StrName
+	if visiting[name] {
+		return fmt.Errorf("reference cycle through structure %s at %v", name, instance.Path)
+	}
+	err := visit(instance)
+	if err != nil {
+		return err
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+	for i, element := range instance.Structure.Elements {
+		switch e := asPointer(element).(type) {
+		case *SRef:
+			child, ok := l.Structures[e.Sname]
+			if !ok {
+				return fmt.Errorf("reference to undefined structure %s at %v", e.Sname, instance.Path)
+			}
+			if len(e.XY) != 2 {
+				return fmt.Errorf("sref %d at %v needs exactly 1 point, got %d coordinates", i, instance.Path, len(e.XY))
+			}
+			err := l.walkInstances(Instance{
+				Structure: child,
+				Path:      append(instance.Path[:len(instance.Path):len(instance.Path)], fmt.Sprintf("%s#%d", e.Sname, i)),
+				Transform: instance.Transform.Compose(referenceTransform(e.XY[0], e.XY[1], e.Strans, e.Mag, e.Angle)),
+			}, visiting, visit)
+			if err != nil {
+				return err
+			}
+		case *ARef:
+			child, ok := l.Structures[e.Sname]
+			if !ok {
+				return fmt.Errorf("reference to undefined structure %s at %v", e.Sname, instance.Path)
+			}
+			if len(e.XY) != 6 || len(e.Colrow) != 2 || e.Colrow[0] < 1 || e.Colrow[1] < 1 {
+				return fmt.Errorf("aref %d at %v needs 3 points and positive columns and rows, got %v and %v", i, instance.Path, e.XY, e.Colrow)
+			}
+			cols := int(e.Colrow[0])
+			for k, position := range arrayPositions(e) {
+				placement := referenceTransform(0, 0, e.Strans, e.Mag, e.Angle)
+				placement.X, placement.Y = position[0], position[1]
+				err := l.walkInstances(Instance{
+					Structure: child,
+					Path:      append(instance.Path[:len(instance.Path):len(instance.Path)], fmt.Sprintf("%s#%d[%d,%d]", e.Sname, i, k%cols, k/cols)),
+					Transform: instance.Transform.Compose(placement),
+				}, visiting, visit)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the origins of all placements of an array row by row. The second and third point of the array
+// are the origin displaced by all columns and by all rows respectively.
+func arrayPositions(ref *ARef) [][2]float64 {
+	cols, rows := float64(ref.Colrow[0]), float64(ref.Colrow[1])
+	x0, y0 := float64(ref.XY[0]), float64(ref.XY[1])
+	colX, colY := (float64(ref.XY[2])-x0)/cols, (float64(ref.XY[3])-y0)/cols
+	rowX, rowY := (float64(ref.XY[4])-x0)/rows, (float64(ref.XY[5])-y0)/rows
+	positions := make([][2]float64, 0, int(ref.Colrow[0])*int(ref.Colrow[1]))
+	for row := range int(ref.Colrow[1]) {
+		for col := range int(ref.Colrow[0]) {
+			positions = append(positions, [2]float64{
+				x0 + float64(col)*colX + float64(row)*rowX,
+				y0 + float64(col)*colY + float64(row)*rowY,
+			})
+		}
+	}
+	return positions
+}
+
+// FlattenPolygons returns all boundaries, boxes and path outlines placed below top in top cell coordinates,
+// keyed by layer/datatype. Unlike GetLayermapPolygons, transforms of nested references are composed.
+func (l *Library) FlattenPolygons(top string) (map[string][][]int32, error) {
+	result := map[string][][]int32{}
+	err := l.WalkInstances(top, func(instance Instance) error {
+		for _, element := range instance.Structure.Elements {
+			var xy []int32
+			switch e := asPointer(element).(type) {
+			case *Boundary:
+				xy = openRing(e.XY)
+			case *Box:
+				xy = openRing(e.XY)
+			case *Path:
+				xy = PathOutline(e)
+			default:
+				continue
+			}
+			if len(xy) < 6 {
+				continue
+			}
+			result[element.GetLayer()] = append(result[element.GetLayer()], instance.Transform.ApplyPoints(xy))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not flatten cell %s: %v", top, err)
+	}
+	return result, nil
+}
+
+// FlattenLabels returns the positions of all texts placed below top in top cell coordinates, keyed by
+// layer/texttype. Unlike GetLayermapLabels, transforms of nested references are composed.
+func (l *Library) FlattenLabels(top string) (map[string]*LabelLayer, error) {
+	result := map[string]*LabelLayer{}
+	err := l.WalkInstances(top, func(instance Instance) error {
+		for _, element := range instance.Structure.Elements {
+			text, ok := asPointer(element).(*Text)
+			if !ok || len(text.XY) != 2 {
+				continue
+			}
+			layer, ok := result[text.GetLayer()]
+			if !ok {
+				layer = &LabelLayer{Enabled: true, Labels: []string{}, LabelCoords: [][]int32{}}
+				result[text.GetLayer()] = layer
+			}
+			layer.appendLabel(instance.Transform.ApplyPoints(text.XY), text.StringBody)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not flatten labels of cell %s: %v", top, err)
+	}
+	return result, nil
+}
+
+// ApplyPoints transforms x0, y0, x1, y1, ... and rounds the result to database units
+func (t Transform) ApplyPoints(xy []int32) []int32 {
+	result := make([]int32, len(xy)-len(xy)%2)
+	for i := 0; i+1 < len(xy); i += 2 {
+		x, y := t.Apply(float64(xy[i]), float64(xy[i+1]))
+		result[i], result[i+1] = int32(math.Round(x)), int32(math.Round(y))
+	}
+	return result
+}
@@ -1,6 +1,9 @@
 package gds
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 type CellData struct {
 	Layers   []string                 `json:"layers"`
@@ -9,6 +12,103 @@ type CellData struct {
 	Labels   map[string]*LabelLayer   `json:"labels"`
 }
 
+// Returns the sorted union of all layers that contain polygons, paths or labels
+func (c *CellData) collectLayers() []string {
+	unique := map[string]bool{}
+	for layer := range c.Polygons {
+		unique[layer] = true
+	}
+	for layer := range c.Paths {
+		unique[layer] = true
+	}
+	for layer := range c.Labels {
+		unique[layer] = true
+	}
+	layers := make([]string, 0, len(unique))
+	for layer := range unique {
+		layers = append(layers, layer)
+	}
+	sortLayers(layers)
+	return layers
+}
+
+// SetLayerEnabled switches polygons, paths and labels of a layer on or off
+func (c *CellData) SetLayerEnabled(layer string, enabled bool) error {
+	found := false
+	if polygons, ok := c.Polygons[layer]; ok {
+		polygons.Enabled = enabled
+		found = true
+	}
+	if paths, ok := c.Paths[layer]; ok {
+		paths.Enabled = enabled
+		found = true
+	}
+	if labels, ok := c.Labels[layer]; ok {
+		labels.Enabled = enabled
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("layer %s does not exist in cell data", layer)
+	}
+	return nil
+}
+
+// ToggleLayer inverts the enabled state of a layer and returns the new state
+func (c *CellData) ToggleLayer(layer string) (bool, error) {
+	enabled := !c.LayerEnabled(layer)
+	err := c.SetLayerEnabled(layer, enabled)
+	if err != nil {
+		return false, err
+	}
+	return enabled, nil
+}
+
+// LayerEnabled reports whether any content of the layer is enabled
+func (c *CellData) LayerEnabled(layer string) bool {
+	if polygons, ok := c.Polygons[layer]; ok && polygons.Enabled {
+		return true
+	}
+	if paths, ok := c.Paths[layer]; ok && paths.Enabled {
+		return true
+	}
+	if labels, ok := c.Labels[layer]; ok && labels.Enabled {
+		return true
+	}
+	return false
+}
+
+// EnabledLayers returns the sorted list of layers that are currently enabled
+func (c *CellData) EnabledLayers() []string {
+	layers := []string{}
+	for _, layer := range c.collectLayers() {
+		if c.LayerEnabled(layer) {
+			layers = append(layers, layer)
+		}
+	}
+	return layers
+}
+
+// Sorts layer strings of the form "layer/datatype" numerically, other strings are sorted lexically after them
+func sortLayers(layers []string) {
+	sort.Slice(layers, func(i, j int) bool {
+		var li, di, lj, dj int
+		_, errI := fmt.Sscanf(layers[i], "%d/%d", &li, &di)
+		_, errJ := fmt.Sscanf(layers[j], "%d/%d", &lj, &dj)
+		switch {
+		case errI != nil && errJ != nil:
+			return layers[i] < layers[j]
+		case errI != nil:
+			return false
+		case errJ != nil:
+			return true
+		case li != lj:
+			return li < lj
+		default:
+			return di < dj
+		}
+	})
+}
+
 type PolygonLayer struct {
 	Enabled  bool      `json:"enable"`
 	Polygons [][]int32 `json:"polygons"`
@@ -0,0 +1,457 @@
+package gds
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// JSON serialization of libraries. Structures are written as list in StructureOrder, elements as objects with a
+// "type" discriminator followed by their fields and their properties as attribute/value objects. Records (metadata,
+// opaque records) are written as strings in the text format of WriteTextRecords, e.g. "REFLIBS \"lib\"".
+//
+// Records the encoder would write differently from the decoded stream (e.g. reals with a non-normalized mantissa)
+// are kept in "source", so that the GDSII stream written from the unmarshalled library is byte-identical.
+//
+// The JSON keys and the text form of records belong to the private types below, the JSON encoding of the element
+// and record types is left unchanged.
+
+// Discriminators of the element types
+var jsonElementTypes = map[string]func() Element{
+	"boundary": func() Element { return &Boundary{} },
+	"path":     func() Element { return &Path{} },
+	"text":     func() Element { return &Text{} },
+	"node":     func() Element { return &Node{} },
+	"box":      func() Element { return &Box{} },
+	"sref":     func() Element { return &SRef{} },
+	"aref":     func() Element { return &ARef{} },
+}
+
+type jsonLibrary struct {
+	Header     int16        `json:"header"`
+	BgnLib     []int16      `json:"bgnlib"`
+	LibName    string       `json:"libname"`
+	Units      []float64    `json:"units"`
+	Metadata   jsonRecords  `json:"metadata,omitempty"`
+	Structures []*Structure `json:"structures"`
+	Opaque     jsonRecords  `json:"opaque,omitempty"`
+	Source     jsonRecords  `json:"source,omitempty"`
+}
+
+type jsonStructure struct {
+	BgnStr   []int16           `json:"bgnstr"`
+	StrName  string            `json:"strname"`
+	Elements []json.RawMessage `json:"elements"`
+	Opaque   jsonRecords       `json:"opaque,omitempty"`
+	Source   jsonRecords       `json:"source,omitempty"`
+}
+
+// Discriminator written in front of the element fields
+type jsonElementHeader struct {
+	Type string `json:"type"`
+}
+
+// Properties, opaque records, explicitly present optional records and kept source records written after the
+// element fields
+type jsonElementInfo struct {
+	Properties []jsonProperty `json:"properties,omitempty"`
+	Opaque     jsonRecords    `json:"opaque,omitempty"`
+	Explicit   []string       `json:"explicit,omitempty"`
+	Source     jsonRecords    `json:"source,omitempty"`
+}
+
+type jsonProperty struct {
+	Attribute int16  `json:"attribute"`
+	Value     string `json:"value"`
+}
+
+// Records written as lines of the text format
+type jsonRecords []Record
+
+// Element fields with their JSON keys, element pointers are converted to pointers of these types
+type jsonBoundary struct {
+	ElFlags     uint16  `json:"elflags"`
+	Plex        int32   `json:"plex"`
+	Layer       int16   `json:"layer"`
+	Datatype    int16   `json:"datatype"`
+	XY          []int32 `json:"xy"`
+	ElementInfo `json:"-"`
+}
+
+type jsonPath struct {
+	ElFlags     uint16  `json:"elflags"`
+	Plex        int32   `json:"plex"`
+	Layer       int16   `json:"layer"`
+	Datatype    int16   `json:"datatype"`
+	Pathtype    int16   `json:"pathtype"`
+	Bgnextn     int32   `json:"bgnextn"`
+	Endextn     int32   `json:"endextn"`
+	Width       int32   `json:"width"`
+	XY          []int32 `json:"xy"`
+	ElementInfo `json:"-"`
+}
+
+type jsonText struct {
+	ElFlags      uint16  `json:"elflags"`
+	Plex         int32   `json:"plex"`
+	Layer        int16   `json:"layer"`
+	Texttype     int16   `json:"texttype"`
+	Presentation uint16  `json:"presentation"`
+	Strans       uint16  `json:"strans"`
+	Mag          float64 `json:"mag"`
+	Angle        float64 `json:"angle"`
+	XY           []int32 `json:"xy"`
+	StringBody   string  `json:"stringbody"`
+	ElementInfo  `json:"-"`
+}
+
+type jsonNode struct {
+	ElFlags     uint16  `json:"elflags"`
+	Plex        int32   `json:"plex"`
+	Layer       int16   `json:"layer"`
+	Nodetype    int16   `json:"nodetype"`
+	XY          []int32 `json:"xy"`
+	ElementInfo `json:"-"`
+}
+
+type jsonBox struct {
+	ElFlags     uint16  `json:"elflags"`
+	Plex        int32   `json:"plex"`
+	Layer       int16   `json:"layer"`
+	Boxtype     int16   `json:"boxtype"`
+	XY          []int32 `json:"xy"`
+	ElementInfo `json:"-"`
+}
+
+type jsonSRef struct {
+	ElFlags     uint16  `json:"elflags"`
+	Plex        int32   `json:"plex"`
+	Sname       string  `json:"sname"`
+	Strans      uint16  `json:"strans"`
+	Mag         float64 `json:"mag"`
+	Angle       float64 `json:"angle"`
+	XY          []int32 `json:"xy"`
+	ElementInfo `json:"-"`
+}
+
+type jsonARef struct {
+	ElFlags     uint16  `json:"elflags"`
+	Plex        int32   `json:"plex"`
+	Sname       string  `json:"sname"`
+	Strans      uint16  `json:"strans"`
+	Mag         float64 `json:"mag"`
+	Angle       float64 `json:"angle"`
+	Colrow      []int16 `json:"colrow"`
+	XY          []int32 `json:"xy"`
+	ElementInfo `json:"-"`
+}
+
+func (r jsonRecords) MarshalJSON() ([]byte, error) {
+	lines := make([]string, len(r))
+	for i, record := range r {
+		lines[i] = formatTextRecord(record)
+	}
+	return json.Marshal(lines)
+}
+
+func (r *jsonRecords) UnmarshalJSON(data []byte) error {
+	var lines []string
+	err := json.Unmarshal(data, &lines)
+	if err != nil {
+		return err
+	}
+	if lines == nil {
+		*r = nil
+		return nil
+	}
+	records := make(jsonRecords, len(lines))
+	for i, line := range lines {
+		records[i], err = parseTextRecord(line)
+		if err != nil {
+			return err
+		}
+	}
+	*r = records
+	return nil
+}
+
+// MarshalJSON writes the header data, structures and opaque records of the library
+func (l Library) MarshalJSON() ([]byte, error) {
+	names, err := l.StructureNames(OrderInput)
+	if err != nil {
+		return nil, err
+	}
+	structures := make([]*Structure, len(names))
+	for i, name := range names {
+		structures[i] = l.Structures[name]
+	}
+	header := l
+	header.Metadata = nil
+	with, err := header.headerRecords()
+	if err != nil {
+		return nil, err
+	}
+	header.source = nil
+	without, err := header.headerRecords()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonLibrary{
+		Header:     l.Header,
+		BgnLib:     l.BgnLib,
+		LibName:    l.LibName,
+		Units:      l.Units,
+		Metadata:   l.Metadata,
+		Structures: structures,
+		Opaque:     l.Opaque,
+		Source:     keptSource(with, without),
+	})
+}
+
+// UnmarshalJSON replaces the library by the one given as JSON, StructureOrder follows the order of the structures
+func (l *Library) UnmarshalJSON(data []byte) error {
+	var library jsonLibrary
+	err := json.Unmarshal(data, &library)
+	if err != nil {
+		return err
+	}
+	*l = Library{
+		Header:         library.Header,
+		BgnLib:         library.BgnLib,
+		LibName:        library.LibName,
+		Units:          library.Units,
+		Structures:     make(map[string]*Structure, len(library.Structures)),
+		StructureOrder: make([]string, 0, len(library.Structures)),
+		Metadata:       library.Metadata,
+		Opaque:         library.Opaque,
+		source:         library.Source,
+	}
+	if l.Metadata == nil {
+		l.Metadata = []Record{}
+	}
+	for _, structure := range library.Structures {
+		if structure == nil {
+			return fmt.Errorf("structure %d is null", len(l.StructureOrder))
+		}
+		if _, ok := l.Structures[structure.StrName]; ok {
+			return fmt.Errorf("structure with name %s already exists", structure.StrName)
+		}
+		l.Structures[structure.StrName] = structure
+		l.StructureOrder = append(l.StructureOrder, structure.StrName)
+	}
+	return nil
+}
+
+// MarshalJSON writes the structure with the type of every element
+func (s Structure) MarshalJSON() ([]byte, error) {
+	elements := make([]json.RawMessage, len(s.Elements))
+	for i, element := range s.Elements {
+		data, err := marshalElement(element)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal element %d of structure %s: %v", i, s.StrName, err)
+		}
+		elements[i] = data
+	}
+	header := s
+	header.Elements = nil
+	with, err := header.Records()
+	if err != nil {
+		return nil, err
+	}
+	header.source = nil
+	without, err := header.Records()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonStructure{
+		BgnStr:   s.BgnStr,
+		StrName:  s.StrName,
+		Elements: elements,
+		Opaque:   s.Opaque,
+		Source:   keptSource(with, without),
+	})
+}
+
+// UnmarshalJSON replaces the structure by the one given as JSON, elements are created as pointers
+func (s *Structure) UnmarshalJSON(data []byte) error {
+	var structure jsonStructure
+	err := json.Unmarshal(data, &structure)
+	if err != nil {
+		return err
+	}
+	*s = Structure{
+		BgnStr:   structure.BgnStr,
+		StrName:  structure.StrName,
+		Elements: make([]Element, len(structure.Elements)),
+		Opaque:   structure.Opaque,
+		source:   structure.Source,
+	}
+	for i, elementData := range structure.Elements {
+		s.Elements[i], err = unmarshalElement(elementData)
+		if err != nil {
+			return fmt.Errorf("could not unmarshal element %d of structure %s: %v", i, s.StrName, err)
+		}
+	}
+	return nil
+}
+
+func marshalElement(element Element) ([]byte, error) {
+	element = asPointer(element)
+	name, fields, err := jsonElement(element)
+	if err != nil {
+		return nil, err
+	}
+	with, err := element.Records()
+	if err != nil {
+		return nil, err
+	}
+	without, err := withSource(element, nil).Records()
+	if err != nil {
+		return nil, err
+	}
+	info := element.(elementInfo).info()
+	trailer := jsonElementInfo{
+		Properties: make([]jsonProperty, len(info.Properties)),
+		Opaque:     info.Opaque,
+		Explicit:   info.explicit,
+		Source:     keptSource(with, without),
+	}
+	for i, property := range info.Properties {
+		trailer.Properties[i] = jsonProperty(property)
+	}
+	objects := [][]byte{}
+	for _, value := range []any{jsonElementHeader{Type: name}, fields, trailer} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, data)
+	}
+	return joinObjects(objects), nil
+}
+
+func unmarshalElement(data []byte) (Element, error) {
+	var header jsonElementHeader
+	err := json.Unmarshal(data, &header)
+	if err != nil {
+		return nil, err
+	}
+	create, ok := jsonElementTypes[header.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown element type %q", header.Type)
+	}
+	element := create()
+	_, fields, err := jsonElement(element)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, fields)
+	if err != nil {
+		return nil, err
+	}
+	var trailer jsonElementInfo
+	err = json.Unmarshal(data, &trailer)
+	if err != nil {
+		return nil, err
+	}
+	info := element.(elementInfo).info()
+	for _, property := range trailer.Properties {
+		info.Properties = append(info.Properties, Property(property))
+	}
+	info.Opaque = trailer.Opaque
+	info.explicit = trailer.Explicit
+	return withSource(element, trailer.Source), nil
+}
+
+// Returns the discriminator of the element pointer and its fields with their JSON keys
+func jsonElement(element Element) (string, any, error) {
+	switch e := element.(type) {
+	case *Boundary:
+		return "boundary", (*jsonBoundary)(e), nil
+	case *Path:
+		return "path", (*jsonPath)(e), nil
+	case *Text:
+		return "text", (*jsonText)(e), nil
+	case *Node:
+		return "node", (*jsonNode)(e), nil
+	case *Box:
+		return "box", (*jsonBox)(e), nil
+	case *SRef:
+		return "sref", (*jsonSRef)(e), nil
+	case *ARef:
+		return "aref", (*jsonARef)(e), nil
+	default:
+		return "", nil, fmt.Errorf("unsupported element type %T", element)
+	}
+}
+
+// Joins JSON objects with distinct keys into one object
+func joinObjects(objects [][]byte) []byte {
+	joined := []byte{'{'}
+	for _, object := range objects {
+		fields := bytes.TrimSpace(object[1 : len(object)-1])
+		if len(fields) == 0 {
+			continue
+		}
+		if len(joined) > 1 {
+			joined = append(joined, ',')
+		}
+		joined = append(joined, fields...)
+	}
+	return append(joined, '}')
+}
+
+// Returns a copy of the element pointer with the source records replaced
+func withSource(element Element, source []Record) Element {
+	switch e := element.(type) {
+	case *Boundary:
+		c := *e
+		c.source = source
+		return &c
+	case *Path:
+		c := *e
+		c.source = source
+		return &c
+	case *Text:
+		c := *e
+		c.source = source
+		return &c
+	case *Node:
+		c := *e
+		c.source = source
+		return &c
+	case *Box:
+		c := *e
+		c.source = source
+		return &c
+	case *SRef:
+		c := *e
+		c.source = source
+		return &c
+	case *ARef:
+		c := *e
+		c.source = source
+		return &c
+	default:
+		return element
+	}
+}
+
+// Returns the records written from source records that differ from a fresh encoding of the same values.
+// Source records are matched by their occurrence among the records of the same type, so all records of a
+// type are kept as soon as one of them differs.
+func keptSource(with []Record, without []Record) []Record {
+	differs := map[string]bool{}
+	for i := range min(len(with), len(without)) {
+		if with[i].Datatype == without[i].Datatype && !bytes.Equal(with[i].Data, without[i].Data) {
+			differs[with[i].Datatype] = true
+		}
+	}
+	kept := []Record{}
+	for _, record := range with {
+		if differs[record.Datatype] {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,182 @@
+package gds
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	original, err := os.ReadFile(testFile)
+	if err != nil {
+		t.Fatalf("could not read test gds file: %v", err)
+	}
+	library, err := ReadGDS(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("could not parse gds file: %v", err)
+	}
+	data, err := json.Marshal(library)
+	if err != nil {
+		t.Fatalf("could not marshal library: %v", err)
+	}
+	// KLayout writes angles of 0 with a non-normalized mantissa
+	if !strings.Contains(string(data), `"source":["RAW 1c05 4000000000000000"]`) {
+		t.Fatalf("angle records are not kept in %s", data)
+	}
+	var unmarshalled Library
+	err = json.Unmarshal(data, &unmarshalled)
+	if err != nil {
+		t.Fatalf("could not unmarshal library: %v", err)
+	}
+	var written bytes.Buffer
+	err = WriteGDS(&written, &unmarshalled)
+	if err != nil {
+		t.Fatalf("could not write library: %v", err)
+	}
+	if !bytes.Equal(original, written.Bytes()) {
+		t.Fatalf("JSON round trip changed the stream")
+	}
+}
+
+func TestJSONKeptSource(t *testing.T) {
+	library := NewLibrary("JSON", 1e-6, 1e-9)
+	cell, err := library.NewCell("CELL")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	cell.AddRect(LayerSpec{1, 0}, 0, 0, 100, 50).Properties = []Property{{1, "ab"}, {2, "cd"}}
+	records, err := library.Records()
+	if err != nil {
+		t.Fatalf("could not produce records: %v", err)
+	}
+	// second property value padded with more zeros than needed
+	for i, record := range records {
+		if record.Datatype == "PROPVALUE" && string(record.Data) == "cd" {
+			records[i] = Record{Size: 8, Datatype: "PROPVALUE", Data: []byte("cd\x00\x00")}
+		}
+	}
+	original := recordsToBytes(records)
+	library, err = ReadGDS(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("could not parse gds file: %v", err)
+	}
+	data, err := json.Marshal(library)
+	if err != nil {
+		t.Fatalf("could not marshal library: %v", err)
+	}
+	var unmarshalled Library
+	err = json.Unmarshal(data, &unmarshalled)
+	if err != nil {
+		t.Fatalf("could not unmarshal library: %v", err)
+	}
+	var written bytes.Buffer
+	err = WriteGDS(&written, &unmarshalled)
+	if err != nil {
+		t.Fatalf("could not write library: %v", err)
+	}
+	assertEqualByteSlice(t, original, written.Bytes())
+}
+
+func TestJSONElements(t *testing.T) {
+	library := NewLibrary("JSON", 1e-6, 1e-9)
+	stamp := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	library.SetTimes(stamp, stamp)
+	e := recordEncoder{}
+	e.add("REFLIBS", "ref")
+	library.Metadata, _ = e.done(nil)
+	cell, err := library.NewCell("CELL")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	cell.SetTimes(stamp, stamp)
+	rect := cell.AddRect(LayerSpec{1, 0}, 0, 0, 100, 50)
+	rect.Properties = []Property{{1, "net1"}}
+	path, err := cell.AddPath(LayerSpec{2, 0}, 10, []int32{0, 0, 100, 0})
+	if err != nil {
+		t.Fatalf("could not add path: %v", err)
+	}
+	path.Opaque = []Record{{Size: 8, Datatype: "7f03", Data: []byte{0, 0, 0, 42}}}
+	cell.AddText(LayerSpec{3, 0}, 5, 5, "label")
+	cell.Elements = append(cell.Elements,
+		Node{Layer: 4, Nodetype: 1, XY: []int32{0, 0}},
+		&Box{Layer: 5, Boxtype: 2, XY: []int32{0, 0, 10, 0, 10, 10, 0, 10, 0, 0}})
+	top, err := library.NewCell("TOP")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	top.SetTimes(stamp, stamp)
+	ref := top.AddInstance("CELL", 10, 20)
+	ref.Strans, ref.Mag, ref.Angle = 0x8000, 2, 90
+	top.AddArray("CELL", 0, 0, 3, 2, 1000, 2000)
+
+	data, err := json.Marshal(library)
+	if err != nil {
+		t.Fatalf("could not marshal library: %v", err)
+	}
+	expected := `{"header":600,"bgnlib":[2024,5,6,7,8,9,2024,5,6,7,8,9],"libname":"JSON","units":[0.001,1e-9],` +
+		`"metadata":["REFLIBS \"ref\""],"structures":[{"bgnstr":[2024,5,6,7,8,9,2024,5,6,7,8,9],"strname":"CELL","elements":[` +
+		`{"type":"boundary","elflags":0,"plex":0,"layer":1,"datatype":0,"xy":[0,0,100,0,100,50,0,50,0,0],"properties":[{"attribute":1,"value":"net1"}]},` +
+		`{"type":"path","elflags":0,"plex":0,"layer":2,"datatype":0,"pathtype":0,"bgnextn":0,"endextn":0,"width":10,"xy":[0,0,100,0],"opaque":["RAW 7f03 0000002a"]},`
+	if !strings.HasPrefix(string(data), expected) {
+		t.Fatalf("unexpected JSON %s", data)
+	}
+	if !strings.Contains(string(data), `{"type":"node","elflags":0,"plex":0,"layer":4,"nodetype":1,"xy":[0,0]}`) {
+		t.Fatalf("unexpected JSON %s", data)
+	}
+
+	var unmarshalled Library
+	err = json.Unmarshal(data, &unmarshalled)
+	if err != nil {
+		t.Fatalf("could not unmarshal library: %v", err)
+	}
+	assertEqual(t, "[CELL TOP]", fmt.Sprint(unmarshalled.StructureOrder))
+	assertEqual(t, fmt.Sprint(library.Metadata), fmt.Sprint(unmarshalled.Metadata))
+	for _, name := range library.StructureOrder {
+		assertEqual(t, library.Structures[name].ListElements(), unmarshalled.Structures[name].ListElements())
+	}
+	assertEqual(t, "[{1 net1}]", fmt.Sprint(unmarshalled.Structures["CELL"].Elements[0].(*Boundary).Properties))
+	assertEqual(t, fmt.Sprint(path.Opaque), fmt.Sprint(unmarshalled.Structures["CELL"].Elements[1].(*Path).Opaque))
+	expectedRecords, err := library.Records()
+	if err != nil {
+		t.Fatalf("could not produce records: %v", err)
+	}
+	records, err := unmarshalled.Records()
+	if err != nil {
+		t.Fatalf("could not produce records: %v", err)
+	}
+	assertEqual(t, fmt.Sprint(expectedRecords), fmt.Sprint(records))
+}
+
+func TestJSONPublicTypes(t *testing.T) {
+	// the element and record types keep the default JSON encoding
+	data, err := json.Marshal(Boundary{Layer: 1, XY: []int32{0, 0}})
+	if err != nil {
+		t.Fatalf("could not marshal boundary: %v", err)
+	}
+	assertEqual(t, `{"ElFlags":0,"Plex":0,"Layer":1,"Datatype":0,"XY":[0,0],"Properties":null,"Opaque":null}`, string(data))
+	data, err = json.Marshal(Record{Size: 6, Datatype: "LAYER", Data: []byte{0, 1}})
+	if err != nil {
+		t.Fatalf("could not marshal record: %v", err)
+	}
+	assertEqual(t, `{"Size":6,"Datatype":"LAYER","Data":"AAE="}`, string(data))
+}
+
+func TestJSONErrors(t *testing.T) {
+	structure := `{"bgnstr":[2024,1,1,0,0,0,2024,1,1,0,0,0],"strname":"A","elements":[%s]}`
+	for name, data := range map[string]string{
+		"element type": fmt.Sprintf(`{"structures":[`+structure+`]}`, `{"type":"circle"}`),
+		"duplicate":    fmt.Sprintf(`{"structures":[`+structure+`,`+structure+`]}`, "", ""),
+		"record":       `{"metadata":["REFLIBS ref"]}`,
+		"null":         `{"structures":[null]}`,
+	} {
+		var library Library
+		err := json.Unmarshal([]byte(data), &library)
+		if err == nil {
+			t.Fatalf("could unmarshal invalid library (%s)", name)
+		}
+	}
+}
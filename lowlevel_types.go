@@ -1,7 +1,9 @@
 package gds
 
 import (
+	"encoding/hex"
 	"fmt"
+	"slices"
 )
 
 var Datatypes map[string]string = map[string]string{
@@ -66,8 +68,8 @@ var RecordTypes map[string]string = map[string]string{
 	"3706": "MASK",         // list of layers
 	"3800": "ENDMASKS",     // end of MASK
 	"3902": "LIBDIRSIZE",   // contains the number of pages in the Library directory
-	"3A06": "SRFNAME",      // contains the name of the Sticks Rules File, if one is bound to the library
-	"3B02": "LIBSECUR",     // contains an array of Access Control List (ACL) data
+	"3a06": "SRFNAME",      // contains the name of the Sticks Rules File, if one is bound to the library
+	"3b02": "LIBSECUR",     // contains an array of Access Control List (ACL) data
 }
 
 var RecordTypesBytes map[string][]byte = map[string][]byte{
@@ -104,6 +106,9 @@ var RecordTypesBytes map[string][]byte = map[string][]byte{
 	"GENERATIONS":  {0x22, 0x02}, // number of deleted structure ?????
 	"ATTRTABLE":    {0x23, 0x06}, // attribute table, used in combination with element properties
 	"ELFLAGS":      {0x26, 0x01}, // template data
+	"ELKEY":        {0x27, 0x03}, // from KLayout Source Code ???
+	"LINKTYPE":     {0x28, 0x02}, // unreleased Feature
+	"LINKKEYS":     {0x29, 0x03}, // unreleased Feature
 	"NODETYPE":     {0x2a, 0x02}, // node type number for NODE element
 	"PROPATTR":     {0x2b, 0x02}, // attribute number
 	"PROPVALUE":    {0x2c, 0x06}, // attribute name
@@ -114,6 +119,7 @@ var RecordTypesBytes map[string][]byte = map[string][]byte{
 	"ENDEXTN":      {0x31, 0x03}, // path type 4 extension end
 	"TAPENUM":      {0x32, 0x02}, // tape number
 	"TAPECODE":     {0x33, 0x02}, // tape code
+	"RESERVED":     {0x35, 0x03}, // type was used for NUMTYPES but was not required
 	"FORMAT":       {0x36, 0x02}, // format type
 	"MASK":         {0x37, 0x06}, // list of layers
 	"ENDMASKS":     {0x38, 0x00}, // end of MASK
@@ -141,102 +147,48 @@ type Record struct {
 	Data     []byte
 }
 
+// Records holding a list of values, all other records with data hold a single value
+var arrayRecords = map[string]bool{
+	"BGNLIB":   true,
+	"UNITS":    true,
+	"BGNSTR":   true,
+	"XY":       true,
+	"COLROW":   true,
+	"LINKKEYS": true,
+	"LIBSECUR": true,
+}
+
+// GetData decodes the record data according to the data type in the low byte of the record type
 func (r Record) GetData() (any, error) {
-	switch r.Datatype {
-	case "HEADER":
-		return getDataPoint[int16](r)
-	case "BGNLIB":
-		return getDataSlice[int16](r)
-	case "LIBNAME":
-		return getDataString(r)
-	case "UNITS":
-		return getRealSlice(r)
-	case "ENDLIB":
-		return "No data", nil
-	case "BGNSTR":
-		return getDataSlice[int16](r)
-	case "STRNAME":
-		return getDataString(r)
-	case "ENDSTR":
-		return "No data", nil
-	case "BOUNDARY":
-		return "No data", nil
-	case "PATH":
-		return "No data", nil
-	case "SREF":
-		return "No data", nil
-	case "AREF":
-		return "No data", nil
-	case "TEXT":
-		return "No data", nil
-	case "LAYER":
-		return getDataPoint[int16](r)
-	case "DATATYPE":
-		return getDataPoint[int16](r)
-	case "WIDTH":
-		return getDataPoint[int32](r)
-	case "XY":
-		return getDataSlice[int32](r)
-	case "ENDEL":
-		return "No data", nil
-	case "SNAME":
-		return getDataString(r)
-	case "COLROW":
-		return getDataSlice[int16](r)
-	case "NODE":
+	typeBytes, ok := RecordTypesBytes[r.Datatype]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRecord, r.Datatype)
+	}
+	array := arrayRecords[r.Datatype]
+	switch typeBytes[1] {
+	case 0x00:
 		return "No data", nil
-	case "TEXTTYPE":
-		return getDataPoint[int16](r)
-	case "PRESENTATION":
-		return getDataPoint[uint16](r)
-	case "STRINGBODY":
-		return getDataString(r)
-	case "STRANS":
+	case 0x01:
 		return getDataPoint[uint16](r)
-	case "MAG":
-		return getRealPoint(r)
-	case "ANGLE":
-		return getRealPoint(r)
-	case "REFLIBS":
-		return getDataString(r)
-	case "FONTS":
-		return getDataString(r)
-	case "PATHTYPE":
-		return getDataPoint[int16](r)
-	case "GENERATIONS":
+	case 0x02:
+		if array {
+			return getDataSlice[int16](r)
+		}
 		return getDataPoint[int16](r)
-	case "ATTRTABLE":
-		return getDataString(r)
-	case "ELFLAGS":
-		return getDataPoint[uint16](r)
-	case "NODETYPE":
-		return getDataPoint[int16](r)
-	case "PROPATTR":
-		return getDataPoint[int16](r)
-	case "PROPVALUE":
-		return getDataString(r)
-	case "BOX":
-		return "No data", nil
-	case "BOXTYPE":
-		return getDataPoint[int16](r)
-	case "PLEX":
-		return getDataPoint[int32](r)
-	case "BGNEXTN":
-		return getDataPoint[int32](r)
-	case "ENDEXTN":
+	case 0x03:
+		if array {
+			return getDataSlice[int32](r)
+		}
 		return getDataPoint[int32](r)
-	case "TAPENUM":
-		return getDataPoint[int16](r)
-	case "TAPECODE":
-		return getDataPoint[int16](r)
-	case "FORMAT":
-		return getDataPoint[int16](r)
-	case "MASK":
+	case 0x05:
+		if array {
+			return getRealSlice(r)
+		}
+		return getRealPoint(r)
+	case 0x06:
 		return getDataString(r)
-	case "ENDMASKS":
-		return "No data", nil
 	default:
-		panic("unexpected datatype")
+		return nil, fmt.Errorf("unsupported data type %02x of record type %s", typeBytes[1], r.Datatype)
 	}
 }
 
@@ -249,13 +201,25 @@ func (r Record) String() string {
 }
 
 func (r Record) Bytes() []byte {
-	resultBytes := []byte{}
+	resultBytes := make([]byte, 0, HEADERSIZE+len(r.Data))
 	resultBytes = append(resultBytes, byte(r.Size>>8), byte(r.Size))
-	resultBytes = append(resultBytes, RecordTypesBytes[r.Datatype]...)
+	resultBytes = append(resultBytes, recordTypeBytes(r.Datatype)...)
 	resultBytes = append(resultBytes, r.Data...)
 	return resultBytes
 }
 
+// Returns the two type bytes of a record, opaque records of unknown type use their hex code as Datatype
+func recordTypeBytes(datatype string) []byte {
+	if typeBytes, ok := RecordTypesBytes[datatype]; ok {
+		return typeBytes
+	}
+	typeBytes, err := hex.DecodeString(datatype)
+	if err != nil || len(typeBytes) != 2 {
+		return []byte{0xff, 0xff}
+	}
+	return typeBytes
+}
+
 type Element interface {
 	String() string
 	GetData() any
@@ -270,11 +234,20 @@ type Library struct {
 	LibName    string
 	Units      []float64
 	Structures map[string]*Structure
+	// Names of the structures in the order they were read or created, used for OrderInput
+	StructureOrder []string
+	// Optional header records (REFLIBS, FONTS, ATTRTABLE, GENERATIONS, FORMAT, ...) in the order they were read
+	Metadata []Record
+	// Records that could not be decoded in lenient mode, written back before ENDLIB
+	Opaque []Record
+	source []Record
 }
 
 func (l Library) String() string {
 	structureInfo := "\n"
-	for _, structure := range l.Structures {
+	names, _ := l.StructureNames(OrderInput)
+	for _, name := range names {
+		structure := l.Structures[name]
 		structureInfo += "      " + structure.StrName + "\n"
 		structureElements := structure.ListElements()
 		structureInfo += structureElements
@@ -286,17 +259,79 @@ func (l Library) String() string {
    Structures:%s`, l.Header, l.LibName, l.Units, structureInfo)
 }
 func (l Library) Records() ([]Record, error) {
-	records, err := fieldsToRecords(l)
+	return l.RecordsWithOptions(WriteOptions{})
+}
+
+// RecordsWithOptions returns the records of the library with structures in the order given by opts
+func (l Library) RecordsWithOptions(opts WriteOptions) ([]Record, error) {
+	if !opts.Timestamp.IsZero() {
+		l = l.stamped(opts.Timestamp)
+	}
+	l, err := l.limitPoints(opts.MaxPoints, opts.Fracture)
+	if err != nil {
+		return []Record{}, fmt.Errorf("could not produce records for library: %v", err)
+	}
+	records, err := l.headerRecords()
+	if err != nil {
+		return []Record{}, fmt.Errorf("could not produce records for library: %v", err)
+	}
+	names, err := l.StructureNames(opts.Order)
 	if err != nil {
 		return []Record{}, fmt.Errorf("could not produce records for library: %v", err)
 	}
+	for _, name := range names {
+		structureRecords, err := l.Structures[name].Records()
+		if err != nil {
+			return []Record{}, fmt.Errorf("could not produce records for library: %v", err)
+		}
+		records = append(records, structureRecords...)
+	}
+	records = append(records, l.Opaque...)
 	return wrapStartEnd("BGNLIB", records), nil
 }
 
+// Returns the library header records, metadata records are placed where the stream format expects them:
+// LIBDIRSIZE, SRFNAME and LIBSECUR before LIBNAME, all others between LIBNAME and UNITS
+func (l Library) headerRecords() ([]Record, error) {
+	e := recordEncoder{}
+	e.add("HEADER", l.Header)
+	e.add("BGNLIB", l.BgnLib)
+	e.add("LIBNAME", l.LibName)
+	e.add("UNITS", l.Units)
+	fieldRecords, err := e.done(l.source)
+	if err != nil {
+		return []Record{}, err
+	}
+	beforeLibName := []Record{}
+	beforeUnits := []Record{}
+	for _, record := range l.Metadata {
+		switch record.Datatype {
+		case "LIBDIRSIZE", "SRFNAME", "LIBSECUR":
+			beforeLibName = append(beforeLibName, record)
+		default:
+			beforeUnits = append(beforeUnits, record)
+		}
+	}
+	records := []Record{}
+	for _, record := range fieldRecords {
+		switch record.Datatype {
+		case "LIBNAME":
+			records = append(records, beforeLibName...)
+		case "UNITS":
+			records = append(records, beforeUnits...)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
 type Structure struct {
 	BgnStr   []int16
 	StrName  string
 	Elements []Element
+	// Records that could not be decoded in lenient mode, written back before ENDSTR
+	Opaque []Record
+	source []Record
 }
 
 func (s Structure) String() string {
@@ -311,19 +346,59 @@ func (s Structure) ListElements() string {
 	return result
 }
 func (s Structure) Records() ([]Record, error) {
-	records, err := fieldsToRecords(s)
+	e := recordEncoder{}
+	e.add("BGNSTR", s.BgnStr)
+	e.add("STRNAME", s.StrName)
+	records, err := e.done(s.source)
 	if err != nil {
 		return []Record{}, fmt.Errorf("could not produce records for structure: %v", err)
 	}
+	records = slices.Grow(records, 8*len(s.Elements)+1)
+	for _, element := range s.Elements {
+		elementRecords, err := element.Records()
+		if err != nil {
+			return []Record{}, fmt.Errorf("could not produce records for structure: %v", err)
+		}
+		records = append(records, elementRecords...)
+	}
+	records = append(records, s.Opaque...)
 	return wrapStartEnd("BGNSTR", records), nil
 }
 
+// Property is an attribute/value pair attached to an element by PROPATTR and PROPVALUE records
+type Property struct {
+	Attribute int16
+	Value     string
+}
+
+// ElementInfo is embedded in all elements and holds the records that are not part of the element data
+type ElementInfo struct {
+	// Properties of the element, written in order before ENDEL
+	Properties []Property
+	// Records that could not be decoded in lenient mode, written back before ENDEL
+	Opaque []Record
+	// optional records that were present when the element was read, they are written even if they hold their default
+	explicit []string
+	// records the element was decoded from, reused on write where the values are unchanged
+	source []Record
+}
+
+// Gives access to the embedded ElementInfo of element pointers
+type elementInfo interface {
+	info() *ElementInfo
+}
+
+func (i *ElementInfo) info() *ElementInfo {
+	return i
+}
+
 type Boundary struct {
 	ElFlags  uint16
 	Plex     int32
 	Layer    int16
 	Datatype int16
 	XY       []int32
+	ElementInfo
 }
 
 func (b Boundary) GetData() any {
@@ -333,10 +408,18 @@ func (b Boundary) String() string {
 	return fmt.Sprintf("Boundary - ElFlags: %v, Plex: %v, Layer: %v, Datatype: %v, XY: %v", b.ElFlags, b.Plex, b.Layer, b.Datatype, b.XY)
 }
 func (b Boundary) Records() ([]Record, error) {
-	records, err := fieldsToRecords(b)
+	e := recordEncoder{explicit: b.explicit}
+	e.optional("ELFLAGS", b.ElFlags, b.ElFlags == 0)
+	e.optional("PLEX", b.Plex, b.Plex == 0)
+	e.add("LAYER", b.Layer)
+	e.add("DATATYPE", b.Datatype)
+	e.add("XY", b.XY)
+	e.properties(b.Properties)
+	records, err := e.done(b.source)
 	if err != nil {
 		return []Record{}, fmt.Errorf("could not produce records for boundary: %v", err)
 	}
+	records = append(records, b.Opaque...)
 	return wrapStartEnd("BOUNDARY", records), nil
 }
 func (b Boundary) GetLayer() string {
@@ -354,11 +437,14 @@ type Path struct {
 	Plex     int32
 	Layer    int16
 	Datatype int16
+	// -1 if the PATHTYPE record is missing
 	Pathtype int16
 	Bgnextn  int32
 	Endextn  int32
-	Width    int32
-	XY       []int32
+	// -1 if the WIDTH record is missing
+	Width int32
+	XY    []int32
+	ElementInfo
 }
 
 func (p Path) GetData() any {
@@ -371,15 +457,41 @@ func (p Path) GetPathType() int16 {
 	return p.Pathtype
 }
 
+// Path type and width with the stream format defaults for missing PATHTYPE and WIDTH records, which decode as -1
+func (p Path) pathtype() int16 {
+	if p.Pathtype == -1 {
+		return 0
+	}
+	return p.Pathtype
+}
+func (p Path) width() int32 {
+	if p.Width == -1 {
+		return 0
+	}
+	return p.Width
+}
+
 func (p Path) String() string {
 	return fmt.Sprintf("Path - ElFlags: %v, Plex: %v, Layer: %v, Datatype: %v, Pathtype: %v, Width: %v, XY: %v",
 		p.ElFlags, p.Plex, p.Layer, p.Datatype, p.Pathtype, p.Width, p.XY)
 }
 func (p Path) Records() ([]Record, error) {
-	records, err := fieldsToRecords(p)
+	e := recordEncoder{explicit: p.explicit}
+	e.optional("ELFLAGS", p.ElFlags, p.ElFlags == 0)
+	e.optional("PLEX", p.Plex, p.Plex == 0)
+	e.add("LAYER", p.Layer)
+	e.add("DATATYPE", p.Datatype)
+	e.optional("PATHTYPE", p.Pathtype, p.Pathtype == -1)
+	e.optional("WIDTH", p.Width, p.Width == -1)
+	e.optional("BGNEXTN", p.Bgnextn, p.Bgnextn == 0)
+	e.optional("ENDEXTN", p.Endextn, p.Endextn == 0)
+	e.add("XY", p.XY)
+	e.properties(p.Properties)
+	records, err := e.done(p.source)
 	if err != nil {
 		return []Record{}, fmt.Errorf("could not produce records for path: %v", err)
 	}
+	records = append(records, p.Opaque...)
 	return wrapStartEnd("PATH", records), nil
 }
 func (p Path) GetLayer() string {
@@ -400,6 +512,7 @@ type Text struct {
 	Angle        float64
 	XY           []int32
 	StringBody   string
+	ElementInfo
 }
 
 func (t Text) GetData() any {
@@ -409,11 +522,22 @@ func (t Text) String() string {
 	return fmt.Sprintf("Text - ElFlags: %v, Plex: %v, Layer: %v, XY: %v, String: %v", t.ElFlags, t.Plex, t.Layer, t.XY, t.StringBody)
 }
 func (t Text) Records() ([]Record, error) {
-	records, err := fieldsToRecords(t)
+	e := recordEncoder{explicit: t.explicit}
+	e.optional("ELFLAGS", t.ElFlags, t.ElFlags == 0)
+	e.optional("PLEX", t.Plex, t.Plex == 0)
+	e.add("LAYER", t.Layer)
+	e.add("TEXTTYPE", t.Texttype)
+	e.optional("PRESENTATION", t.Presentation, t.Presentation == 0)
+	e.transformation(t.Strans, t.Mag, t.Angle)
+	e.add("XY", t.XY)
+	e.add("STRINGBODY", t.StringBody)
+	e.properties(t.Properties)
+	records, err := e.done(t.source)
 	if err != nil {
 		return []Record{}, fmt.Errorf("could not produce records for text: %v", err)
 	}
-	return wrapStartEnd("TEXT", records), err
+	records = append(records, t.Opaque...)
+	return wrapStartEnd("TEXT", records), nil
 }
 func (t Text) GetLayer() string {
 	return fmt.Sprintf("%d/%d", t.Layer, t.Texttype)
@@ -428,6 +552,7 @@ type Node struct {
 	Layer    int16
 	Nodetype int16
 	XY       []int32
+	ElementInfo
 }
 
 func (n Node) GetData() any {
@@ -437,10 +562,18 @@ func (n Node) String() string {
 	return fmt.Sprintf("Node - ElFlags: %v, Plex: %v, Layer: %v, Nodetype: %v, XY: %v", n.ElFlags, n.Plex, n.Layer, n.Nodetype, n.XY)
 }
 func (n Node) Records() ([]Record, error) {
-	records, err := fieldsToRecords(n)
+	e := recordEncoder{explicit: n.explicit}
+	e.optional("ELFLAGS", n.ElFlags, n.ElFlags == 0)
+	e.optional("PLEX", n.Plex, n.Plex == 0)
+	e.add("LAYER", n.Layer)
+	e.add("NODETYPE", n.Nodetype)
+	e.add("XY", n.XY)
+	e.properties(n.Properties)
+	records, err := e.done(n.source)
 	if err != nil {
 		return []Record{}, fmt.Errorf("could not produce records for node: %v", err)
 	}
+	records = append(records, n.Opaque...)
 	return wrapStartEnd("NODE", records), nil
 }
 func (n Node) GetLayer() string {
@@ -456,6 +589,7 @@ type Box struct {
 	Layer   int16
 	Boxtype int16
 	XY      []int32
+	ElementInfo
 }
 
 func (b Box) GetData() any {
@@ -465,10 +599,18 @@ func (b Box) String() string {
 	return fmt.Sprintf("Box - ElFlags: %v, Plex: %v, Layer: %v, Boxtype: %v, XY: %v", b.ElFlags, b.Plex, b.Layer, b.Boxtype, b.XY)
 }
 func (b Box) Records() ([]Record, error) {
-	records, err := fieldsToRecords(b)
+	e := recordEncoder{explicit: b.explicit}
+	e.optional("ELFLAGS", b.ElFlags, b.ElFlags == 0)
+	e.optional("PLEX", b.Plex, b.Plex == 0)
+	e.add("LAYER", b.Layer)
+	e.add("BOXTYPE", b.Boxtype)
+	e.add("XY", b.XY)
+	e.properties(b.Properties)
+	records, err := e.done(b.source)
 	if err != nil {
 		return []Record{}, fmt.Errorf("could not produce records for box: %v", err)
 	}
+	records = append(records, b.Opaque...)
 	return wrapStartEnd("BOX", records), nil
 }
 func (b Box) GetLayer() string {
@@ -489,6 +631,7 @@ type SRef struct {
 	Mag     float64
 	Angle   float64
 	XY      []int32
+	ElementInfo
 }
 
 func (s SRef) GetData() any {
@@ -499,12 +642,23 @@ func (s SRef) String() string {
 		s.ElFlags, s.Plex, s.Sname, s.Strans, s.Mag, s.Angle, s.XY)
 }
 func (s SRef) Records() ([]Record, error) {
-	records, err := fieldsToRecords(s)
+	e := recordEncoder{explicit: s.explicit}
+	e.optional("ELFLAGS", s.ElFlags, s.ElFlags == 0)
+	e.optional("PLEX", s.Plex, s.Plex == 0)
+	e.add("SNAME", s.Sname)
+	e.transformation(s.Strans, s.Mag, s.Angle)
+	e.add("XY", s.XY)
+	e.properties(s.Properties)
+	records, err := e.done(s.source)
 	if err != nil {
 		return []Record{}, fmt.Errorf("could not produce records for sref: %v", err)
 	}
+	records = append(records, s.Opaque...)
 	return wrapStartEnd("SREF", records), nil
 }
+func (s SRef) GetSname() string {
+	return s.Sname
+}
 func (s SRef) GetLayer() string {
 	return "cellref"
 }
@@ -521,6 +675,7 @@ type ARef struct {
 	Angle   float64
 	Colrow  []int16
 	XY      []int32
+	ElementInfo
 }
 
 func (a ARef) GetData() any {
@@ -531,12 +686,24 @@ func (a ARef) String() string {
 		a.ElFlags, a.Plex, a.Sname, a.Strans, a.Mag, a.Angle, a.Colrow, a.XY)
 }
 func (a ARef) Records() ([]Record, error) {
-	records, err := fieldsToRecords(a)
+	e := recordEncoder{explicit: a.explicit}
+	e.optional("ELFLAGS", a.ElFlags, a.ElFlags == 0)
+	e.optional("PLEX", a.Plex, a.Plex == 0)
+	e.add("SNAME", a.Sname)
+	e.transformation(a.Strans, a.Mag, a.Angle)
+	e.add("COLROW", a.Colrow)
+	e.add("XY", a.XY)
+	e.properties(a.Properties)
+	records, err := e.done(a.source)
 	if err != nil {
 		return []Record{}, fmt.Errorf("could not produce records for aref: %v", err)
 	}
+	records = append(records, a.Opaque...)
 	return wrapStartEnd("AREF", records), nil
 }
+func (a ARef) GetSname() string {
+	return a.Sname
+}
 func (a ARef) GetLayer() string {
 	return "cellref"
 }
@@ -544,9 +711,32 @@ func (a ARef) Type() ElementType {
 	return ARefType
 }
 
+// Returns a pointer to the element, elements created as values are copied.
+// Allows type switches to handle decoded (pointer) and hand-made (value) elements alike.
+func asPointer(element Element) Element {
+	switch e := element.(type) {
+	case Boundary:
+		return &e
+	case Path:
+		return &e
+	case Text:
+		return &e
+	case Node:
+		return &e
+	case Box:
+		return &e
+	case SRef:
+		return &e
+	case ARef:
+		return &e
+	default:
+		return element
+	}
+}
+
 // Wraps a record slice with their start record "{ELEMENTTYPE}" and end record "ENDEL"
 func wrapStartEnd(elementType string, records []Record) []Record {
-	wrappedRecords := []Record{}
+	wrappedRecords := make([]Record, 0, len(records)+2)
 	if elementType == "BGNSTR" {
 		return append(records, Record{Size: 4, Datatype: "ENDSTR", Data: []byte{}})
 	} else if elementType == "BGNLIB" {
@@ -0,0 +1,235 @@
+package gds
+
+import (
+	"fmt"
+	"math"
+)
+
+// Number of segments used to approximate the half circle of a round path end
+const roundEndSegments = 8
+
+// PolygonArea returns the area of a polygon given as x0, y0, x1, y1, ... in square database units,
+// the closing point is optional
+func PolygonArea(xy []int32) float64 {
+	return math.Abs(float64(signedArea(openRing(xy)))) / 2
+}
+
+// PolygonPerimeter returns the length of the outline of a polygon in database units, the closing point is optional
+func PolygonPerimeter(xy []int32) float64 {
+	ring := openRing(xy)
+	n := len(ring) / 2
+	perimeter := 0.0
+	for i := range n {
+		j := (i + 1) % n
+		perimeter += math.Hypot(float64(ring[2*j]-ring[2*i]), float64(ring[2*j+1]-ring[2*i+1]))
+	}
+	return perimeter
+}
+
+// PathOutline converts a path to a polygon with miter joins. The ends are extended by half the width for
+// pathtype 2, by BGNEXTN and ENDEXTN for pathtype 4 and approximated by half circles for pathtype 1.
+// Paths without length return nil.
+func PathOutline(path *Path) []int32 {
+	var bgnextn, endextn float64
+	switch path.pathtype() {
+	case 2:
+		bgnextn, endextn = math.Abs(float64(path.width()))/2, math.Abs(float64(path.width()))/2
+	case 4:
+		bgnextn, endextn = float64(path.Bgnextn), float64(path.Endextn)
+	}
+	return pathOutline(path.XY, path.width(), path.pathtype() == 1, bgnextn, endextn)
+}
+
+func pathOutline(xy []int32, width int32, round bool, bgnextn, endextn float64) []int32 {
+	points := removeRepeatedPathPoints(xy)
+	n := len(points) / 2
+	halfWidth := math.Abs(float64(width)) / 2
+	if n < 2 || halfWidth == 0 {
+		return nil
+	}
+	// unit directions of all segments
+	dirs := make([][2]float64, n-1)
+	for i := range n - 1 {
+		dx, dy := float64(points[2*i+2]-points[2*i]), float64(points[2*i+3]-points[2*i+1])
+		length := math.Hypot(dx, dy)
+		dirs[i] = [2]float64{dx / length, dy / length}
+	}
+	point := func(i int) (float64, float64) { return float64(points[2*i]), float64(points[2*i+1]) }
+	left := make([][2]float64, n)
+	for i := range n {
+		x, y := point(i)
+		in, out := dirs[max(i-1, 0)], dirs[min(i, n-2)]
+		switch i {
+		case 0:
+			x, y = x-in[0]*bgnextn, y-in[1]*bgnextn
+		case n - 1:
+			x, y = x+out[0]*endextn, y+out[1]*endextn
+		}
+		// the miter offset is the sum of both normals scaled to keep the distance to both segments
+		nx, ny := -in[1]-out[1], in[0]+out[0]
+		scale := 1 + in[0]*out[0] + in[1]*out[1]
+		if scale < 1e-9 {
+			// the path reverses, use the normal of the incoming segment
+			nx, ny, scale = -2*in[1], 2*in[0], 2
+		}
+		left[i] = [2]float64{x + nx*halfWidth/scale, y + ny*halfWidth/scale}
+	}
+	outline := make([]int32, 0, 4*n+4*roundEndSegments)
+	add := func(x, y float64) {
+		outline = append(outline, int32(math.Round(x)), int32(math.Round(y)))
+	}
+	// right side of the path is the left side mirrored at the center line
+	right := func(i int) (float64, float64) {
+		x, y := point(i)
+		switch i {
+		case 0:
+			x, y = x-dirs[0][0]*bgnextn, y-dirs[0][1]*bgnextn
+		case n - 1:
+			x, y = x+dirs[n-2][0]*endextn, y+dirs[n-2][1]*endextn
+		}
+		return 2*x - left[i][0], 2*y - left[i][1]
+	}
+	// half circle around point i, clockwise like the rest of the outline, starting at the given angle
+	arc := func(i int, start float64) {
+		x, y := point(i)
+		for k := 1; k < roundEndSegments; k++ {
+			sin, cos := math.Sincos(start - math.Pi*float64(k)/roundEndSegments)
+			add(x+cos*halfWidth, y+sin*halfWidth)
+		}
+	}
+	for i := range n {
+		add(left[i][0], left[i][1])
+	}
+	if round {
+		arc(n-1, math.Atan2(dirs[n-2][0], -dirs[n-2][1]))
+	}
+	for i := n - 1; i >= 0; i-- {
+		add(right(i))
+	}
+	if round {
+		arc(0, math.Atan2(dirs[0][0], -dirs[0][1])+math.Pi)
+	}
+	// arcs start tangent to the sides and rounding can put points on a line
+	return RemoveCollinearPoints(outline)
+}
+
+// ShapeMetrics sums up shapes, lengths in database units and areas in square database units.
+// Overlapping shapes are counted separately, Density merges them.
+type ShapeMetrics struct {
+	Shapes    int
+	Vertices  int
+	Area      float64
+	Perimeter float64
+}
+
+// add adds metrics placed count times with magnification mag
+func (s *ShapeMetrics) add(other ShapeMetrics, count int, mag float64) {
+	s.Shapes += count * other.Shapes
+	s.Vertices += count * other.Vertices
+	s.Area += float64(count) * other.Area * mag * mag
+	s.Perimeter += float64(count) * other.Perimeter * math.Abs(mag)
+}
+
+func (s ShapeMetrics) String() string {
+	return fmt.Sprintf("%d shapes, %d vertices, area %g, perimeter %g", s.Shapes, s.Vertices, s.Area, s.Perimeter)
+}
+
+func polygonMetrics(xy []int32) ShapeMetrics {
+	return ShapeMetrics{Shapes: 1, Vertices: len(openRing(xy)) / 2, Area: PolygonArea(xy), Perimeter: PolygonPerimeter(xy)}
+}
+
+// Paths count their center line points as vertices, area and perimeter are taken from the outline
+func pathMetrics(xy []int32, outline []int32) ShapeMetrics {
+	return ShapeMetrics{Shapes: 1, Vertices: len(xy) / 2, Area: PolygonArea(outline), Perimeter: PolygonPerimeter(outline)}
+}
+
+// Metrics sums up the polygons of the layer
+func (p PolygonLayer) Metrics() ShapeMetrics {
+	metrics := ShapeMetrics{}
+	for _, polygon := range p.Polygons {
+		metrics.add(polygonMetrics(polygon), 1, 1)
+	}
+	return metrics
+}
+
+// Metrics sums up the paths of the layer, path ends are flush or extended by half the width as the layer
+// does not keep custom extensions
+func (p PathLayer) Metrics() ShapeMetrics {
+	metrics := ShapeMetrics{}
+	for i, xy := range p.Paths {
+		path := &Path{Pathtype: p.PathTypes[i], Width: p.Widths[i], XY: xy}
+		metrics.add(pathMetrics(xy, PathOutline(path)), 1, 1)
+	}
+	return metrics
+}
+
+// LayerMetrics returns the metrics of all boundaries, boxes and paths placed in cell per layer/datatype, e.g. the
+// total area of a metal layer. Every structure is measured once and multiplied by the number of its placements,
+// arrays count columns times rows, so the hierarchy is not flattened.
+func (l *Library) LayerMetrics(cell string) (map[string]ShapeMetrics, error) {
+	if _, ok := l.Structures[cell]; !ok {
+		return nil, fmt.Errorf("cell with name %s does not exist", cell)
+	}
+	metrics, err := l.structureMetrics(cell, map[string]map[string]ShapeMetrics{}, map[string]bool{})
+	if err != nil {
+		return nil, fmt.Errorf("could not compute metrics of cell %s: %v", cell, err)
+	}
+	return metrics, nil
+}
+
+// Returns the metrics of a structure including its references, results are cached per structure
+func (l *Library) structureMetrics(name string, cache map[string]map[string]ShapeMetrics, visiting map[string]bool) (map[string]ShapeMetrics, error) {
+	if metrics, ok := cache[name]; ok {
+		return metrics, nil
+	}
+	if visiting[name] {
+		return nil, fmt.Errorf("reference cycle through structure %s", name)
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+	structure, ok := l.Structures[name]
+	if !ok {
+		return nil, fmt.Errorf("reference to undefined structure %s", name)
+	}
+	result := map[string]ShapeMetrics{}
+	addMetrics := func(layer string, metrics ShapeMetrics, count int, mag float64) {
+		total := result[layer]
+		total.add(metrics, count, mag)
+		result[layer] = total
+	}
+	addReference := func(sname string, count int, mag float64) error {
+		child, err := l.structureMetrics(sname, cache, visiting)
+		if err != nil {
+			return err
+		}
+		for layer, metrics := range child {
+			addMetrics(layer, metrics, count, mag)
+		}
+		return nil
+	}
+	for _, element := range structure.Elements {
+		switch e := asPointer(element).(type) {
+		case *Boundary:
+			addMetrics(e.GetLayer(), polygonMetrics(e.XY), 1, 1)
+		case *Box:
+			addMetrics(e.GetLayer(), polygonMetrics(e.XY), 1, 1)
+		case *Path:
+			addMetrics(e.GetLayer(), pathMetrics(e.XY, PathOutline(e)), 1, 1)
+		case *SRef:
+			err := addReference(e.Sname, 1, e.Mag)
+			if err != nil {
+				return nil, err
+			}
+		case *ARef:
+			if len(e.Colrow) != 2 {
+				return nil, fmt.Errorf("aref to %s in %s needs columns and rows, got %v", e.Sname, name, e.Colrow)
+			}
+			err := addReference(e.Sname, max(int(e.Colrow[0]), 0)*max(int(e.Colrow[1]), 0), e.Mag)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	cache[name] = result
+	return result, nil
+}
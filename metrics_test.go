@@ -0,0 +1,84 @@
+package gds
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPolygonMetrics(t *testing.T) {
+	lshape := []int32{0, 0, 20, 0, 20, 10, 10, 10, 10, 20, 0, 20, 0, 0}
+	assertEqual(t, 300.0, PolygonArea(lshape))
+	assertEqual(t, 80.0, PolygonPerimeter(lshape))
+	assertEqual(t, 12.0, PolygonPerimeter([]int32{0, 0, 3, 0, 0, 4}))
+}
+
+func TestPathOutline(t *testing.T) {
+	path := &Path{Width: 10, XY: []int32{0, 0, 100, 0, 100, 50}}
+	outline := PathOutline(path)
+	assertEqual(t, 12, len(outline))
+	// two flush segments with a mitered corner
+	assertEqual(t, 1500.0, PolygonArea(outline))
+	assertEqual(t, 0, len(CheckPolygon(outline, GeometryOptions{})))
+
+	path.Pathtype = 2
+	assertEqual(t, 1600.0, PolygonArea(PathOutline(path)))
+	path.Pathtype, path.Bgnextn, path.Endextn = 4, 20, 0
+	assertEqual(t, 1700.0, PolygonArea(PathOutline(path)))
+
+	path.Pathtype = 1
+	round := PolygonArea(PathOutline(path))
+	exact := 1500 + math.Pi*25
+	if math.Abs(round-exact) > 0.02*exact {
+		t.Fatalf("round path area %g is not close to %g", round, exact)
+	}
+	assertEqual(t, 0, len(CheckPolygon(PathOutline(path), GeometryOptions{})))
+
+	assertEqual(t, 0, len(PathOutline(&Path{Width: 10, XY: []int32{5, 5, 5, 5}})))
+}
+
+func TestLayerMetrics(t *testing.T) {
+	library := NewLibrary("METRICS", 1e-6, 1e-9)
+	via, err := library.NewCell("VIA")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	via.AddRect(LayerSpec{2, 0}, 0, 0, 10, 10)
+	cell, err := library.NewCell("CELL")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	cell.AddRect(LayerSpec{1, 0}, 0, 0, 100, 50)
+	cell.AddArray("VIA", 0, 0, 4, 2, 20, 20)
+	_, err = cell.AddPath(LayerSpec{3, 0}, 10, []int32{0, 0, 100, 0})
+	if err != nil {
+		t.Fatalf("could not add path: %v", err)
+	}
+	top, err := library.NewCell("TOP")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	top.AddInstance("CELL", 0, 0)
+	top.AddInstance("CELL", 1000, 0).Mag = 2
+	top.AddInstance("VIA", 0, 1000).Angle = 30
+
+	metrics, err := library.LayerMetrics("TOP")
+	if err != nil {
+		t.Fatalf("could not compute metrics: %v", err)
+	}
+	assertEqual(t, ShapeMetrics{Shapes: 2, Vertices: 8, Area: 5000 * 5, Perimeter: 300 * 3}, metrics["1/0"])
+	assertEqual(t, ShapeMetrics{Shapes: 17, Vertices: 68, Area: 100 * (8 + 8*4 + 1), Perimeter: 40 * (8 + 8*2 + 1)}, metrics["2/0"])
+	assertEqual(t, ShapeMetrics{Shapes: 2, Vertices: 4, Area: 1000 * 5, Perimeter: 220 * 3}, metrics["3/0"])
+
+	// the flattened layer of the cell holds the same shapes
+	layers, err := library.GetLayermapPolygons("CELL")
+	if err != nil {
+		t.Fatalf("could not extract layermap polygons: %v", err)
+	}
+	assertEqual(t, ShapeMetrics{Shapes: 8, Vertices: 32, Area: 800, Perimeter: 320}, layers["2/0"].Metrics())
+
+	cell.AddInstance("TOP", 0, 0)
+	_, err = library.LayerMetrics("TOP")
+	if err == nil {
+		t.Fatalf("could compute metrics of cyclic hierarchy")
+	}
+}
@@ -0,0 +1,156 @@
+package gds
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// OASIS (SEMI P39) support, see https://www.klayout.de/oasis_spec.pdf and the KLayout reader for reference
+//
+// OASIS files are mapped onto the same types as GDSII streams: rectangles, polygons, trapezoids and circles become
+// boundaries, placements become SREFs or AREFs and S_GDS_PROPERTY properties become the Properties of the element,
+// written as PROPATTR/PROPVALUE records to GDSII streams. Other properties, layer names and extensions (XNAME, XELEMENT, XGEOMETRY) are
+// skipped. Validation signatures are read but not checked.
+
+const oasisMagic = "%SEMI-OASIS\r\n"
+
+// Record IDs of OASIS records
+const (
+	oasisPad            = 0
+	oasisStart          = 1
+	oasisEnd            = 2
+	oasisCellName       = 3
+	oasisCellNameRef    = 4
+	oasisTextString     = 5
+	oasisTextStringRef  = 6
+	oasisPropName       = 7
+	oasisPropNameRef    = 8
+	oasisPropString     = 9
+	oasisPropStringRef  = 10
+	oasisLayerName      = 11
+	oasisLayerNameText  = 12
+	oasisCellRef        = 13
+	oasisCell           = 14
+	oasisXYAbsolute     = 15
+	oasisXYRelative     = 16
+	oasisPlacement      = 17
+	oasisPlacementTrans = 18
+	oasisText           = 19
+	oasisRectangle      = 20
+	oasisPolygon        = 21
+	oasisPath           = 22
+	oasisTrapezoid      = 23
+	oasisTrapezoidA     = 24
+	oasisTrapezoidB     = 25
+	oasisCTrapezoid     = 26
+	oasisCircle         = 27
+	oasisProperty       = 28
+	oasisPropertyRepeat = 29
+	oasisXName          = 30
+	oasisXNameRef       = 31
+	oasisXElement       = 32
+	oasisXGeometry      = 33
+	oasisCBlock         = 34
+)
+
+// Name tables, CELLNAME, TEXTSTRING, PROPNAME and PROPSTRING records fill them in this order
+const (
+	oasisCellNames = iota
+	oasisTextStrings
+	oasisPropNames
+	oasisPropStrings
+)
+
+// Standard property holding the attribute number and value of a GDSII property
+const oasisGDSProperty = "S_GDS_PROPERTY"
+
+// Directions of 3-deltas and g-deltas: east, north, west, south, northeast, northwest, southwest and southeast
+var oasisDirections = [8][2]int64{{1, 0}, {0, 1}, {-1, 0}, {0, -1}, {1, 1}, {-1, 1}, {-1, -1}, {1, -1}}
+
+// OASISReadOptions controls how ReadOASISWithOptions maps OASIS elements onto GDSII elements
+type OASISReadOptions struct {
+	// Places every repeated cell placement as SREF instead of mapping regular repetitions to AREFs.
+	// Repetitions of geometry and irregular repetitions of placements are always expanded.
+	ExpandRepetitions bool
+	// Number of vertices of the polygons replacing circles, defaults to 64
+	CircleVertices int
+}
+
+// OASISWriteOptions controls how WriteOASISWithOptions serializes a library
+type OASISWriteOptions struct {
+	// Order in which cells are written, defaults to OrderInput
+	Order StructureOrder
+	// Compresses the records of every cell into a CBLOCK
+	Compress bool
+}
+
+// ReadOASIS reads an OASIS file into a library, see ReadOASISWithOptions
+func ReadOASIS(f io.Reader) (*Library, error) {
+	return ReadOASISWithOptions(f, OASISReadOptions{})
+}
+
+// ReadOASISWithOptions reads an OASIS file into a library with the database unit of the file and user units
+// of one micrometer. OASIS has no library name, the name of the returned library is "Unknown".
+func ReadOASISWithOptions(f io.Reader, opts OASISReadOptions) (*Library, error) {
+	if opts.CircleVertices < 3 {
+		opts.CircleVertices = 64
+	}
+	d := &oasisDecoder{reader: bufio.NewReader(f), options: opts}
+	library, err := d.decode()
+	if err != nil {
+		return nil, fmt.Errorf("could not decode OASIS file at offset %d: %w", d.recordOffset, err)
+	}
+	return library, nil
+}
+
+// WriteOASIS writes the library as OASIS file, see WriteOASISWithOptions
+func WriteOASIS(f io.Writer, lib *Library) error {
+	return WriteOASISWithOptions(f, lib, OASISWriteOptions{})
+}
+
+// WriteOASISWithOptions writes the library as OASIS file. Cell names and text strings are written once into name
+// tables. Rectangular boundaries and boxes become rectangles, AREFs become placements with a repetition. Paths with
+// round ends or odd width have no OASIS equivalent and are written as their outline polygon.
+//
+// Data without OASIS equivalent is dropped: nodes, the library name, user unit, metadata and modification times,
+// opaque records, ELFLAGS, PLEX and BOXTYPE of all elements, the Presentation, Strans, Mag and Angle of texts and
+// the absolute magnification and absolute angle bits (0x0004, 0x0002) of SREF and AREF STRANS, placements are
+// always written relative to the parent cell. Properties are written as S_GDS_PROPERTY.
+func WriteOASISWithOptions(f io.Writer, lib *Library, opts OASISWriteOptions) error {
+	e := &oasisEncoder{options: opts}
+	data, err := e.encode(lib)
+	if err != nil {
+		return fmt.Errorf("could not write OASIS file: %v", err)
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		return fmt.Errorf("could not write OASIS file: %v", err)
+	}
+	return nil
+}
+
+// Repetition of an element, either a regular lattice of cols x rows or an explicit list of displacements
+type oasisRepetition struct {
+	cols, rows int64
+	col, row   [2]int64
+	// displacements of all elements including the first one at (0, 0), nil for lattices
+	offsets [][2]int64
+}
+
+// Returns the displacements of all repeated elements, a single zero displacement for nil
+func (r *oasisRepetition) displacements() [][2]int64 {
+	if r == nil {
+		return [][2]int64{{0, 0}}
+	}
+	if r.offsets != nil {
+		return r.offsets
+	}
+	result := make([][2]int64, 0, r.cols*r.rows)
+	for row := range r.rows {
+		for col := range r.cols {
+			result = append(result, [2]int64{col*r.col[0] + row*r.row[0], col*r.col[1] + row*r.row[1]})
+		}
+	}
+	return result
+}
@@ -0,0 +1,359 @@
+package gds
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func oasisLibrary(t *testing.T) *Library {
+	library := NewLibrary("OASIS", 1e-6, 1e-9)
+	cell, err := library.NewCell("CELL")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	rect := cell.AddRect(LayerSpec{1, 0}, 0, 0, 100, 50)
+	rect.Properties = []Property{{1, "net1"}}
+	cell.AddRect(LayerSpec{1, 0}, 200, 0, 300, 100)
+	cell.AddRect(LayerSpec{1, 2}, 400, 0, 500, 100)
+	for _, xy := range [][]int32{{0, 200, 100, 200, 50, 300}, {0, 400, 100, 400, 200, 500, 100, 600, 0, 600}} {
+		_, err = cell.AddPolygon(LayerSpec{2, 0}, xy)
+		if err != nil {
+			t.Fatalf("could not add polygon: %v", err)
+		}
+	}
+	for i, pathtype := range []int16{0, 2, 4} {
+		path, err := cell.AddPath(LayerSpec{3, 0}, 20, []int32{0, int32(1000 + 100*i), 500, int32(1000 + 100*i), 500, int32(1050 + 100*i)})
+		if err != nil {
+			t.Fatalf("could not add path: %v", err)
+		}
+		path.Pathtype, path.Bgnextn, path.Endextn = pathtype, 0, 0
+		if pathtype == 4 {
+			path.Bgnextn, path.Endextn = 5, -3
+			path.Properties = []Property{{2, "route"}, {3, "vdd"}}
+		}
+	}
+	cell.AddText(LayerSpec{10, 0}, 50, 25, "A")
+	cell.AddText(LayerSpec{10, 1}, 250, 25, "A")
+
+	top, err := library.NewCell("TOP")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	top.AddInstance("CELL", 10, 20).Properties = []Property{{126, "U1"}}
+	mirrored := top.AddInstance("CELL", 10, 20)
+	mirrored.Strans, mirrored.Angle = 0x8000, 270
+	scaled := top.AddInstance("CELL", -1000, 0)
+	scaled.Mag, scaled.Angle = 2.5, 30
+	top.AddArray("CELL", 0, 5000, 3, 2, 1000, 2000)
+	top.AddArray("CELL", 0, 10000, 4, 1, 1000, 0)
+	top.AddArray("CELL", 0, 15000, 1, 3, 0, 2000)
+	diagonal := top.AddArray("CELL", 0, 25000, 2, 1, 1000, 0)
+	diagonal.XY[3] = 27000
+	skewed := top.AddArray("CELL", 0, 20000, 2, 2, 1000, 1000)
+	skewed.XY[2], skewed.XY[3], skewed.XY[4] = 2000, 20200, 600
+	return library
+}
+
+func TestOASISRoundTrip(t *testing.T) {
+	library := oasisLibrary(t)
+	for _, compress := range []bool{false, true} {
+		var buffer bytes.Buffer
+		err := WriteOASISWithOptions(&buffer, library, OASISWriteOptions{Compress: compress})
+		if err != nil {
+			t.Fatalf("could not write OASIS file: %v", err)
+		}
+		read, err := ReadOASIS(&buffer)
+		if err != nil {
+			t.Fatalf("could not read OASIS file: %v", err)
+		}
+		assertEqual(t, "[CELL TOP]", fmt.Sprint(read.StructureOrder))
+		assertEqual(t, 1e-9, read.Units[1])
+		for _, name := range []string{"CELL", "TOP"} {
+			assertEqual(t, library.Structures[name].ListElements(), read.Structures[name].ListElements())
+		}
+		rect := read.Structures["CELL"].Elements[0].(*Boundary)
+		assertEqual(t, "[{1 net1}]", fmt.Sprint(rect.Properties))
+		path := read.Structures["CELL"].Elements[7].(*Path)
+		assertEqual(t, "5 -3", fmt.Sprint(path.Bgnextn, path.Endextn))
+
+		// the read library can be written as GDSII stream and read back in strict mode
+		var stream bytes.Buffer
+		err = WriteGDS(&stream, read)
+		if err != nil {
+			t.Fatalf("could not write GDSII stream: %v", err)
+		}
+		gds, err := ReadGDS(&stream)
+		if err != nil {
+			t.Fatalf("could not read GDSII stream: %v", err)
+		}
+		path = gds.Structures["CELL"].Elements[7].(*Path)
+		assertEqual(t, "[{2 route} {3 vdd}]", fmt.Sprint(path.Properties))
+		ref := gds.Structures["TOP"].Elements[0].(*SRef)
+		assertEqual(t, "[{126 U1}]", fmt.Sprint(ref.Properties))
+		assertEqual(t, 0, len(path.Opaque)+len(ref.Opaque))
+	}
+
+	var buffer bytes.Buffer
+	err := WriteOASIS(&buffer, library)
+	if err != nil {
+		t.Fatalf("could not write OASIS file: %v", err)
+	}
+	read, err := ReadOASISWithOptions(&buffer, OASISReadOptions{ExpandRepetitions: true})
+	if err != nil {
+		t.Fatalf("could not read OASIS file: %v", err)
+	}
+	// 3 instances, 6 + 4 + 3 + 2 + 4 array elements
+	assertEqual(t, 22, len(read.Structures["TOP"].Elements))
+	assertEqual(t, "[0 15000]", fmt.Sprint(read.Structures["TOP"].Elements[13].(*SRef).XY))
+	assertEqual(t, "[0 17000]", fmt.Sprint(read.Structures["TOP"].Elements[14].(*SRef).XY))
+}
+
+func TestOASISPathOutline(t *testing.T) {
+	library := NewLibrary("OASIS", 1e-6, 1e-9)
+	cell, err := library.NewCell("CELL")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	_, err = cell.AddPath(LayerSpec{1, 0}, 11, []int32{0, 0, 100, 0})
+	if err != nil {
+		t.Fatalf("could not add path: %v", err)
+	}
+	cell.Elements = append(cell.Elements, Node{Layer: 1, XY: []int32{0, 0}})
+
+	var buffer bytes.Buffer
+	err = WriteOASIS(&buffer, library)
+	if err != nil {
+		t.Fatalf("could not write OASIS file: %v", err)
+	}
+	read, err := ReadOASIS(&buffer)
+	if err != nil {
+		t.Fatalf("could not read OASIS file: %v", err)
+	}
+	// odd widths are written as polygon, nodes are skipped
+	elements := read.Structures["CELL"].Elements
+	assertEqual(t, 1, len(elements))
+	assertEqual(t, "[0 -6 100 -6 100 6 0 6 0 -6]", fmt.Sprint(elements[0].(*Boundary).XY))
+}
+
+// Writes the KLayout GDSII test file as OASIS and compares the flattened geometry read back
+func TestOASISGDSFileRoundTrip(t *testing.T) {
+	fh, err := os.Open(testFile)
+	if err != nil {
+		t.Fatalf("could not open test gds file: %v", err)
+	}
+	defer fh.Close()
+	library, err := ReadGDS(fh)
+	if err != nil {
+		t.Fatalf("could not parse gds file: %v", err)
+	}
+	var buffer bytes.Buffer
+	err = WriteOASISWithOptions(&buffer, library, OASISWriteOptions{Compress: true})
+	if err != nil {
+		t.Fatalf("could not write OASIS file: %v", err)
+	}
+	read, err := ReadOASIS(&buffer)
+	if err != nil {
+		t.Fatalf("could not read OASIS file: %v", err)
+	}
+	summary := func(lib *Library) string {
+		polygons, err := lib.FlattenPolygons("top")
+		if err != nil {
+			t.Fatalf("could not flatten cell: %v", err)
+		}
+		areas := map[string]string{}
+		for layer, shapes := range polygons {
+			area := 0.0
+			for _, shape := range shapes {
+				area += PolygonArea(shape)
+			}
+			areas[layer] = fmt.Sprintf("%d shapes with %.0f", len(shapes), area)
+		}
+		return fmt.Sprint(areas)
+	}
+	assertEqual(t, summary(library), summary(read))
+}
+
+func TestReadOASISFile(t *testing.T) {
+	// hand-assembled following SEMI P39, independent of oasisBuilder and the writer: LEAF is stored in a CBLOCK and
+	// uses modal layer, size, position and repetition, TOP places it with a regular and an irregular repetition and
+	// all names are defined after the cells
+	fh, err := os.Open("testdata/cblock_repetitions.oas")
+	if err != nil {
+		t.Fatalf("could not open test OASIS file: %v", err)
+	}
+	defer fh.Close()
+	library, err := ReadOASIS(fh)
+	if err != nil {
+		t.Fatalf("could not read OASIS file: %v", err)
+	}
+	assertEqual(t, "[LEAF TOP]", fmt.Sprint(library.StructureOrder))
+	assertEqual(t, 1e-9, library.Units[1])
+
+	leaf := library.Structures["LEAF"].Elements
+	assertEqual(t, 17, len(leaf))
+	// 3x2 repetition of the second rectangle, reused for the rectangle on layer 4
+	for i, expected := range []string{"[200 0]", "[350 0]", "[500 0]", "[200 100]", "[350 100]", "[500 100]"} {
+		assertEqual(t, "1/0"+expected, fmt.Sprint(leaf[1+i].GetLayer(), leaf[1+i].(*Boundary).XY[:2]))
+		assertEqual(t, "4/0"+expected, fmt.Sprint(leaf[7+i].GetLayer(), leaf[7+i].(*Boundary).XY[:2]))
+	}
+	assertEqual(t, "[300 0 300 50 200 50 200 0]", fmt.Sprint(leaf[7].(*Boundary).XY[2:]))
+	assertEqual(t, "[0 1000 200 1000 200 1100 100 1100 100 1200 0 1200 0 1000]", fmt.Sprint(leaf[13].(*Boundary).XY))
+	path := leaf[14].(*Path)
+	assertEqual(t, "3/0", path.GetLayer())
+	assertEqual(t, "4 10 5 7 [0 500 300 500 300 600]", fmt.Sprint(path.Pathtype, path.Width, path.Bgnextn, path.Endextn, path.XY))
+	assertEqual(t, "pin[10 20]", fmt.Sprint(leaf[15].(*Text).StringBody, leaf[15].(*Text).XY))
+	assertEqual(t, "pin[60 20]", fmt.Sprint(leaf[16].(*Text).StringBody, leaf[16].(*Text).XY))
+
+	top := library.Structures["TOP"].Elements
+	assertEqual(t, 5, len(top))
+	assertEqual(t, "LEAF[0 0] [{5 U1}]", fmt.Sprint(top[0].(*SRef).Sname, top[0].(*SRef).XY, top[0].(*SRef).Properties))
+	array := top[1].(*ARef)
+	assertEqual(t, "90 [4 1] [1000 0 5000 0 1000 0]", fmt.Sprint(array.Angle, array.Colrow, array.XY))
+	for i, expected := range []string{"[1000 5000]", "[1500 5000]", "[2200 5000]"} {
+		assertEqual(t, expected, fmt.Sprint(top[2+i].(*SRef).XY))
+	}
+}
+
+// Builds an OASIS file from records given as mix of record ids, bytes, unsigned integers, signed integers and strings
+type oasisBuilder []byte
+
+func (b oasisBuilder) add(values ...any) oasisBuilder {
+	for _, value := range values {
+		switch v := value.(type) {
+		case int:
+			b = binary.AppendUvarint(b, uint64(v))
+		case byte:
+			b = append(b, v)
+		case int64:
+			b = appendSint(b, v)
+		case string:
+			b = appendString(b, v)
+		case []byte:
+			b = append(b, v...)
+		}
+	}
+	return b
+}
+
+func TestReadOASIS(t *testing.T) {
+	// a cell in a CBLOCK
+	sub := oasisBuilder{}.add(oasisCellRef, 1, oasisRectangle, byte(0x7b), 1, 0, 5, 5, int64(0), int64(0))
+	var compressed bytes.Buffer
+	writer, _ := flate.NewWriter(&compressed, flate.DefaultCompression)
+	writer.Write(sub)
+	writer.Close()
+
+	file := oasisBuilder(oasisMagic).add(
+		// 1000 units per micrometer and table offsets in START
+		oasisStart, "1.0", 0, 1000, 0, make([]byte, 12),
+		oasisCell, "TOP",
+		oasisXYRelative,
+		// three rectangles repeated with spaces 50 and 30
+		oasisRectangle, byte(0x7f), 1, 0, 10, 20, int64(100), int64(200), 4, 1, 50, 30,
+		// square with modal width 10 moved up by 100
+		oasisRectangle, byte(0x88), int64(100),
+		// Manhattan point list with implicit last point at the origin
+		oasisPolygon, byte(0x38), 0, 2, int64(30), int64(40), int64(-100), int64(-300),
+		// path with explicit start extension and half width end extension and a g-delta
+		oasisPath, byte(0xfb), 2, 0, 5, 3<<2|2, int64(7), 4, 1, 100<<2|1, int64(50), int64(0), int64(0),
+		oasisXYAbsolute,
+		oasisText, byte(0x5b), "hello", 5, 1, int64(10), int64(20),
+		oasisText, byte(0x10), int64(30),
+		oasisProperty, byte(0x25), oasisGDSProperty, 8, 7, 10, "seven",
+		// 3x2 array rotated by 90 degrees
+		oasisPlacement, byte(0xfa), 0, int64(1000), int64(0), 1, 1, 0, 100, 200,
+		oasisPropertyRepeat,
+		// two placements with magnification 1/2 and 45 degrees with arbitrary displacement
+		oasisPlacementTrans, byte(0xee), 1, 2, 2, 0, 45, int64(500), 10, 0, 3<<2|1, int64(4),
+		oasisTrapezoid, byte(0x7b), 3, 0, 100, 20, int64(10), int64(-10), int64(0), int64(1000),
+		oasisCTrapezoid, byte(0xd8), 16, 10, int64(0), int64(2000),
+		oasisCircle, byte(0x38), 10, int64(0), int64(3000),
+		oasisCBlock, 0, len(sub), compressed.Len(), compressed.Bytes(),
+		// forward references are resolved at the end
+		oasisCellNameRef, "LEAF", 0,
+		oasisCellNameRef, "SUB", 1,
+		oasisEnd, "", 0,
+	)
+	library, err := ReadOASISWithOptions(bytes.NewReader(file), OASISReadOptions{CircleVertices: 4})
+	if err != nil {
+		t.Fatalf("could not read OASIS file: %v", err)
+	}
+	assertEqual(t, "[TOP SUB]", fmt.Sprint(library.StructureOrder))
+	assertEqual(t, 1e-9, library.Units[1])
+	elements := library.Structures["TOP"].Elements
+	assertEqual(t, 14, len(elements))
+	for i, expected := range []string{
+		"[100 200 110 200 110 220 100 220 100 200]",
+		"[150 200 160 200 160 220 150 220 150 200]",
+		"[180 200 190 200 190 220 180 220 180 200]",
+		"[100 300 110 300 110 310 100 310 100 300]",
+		"[0 0 30 0 30 40 0 40 0 0]",
+	} {
+		assertEqual(t, expected, fmt.Sprint(elements[i].(*Boundary).XY))
+	}
+	path := elements[5].(*Path)
+	assertEqual(t, "2/0", path.GetLayer())
+	assertEqual(t, "4 10 7 5 [0 0 100 50]", fmt.Sprint(path.Pathtype, path.Width, path.Bgnextn, path.Endextn, path.XY))
+	assertEqual(t, "5/1", elements[6].GetLayer())
+	assertEqual(t, "hello[10 20]", fmt.Sprint(elements[6].(*Text).StringBody, elements[6].(*Text).XY))
+	second := elements[7].(*Text)
+	assertEqual(t, "hello[30 20]", fmt.Sprint(second.StringBody, second.XY))
+	assertEqual(t, "[{7 seven}]", fmt.Sprint(second.Properties))
+	array := elements[8].(*ARef)
+	assertEqual(t, "LEAF90 [3 2] [1000 0 1300 0 1000 400]", fmt.Sprint(array.Sname, array.Angle, array.Colrow, array.XY))
+	assertEqual(t, 1, len(array.Properties))
+	for i, expected := range []string{"[500 0]", "[503 4]"} {
+		ref := elements[9+i].(*SRef)
+		assertEqual(t, "SUB0.5 45 "+expected, fmt.Sprint(ref.Sname, ref.Mag, ref.Angle, ref.XY))
+	}
+	for i, expected := range []string{
+		"[10 1020 90 1020 100 1000 0 1000 10 1020]",
+		"[0 2000 0 2010 10 2000 0 2000]",
+		"[10 3000 0 3010 -10 3000 0 2990 10 3000]",
+	} {
+		assertEqual(t, expected, fmt.Sprint(elements[11+i].(*Boundary).XY))
+	}
+	assertEqual(t, "3/0", elements[13].GetLayer())
+	assertEqual(t, "[0 0 5 0 5 5 0 5 0 0]", fmt.Sprint(library.Structures["SUB"].Elements[0].(*Boundary).XY))
+
+	for name, data := range map[string][]byte{
+		"magic":          []byte("%SEMI-OASIS\r\r"),
+		"truncated":      file[:len(file)-2],
+		"undefined name": oasisBuilder(oasisMagic).add(oasisStart, "1.0", 0, 1000, 1, oasisCellRef, 5, oasisEnd, make([]byte, 12), "", 0),
+		"modal":          oasisBuilder(oasisMagic).add(oasisStart, "1.0", 0, 1000, 1, oasisCell, "A", oasisRectangle, byte(0x03), 1, 0),
+	} {
+		_, err := ReadOASIS(bytes.NewReader(data))
+		if err == nil {
+			t.Fatalf("could read invalid file (%s)", name)
+		}
+		if name == "truncated" && !errors.Is(err, ErrTruncated) {
+			t.Fatalf("unexpected error for truncated file: %v", err)
+		}
+	}
+}
+
+func TestOASISPrimitives(t *testing.T) {
+	assertEqual(t, "[3]", fmt.Sprint(appendSint(nil, -1)))
+	assertEqual(t, "[128 1]", fmt.Sprint(binary.AppendUvarint(nil, 128)))
+	assertEqual(t, "[0 232 7]", fmt.Sprint(appendReal(nil, 1000)))
+	assertEqual(t, "[80]", fmt.Sprint(appendGDelta(nil, [2]int64{5, 0})))
+	assertEqual(t, "[92]", fmt.Sprint(appendGDelta(nil, [2]int64{-5, -5})))
+	assertEqual(t, "[15 8]", fmt.Sprint(appendGDelta(nil, [2]int64{-3, 4})))
+
+	d := &oasisDecoder{reader: bufio.NewReader(bytes.NewReader(appendReal(appendGDelta(appendSint(nil, -12345), [2]int64{-3, 4}), 0.25)))}
+	value, err := d.readSint()
+	assertEqual(t, int64(-12345), value)
+	delta, err2 := d.readGDelta()
+	assertEqual(t, "[-3 4]", fmt.Sprint(delta))
+	real, err3 := d.readReal()
+	assertEqual(t, 0.25, real)
+	if err := errors.Join(err, err2, err3); err != nil {
+		t.Fatalf("could not read values: %v", err)
+	}
+}
@@ -0,0 +1,1417 @@
+package gds
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Upper limit for the number of elements created from one repetition and for string and list lengths,
+// protects against allocating memory for corrupt counts
+const oasisMaxCount = 1 << 24
+
+// Modal variable of the OASIS format, set by one record and used by the following ones if a value is omitted
+type modal[T any] struct {
+	value T
+	set   bool
+}
+
+func (m *modal[T]) put(value T) {
+	m.value, m.set = value, true
+}
+
+func (m *modal[T]) get(name string) (T, error) {
+	if !m.set {
+		return m.value, fmt.Errorf("%w: modal variable %s is undefined", ErrInvalidRecord, name)
+	}
+	return m.value, nil
+}
+
+// Name given as string or as reference number into a name table
+type oasisName struct {
+	ref   uint64
+	byRef bool
+	name  string
+}
+
+// Property value referencing a PROPSTRING
+type oasisStringRef uint64
+
+// Modal variables, all of them are reset at the start of every cell
+type oasisModal struct {
+	relative                     bool
+	placementX, placementY       int64
+	geometryX, geometryY         int64
+	textX, textY                 int64
+	repetition                   modal[*oasisRepetition]
+	placementCell                modal[oasisName]
+	layer, datatype              modal[uint64]
+	textLayer, textType          modal[uint64]
+	textString                   modal[oasisName]
+	width, height                modal[uint64]
+	halfWidth, radius            modal[uint64]
+	ctrapezoidType               modal[uint64]
+	startExtension, endExtension modal[int64]
+	polygonPoints, pathPoints    modal[[][2]int64]
+	propertyName                 modal[oasisName]
+	propertyValues               modal[[]any]
+}
+
+// Property read before the name tables are complete
+type oasisPendingProperty struct {
+	elements []Element
+	name     oasisName
+	values   []any
+}
+
+// Field of an element naming a cell or text string that is looked up at the end of the file
+type oasisReference struct {
+	field *string
+	name  oasisName
+}
+
+type oasisDecoder struct {
+	reader *bufio.Reader
+	// decompressed contents of the CBLOCK being read
+	block        *bytes.Reader
+	offset       int64
+	blockOffset  int64
+	recordOffset int64
+	options      OASISReadOptions
+	modal        oasisModal
+	// table offsets are stored in the END record instead of the START record
+	offsetsAtEnd bool
+
+	library *Library
+	cells   []*Structure
+	// names of the cells in the same order, resolved at the end
+	cellNames []oasisName
+	cell      *Structure
+	// elements created by the last element record, properties are attached to them
+	last []Element
+
+	tables     [4]map[uint64]string
+	implicit   [4]uint64
+	references [2][]oasisReference // cell names and text strings
+	properties []oasisPendingProperty
+}
+
+// ReadByte reads from the current CBLOCK or the file, ends of file are reported as ErrTruncated
+func (d *oasisDecoder) ReadByte() (byte, error) {
+	if d.block != nil {
+		b, err := d.block.ReadByte()
+		if err == nil {
+			return b, nil
+		}
+		d.block = nil
+	}
+	b, err := d.reader.ReadByte()
+	if errors.Is(err, io.EOF) {
+		return 0, ErrTruncated
+	}
+	if err != nil {
+		return 0, err
+	}
+	d.offset++
+	return b, nil
+}
+
+func (d *oasisDecoder) readUint() (uint64, error) {
+	value, err := binary.ReadUvarint(d)
+	if err != nil && !errors.Is(err, ErrTruncated) {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+	}
+	return value, err
+}
+
+// Reads a signed integer, the lowest bit holds the sign of the magnitude in the remaining bits
+func (d *oasisDecoder) readSint() (int64, error) {
+	value, err := d.readUint()
+	if err != nil {
+		return 0, err
+	}
+	if value&1 != 0 {
+		return -int64(value >> 1), nil
+	}
+	return int64(value >> 1), nil
+}
+
+// Reads a count and checks it against oasisMaxCount
+func (d *oasisDecoder) readCount(name string) (int64, error) {
+	value, err := d.readUint()
+	if err != nil {
+		return 0, err
+	}
+	if value > oasisMaxCount {
+		return 0, fmt.Errorf("%w: %s %d exceeds the supported maximum", ErrInvalidRecord, name, value)
+	}
+	return int64(value), nil
+}
+
+func (d *oasisDecoder) readBytes(n int64) ([]byte, error) {
+	data := make([]byte, n)
+	for i := range data {
+		b, err := d.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		data[i] = b
+	}
+	return data, nil
+}
+
+func (d *oasisDecoder) readString() (string, error) {
+	n, err := d.readCount("string length")
+	if err != nil {
+		return "", err
+	}
+	data, err := d.readBytes(n)
+	return string(data), err
+}
+
+func (d *oasisDecoder) readReal() (float64, error) {
+	kind, err := d.readUint()
+	if err != nil {
+		return 0, err
+	}
+	return d.readRealValue(kind)
+}
+
+// Reads a real number of the given type: integers, reciprocals and ratios with sign or IEEE floats
+func (d *oasisDecoder) readRealValue(kind uint64) (float64, error) {
+	switch kind {
+	case 0, 1, 2, 3:
+		value, err := d.readUint()
+		if err != nil {
+			return 0, err
+		}
+		result := float64(value)
+		if kind >= 2 {
+			result = 1 / result
+		}
+		if kind%2 == 1 {
+			result = -result
+		}
+		return result, nil
+	case 4, 5:
+		numerator, err := d.readUint()
+		if err != nil {
+			return 0, err
+		}
+		denominator, err := d.readUint()
+		if err != nil {
+			return 0, err
+		}
+		if denominator == 0 {
+			return 0, fmt.Errorf("%w: ratio with zero denominator", ErrInvalidRecord)
+		}
+		result := float64(numerator) / float64(denominator)
+		if kind == 5 {
+			result = -result
+		}
+		return result, nil
+	case 6:
+		data, err := d.readBytes(4)
+		if err != nil {
+			return 0, err
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data))), nil
+	case 7:
+		data, err := d.readBytes(8)
+		if err != nil {
+			return 0, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), nil
+	}
+	return 0, fmt.Errorf("%w: unknown real type %d", ErrInvalidRecord, kind)
+}
+
+// Reads a g-delta, either an octangular displacement or arbitrary x and y values
+func (d *oasisDecoder) readGDelta() ([2]int64, error) {
+	value, err := d.readUint()
+	if err != nil {
+		return [2]int64{}, err
+	}
+	if value&1 == 0 {
+		direction := oasisDirections[(value>>1)&7]
+		magnitude := int64(value >> 4)
+		return [2]int64{direction[0] * magnitude, direction[1] * magnitude}, nil
+	}
+	x := int64(value >> 2)
+	if value&2 != 0 {
+		x = -x
+	}
+	y, err := d.readSint()
+	return [2]int64{x, y}, err
+}
+
+// Reads a point list and returns all points relative to the first point at (0, 0). Manhattan lists of polygons
+// (types 0 and 1) omit the last point, it is added.
+func (d *oasisDecoder) readPointList(polygon bool) ([][2]int64, error) {
+	kind, err := d.readUint()
+	if err != nil {
+		return nil, err
+	}
+	n, err := d.readCount("point count")
+	if err != nil {
+		return nil, err
+	}
+	points := make([][2]int64, 1, n+2)
+	var x, y int64
+	var delta [2]int64
+	for i := range n {
+		switch kind {
+		case 0, 1:
+			value, err := d.readSint()
+			if err != nil {
+				return nil, err
+			}
+			if (i%2 == 0) == (kind == 0) {
+				x += value
+			} else {
+				y += value
+			}
+		case 2, 3:
+			value, err := d.readUint()
+			if err != nil {
+				return nil, err
+			}
+			bits := kind // 2-deltas hold the direction in 2 bits, 3-deltas in 3 bits
+			direction := oasisDirections[value&(1<<bits-1)]
+			x += direction[0] * int64(value>>bits)
+			y += direction[1] * int64(value>>bits)
+		case 4, 5:
+			g, err := d.readGDelta()
+			if err != nil {
+				return nil, err
+			}
+			// type 5 gives each delta relative to the previous delta
+			if kind == 4 {
+				delta = g
+			} else {
+				delta = [2]int64{delta[0] + g[0], delta[1] + g[1]}
+			}
+			x, y = x+delta[0], y+delta[1]
+		default:
+			return nil, fmt.Errorf("%w: unknown point list type %d", ErrInvalidRecord, kind)
+		}
+		points = append(points, [2]int64{x, y})
+	}
+	if polygon && kind <= 1 {
+		if (n%2 == 0) == (kind == 0) {
+			points = append(points, [2]int64{0, y})
+		} else {
+			points = append(points, [2]int64{x, 0})
+		}
+	}
+	return points, nil
+}
+
+// Reads a repetition if present, type 0 reuses the modal repetition
+func (d *oasisDecoder) readRepetition(present bool) (*oasisRepetition, error) {
+	if !present {
+		return nil, nil
+	}
+	kind, err := d.readUint()
+	if err != nil {
+		return nil, err
+	}
+	if kind == 0 {
+		return d.modal.repetition.get("repetition")
+	}
+	uints := func(n int) ([]int64, error) {
+		values := make([]int64, n)
+		for i := range values {
+			value, err := d.readUint()
+			if err != nil {
+				return nil, err
+			}
+			if value > math.MaxInt32 {
+				return nil, fmt.Errorf("%w: repetition value %d exceeds the GDSII range", ErrInvalidRecord, value)
+			}
+			values[i] = int64(value)
+		}
+		return values, nil
+	}
+	repetition := &oasisRepetition{cols: 1, rows: 1}
+	switch kind {
+	case 1, 2, 3:
+		n := map[uint64]int{1: 4, 2: 2, 3: 2}[kind]
+		values, err := uints(n)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case 1:
+			repetition.cols, repetition.rows = values[0]+2, values[1]+2
+			repetition.col[0], repetition.row[1] = values[2], values[3]
+		case 2:
+			repetition.cols, repetition.col[0] = values[0]+2, values[1]
+		case 3:
+			repetition.rows, repetition.row[1] = values[0]+2, values[1]
+		}
+	case 4, 5, 6, 7:
+		dimension, err := d.readCount("repetition dimension")
+		if err != nil {
+			return nil, err
+		}
+		// types 5 and 7 give the grid before the spaces
+		gridded := kind == 5 || kind == 7
+		n := int(dimension) + 1
+		if gridded {
+			n++
+		}
+		values, err := uints(n)
+		if err != nil {
+			return nil, err
+		}
+		grid, spaces := int64(1), values
+		if gridded {
+			grid, spaces = values[0], values[1:]
+		}
+		axis := 0
+		if kind >= 6 {
+			axis = 1
+		}
+		repetition.offsets = make([][2]int64, 1, dimension+2)
+		var position [2]int64
+		for _, space := range spaces {
+			position[axis] += space * grid
+			repetition.offsets = append(repetition.offsets, position)
+		}
+	case 8, 9:
+		n, m := int64(0), int64(-1)
+		n, err = d.readCount("repetition dimension")
+		if err == nil && kind == 8 {
+			m, err = d.readCount("repetition dimension")
+		}
+		if err != nil {
+			return nil, err
+		}
+		repetition.cols, repetition.rows = n+2, m+2
+		repetition.col, err = d.readGDelta()
+		if err == nil && kind == 8 {
+			repetition.row, err = d.readGDelta()
+		}
+		if err != nil {
+			return nil, err
+		}
+	case 10, 11:
+		dimension, err := d.readCount("repetition dimension")
+		if err != nil {
+			return nil, err
+		}
+		grid := int64(1)
+		if kind == 11 {
+			values, err := uints(1)
+			if err != nil {
+				return nil, err
+			}
+			grid = values[0]
+		}
+		repetition.offsets = make([][2]int64, 1, dimension+2)
+		var position [2]int64
+		for range dimension + 1 {
+			g, err := d.readGDelta()
+			if err != nil {
+				return nil, err
+			}
+			position = [2]int64{position[0] + g[0]*grid, position[1] + g[1]*grid}
+			repetition.offsets = append(repetition.offsets, position)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown repetition type %d", ErrInvalidRecord, kind)
+	}
+	if repetition.cols*repetition.rows > oasisMaxCount {
+		return nil, fmt.Errorf("%w: repetition of %dx%d elements exceeds the supported maximum", ErrInvalidRecord, repetition.cols, repetition.rows)
+	}
+	d.modal.repetition.put(repetition)
+	return repetition, nil
+}
+
+// Reads a coordinate if present and updates the modal coordinate in absolute or relative mode
+func (d *oasisDecoder) readCoordinate(present bool, coordinate *int64) error {
+	if !present {
+		return nil
+	}
+	value, err := d.readSint()
+	if err != nil {
+		return err
+	}
+	if d.modal.relative {
+		*coordinate += value
+	} else {
+		*coordinate = value
+	}
+	return nil
+}
+
+// Reads an unsigned value into a modal variable if present
+func (d *oasisDecoder) readModal(present bool, variable *modal[uint64]) error {
+	if !present {
+		return nil
+	}
+	value, err := d.readUint()
+	if err == nil {
+		variable.put(value)
+	}
+	return err
+}
+
+// Reads layer and datatype given by the two lowest bits of info and returns the modal values
+func (d *oasisDecoder) readLayer(info byte, layer, datatype *modal[uint64]) (int16, int16, error) {
+	err := d.readModal(info&0x01 != 0, layer)
+	if err == nil {
+		err = d.readModal(info&0x02 != 0, datatype)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	l, err := layer.get("layer")
+	if err != nil {
+		return 0, 0, err
+	}
+	t, err := datatype.get("datatype")
+	if err != nil {
+		return 0, 0, err
+	}
+	if l > math.MaxInt16 || t > math.MaxInt16 {
+		return 0, 0, fmt.Errorf("%w: layer %d/%d exceeds the GDSII range", ErrInvalidRecord, l, t)
+	}
+	return int16(l), int16(t), nil
+}
+
+// Reads a cell name or text string given by the C and N bits of info into variable
+func (d *oasisDecoder) readName(info byte, c, n byte, variable *modal[oasisName]) error {
+	if info&c == 0 {
+		return nil
+	}
+	if info&n != 0 {
+		ref, err := d.readUint()
+		if err == nil {
+			variable.put(oasisName{ref: ref, byRef: true})
+		}
+		return err
+	}
+	name, err := d.readString()
+	if err == nil {
+		variable.put(oasisName{name: name})
+	}
+	return err
+}
+
+// Converts points relative to x, y into GDSII coordinates, closed adds the first point again
+func oasisXY(points [][2]int64, x, y int64, closed bool) ([]int32, error) {
+	xy := make([]int32, 0, 2*len(points)+2)
+	for _, point := range points {
+		for _, value := range [2]int64{x + point[0], y + point[1]} {
+			if value < math.MinInt32 || value > math.MaxInt32 {
+				return nil, fmt.Errorf("%w: coordinate %d exceeds the GDSII range", ErrInvalidRecord, value)
+			}
+			xy = append(xy, int32(value))
+		}
+	}
+	if closed && len(xy) >= 2 {
+		xy = append(xy, xy[0], xy[1])
+	}
+	return xy, nil
+}
+
+// Adds an element for every displacement of the repetition, shape creates the element at a displaced position
+func (d *oasisDecoder) addRepeated(repetition *oasisRepetition, x, y int64, shape func(x, y int64) (Element, error)) error {
+	if d.cell == nil {
+		return fmt.Errorf("%w: element outside of a cell", ErrUnexpectedRecord)
+	}
+	d.last = []Element{}
+	for _, offset := range repetition.displacements() {
+		element, err := shape(x+offset[0], y+offset[1])
+		if err != nil {
+			return err
+		}
+		d.last = append(d.last, element)
+	}
+	d.cell.Elements = append(d.cell.Elements, d.last...)
+	return nil
+}
+
+func (d *oasisDecoder) decode() (*Library, error) {
+	magic, err := d.readBytes(int64(len(oasisMagic)))
+	if err != nil || string(magic) != oasisMagic {
+		return nil, fmt.Errorf("%w: missing OASIS magic bytes", ErrInvalidRecord)
+	}
+	for i := range d.tables {
+		d.tables[i] = map[uint64]string{}
+	}
+	for {
+		d.recordOffset = d.offset
+		if d.block != nil {
+			d.recordOffset = d.blockOffset
+		}
+		id, err := d.readUint()
+		if err != nil {
+			return nil, err
+		}
+		if (d.library == nil) != (id == oasisStart) {
+			return nil, fmt.Errorf("%w: record %d, files begin with one START record", ErrUnexpectedRecord, id)
+		}
+		if id == oasisEnd {
+			if d.block != nil {
+				return nil, fmt.Errorf("%w: END record inside of CBLOCK", ErrUnexpectedRecord)
+			}
+			err = d.readEnd()
+			if err != nil {
+				return nil, err
+			}
+			return d.finish()
+		}
+		err = d.readRecord(id)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (d *oasisDecoder) readRecord(id uint64) error {
+	switch id {
+	case oasisPad:
+		return nil
+	case oasisStart:
+		return d.readStart()
+	case oasisCellName, oasisCellNameRef, oasisTextString, oasisTextStringRef, oasisPropName, oasisPropNameRef, oasisPropString, oasisPropStringRef:
+		return d.readTableEntry(id)
+	case oasisLayerName, oasisLayerNameText:
+		d.last = nil
+		_, err := d.readString()
+		for range 2 {
+			if err != nil {
+				return err
+			}
+			var kind uint64
+			kind, err = d.readUint()
+			bounds := map[uint64]int{0: 0, 1: 1, 2: 1, 3: 1, 4: 2}
+			n, ok := bounds[kind]
+			if err == nil && !ok {
+				err = fmt.Errorf("%w: unknown interval type %d", ErrInvalidRecord, kind)
+			}
+			for range n {
+				if err == nil {
+					_, err = d.readUint()
+				}
+			}
+		}
+		return err
+	case oasisCellRef, oasisCell:
+		return d.readCell(id)
+	case oasisXYAbsolute, oasisXYRelative:
+		d.modal.relative = id == oasisXYRelative
+		return nil
+	case oasisPlacement, oasisPlacementTrans:
+		return d.readPlacement(id)
+	case oasisText:
+		return d.readText()
+	case oasisRectangle:
+		return d.readRectangle()
+	case oasisPolygon:
+		return d.readPolygon()
+	case oasisPath:
+		return d.readPath()
+	case oasisTrapezoid, oasisTrapezoidA, oasisTrapezoidB:
+		return d.readTrapezoid(id)
+	case oasisCTrapezoid:
+		return d.readCTrapezoid()
+	case oasisCircle:
+		return d.readCircle()
+	case oasisProperty, oasisPropertyRepeat:
+		return d.readProperty(id)
+	case oasisXName, oasisXNameRef, oasisXElement:
+		d.last = nil
+		_, err := d.readUint()
+		if err == nil {
+			_, err = d.readString()
+		}
+		if err == nil && id == oasisXNameRef {
+			_, err = d.readUint()
+		}
+		return err
+	case oasisXGeometry:
+		return d.readXGeometry()
+	case oasisCBlock:
+		return d.readCBlock()
+	}
+	return fmt.Errorf("%w: %d", ErrUnknownRecord, id)
+}
+
+func (d *oasisDecoder) readStart() error {
+	version, err := d.readString()
+	if err != nil {
+		return err
+	}
+	if version != "1.0" {
+		return fmt.Errorf("%w: unsupported OASIS version %s", ErrInvalidRecord, version)
+	}
+	unit, err := d.readReal()
+	if err != nil {
+		return err
+	}
+	if !(unit > 0) || math.IsInf(unit, 0) {
+		return fmt.Errorf("%w: invalid unit %v", ErrInvalidRecord, unit)
+	}
+	offsetFlag, err := d.readUint()
+	if err != nil {
+		return err
+	}
+	d.offsetsAtEnd = offsetFlag != 0
+	if !d.offsetsAtEnd {
+		err = d.skipTableOffsets()
+		if err != nil {
+			return err
+		}
+	}
+	// the unit is given in database units per micrometer
+	d.library = NewLibrary("Unknown", 1e-6, 1/(unit*1e6))
+	return nil
+}
+
+func (d *oasisDecoder) skipTableOffsets() error {
+	for range 12 {
+		_, err := d.readUint()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *oasisDecoder) readEnd() error {
+	if d.offsetsAtEnd {
+		err := d.skipTableOffsets()
+		if err != nil {
+			return err
+		}
+	}
+	_, err := d.readString()
+	if err != nil {
+		return err
+	}
+	scheme, err := d.readUint()
+	if err != nil {
+		return err
+	}
+	if scheme > 2 {
+		return fmt.Errorf("%w: unknown validation scheme %d", ErrInvalidRecord, scheme)
+	}
+	if scheme != 0 {
+		_, err = d.readBytes(4)
+	}
+	return err
+}
+
+func (d *oasisDecoder) readTableEntry(id uint64) error {
+	d.last = nil
+	table := (id - oasisCellName) / 2
+	name, err := d.readString()
+	if err != nil {
+		return err
+	}
+	ref := d.implicit[table]
+	if id%2 == 0 {
+		ref, err = d.readUint()
+		if err != nil {
+			return err
+		}
+	} else {
+		d.implicit[table]++
+	}
+	if _, ok := d.tables[table][ref]; ok {
+		return fmt.Errorf("%w: reference number %d is defined twice", ErrInvalidRecord, ref)
+	}
+	d.tables[table][ref] = name
+	return nil
+}
+
+func (d *oasisDecoder) readCell(id uint64) error {
+	name := oasisName{}
+	var err error
+	if id == oasisCellRef {
+		name.byRef = true
+		name.ref, err = d.readUint()
+	} else {
+		name.name, err = d.readString()
+	}
+	if err != nil {
+		return err
+	}
+	d.cell = &Structure{Elements: []Element{}}
+	d.cells = append(d.cells, d.cell)
+	d.cellNames = append(d.cellNames, name)
+	d.modal = oasisModal{}
+	d.last = nil
+	return nil
+}
+
+func (d *oasisDecoder) readPlacement(id uint64) error {
+	info, err := d.ReadByte()
+	if err != nil {
+		return err
+	}
+	err = d.readName(info, 0x80, 0x40, &d.modal.placementCell)
+	if err != nil {
+		return err
+	}
+	cell, err := d.modal.placementCell.get("placement-cell")
+	if err != nil {
+		return err
+	}
+	mag, angle := 1.0, float64((info>>1)&3)*90
+	if id == oasisPlacementTrans {
+		angle = 0
+		if info&0x04 != 0 {
+			mag, err = d.readReal()
+			if err != nil {
+				return err
+			}
+		}
+		if info&0x02 != 0 {
+			angle, err = d.readReal()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = d.readCoordinate(info&0x20 != 0, &d.modal.placementX)
+	if err == nil {
+		err = d.readCoordinate(info&0x10 != 0, &d.modal.placementY)
+	}
+	if err != nil {
+		return err
+	}
+	repetition, err := d.readRepetition(info&0x08 != 0)
+	if err != nil {
+		return err
+	}
+	var strans uint16
+	if info&0x01 != 0 {
+		strans = 0x8000
+	}
+	x, y := d.modal.placementX, d.modal.placementY
+	if repetition != nil && repetition.offsets == nil && !d.options.ExpandRepetitions &&
+		repetition.cols <= math.MaxInt16 && repetition.rows <= math.MaxInt16 {
+		cols, rows := repetition.cols, repetition.rows
+		return d.addRepeated(nil, x, y, func(x, y int64) (Element, error) {
+			xy, err := oasisXY([][2]int64{{0, 0}, {cols * repetition.col[0], cols * repetition.col[1]},
+				{rows * repetition.row[0], rows * repetition.row[1]}}, x, y, false)
+			if err != nil {
+				return nil, err
+			}
+			ref := &ARef{Strans: strans, Mag: mag, Angle: angle, Colrow: []int16{int16(cols), int16(rows)}, XY: xy}
+			d.references[oasisCellNames] = append(d.references[oasisCellNames], oasisReference{&ref.Sname, cell})
+			return ref, nil
+		})
+	}
+	return d.addRepeated(repetition, x, y, func(x, y int64) (Element, error) {
+		xy, err := oasisXY([][2]int64{{0, 0}}, x, y, false)
+		if err != nil {
+			return nil, err
+		}
+		ref := &SRef{Strans: strans, Mag: mag, Angle: angle, XY: xy}
+		d.references[oasisCellNames] = append(d.references[oasisCellNames], oasisReference{&ref.Sname, cell})
+		return ref, nil
+	})
+}
+
+func (d *oasisDecoder) readText() error {
+	info, err := d.ReadByte()
+	if err != nil {
+		return err
+	}
+	err = d.readName(info, 0x40, 0x20, &d.modal.textString)
+	if err != nil {
+		return err
+	}
+	text, err := d.modal.textString.get("text-string")
+	if err != nil {
+		return err
+	}
+	layer, texttype, err := d.readLayer(info, &d.modal.textLayer, &d.modal.textType)
+	if err != nil {
+		return err
+	}
+	err = d.readCoordinate(info&0x10 != 0, &d.modal.textX)
+	if err == nil {
+		err = d.readCoordinate(info&0x08 != 0, &d.modal.textY)
+	}
+	if err != nil {
+		return err
+	}
+	repetition, err := d.readRepetition(info&0x04 != 0)
+	if err != nil {
+		return err
+	}
+	return d.addRepeated(repetition, d.modal.textX, d.modal.textY, func(x, y int64) (Element, error) {
+		xy, err := oasisXY([][2]int64{{0, 0}}, x, y, false)
+		if err != nil {
+			return nil, err
+		}
+		label := &Text{Layer: layer, Texttype: texttype, Mag: 1, XY: xy, StringBody: text.name}
+		if text.byRef {
+			d.references[oasisTextStrings] = append(d.references[oasisTextStrings], oasisReference{&label.StringBody, text})
+		}
+		return label, nil
+	})
+}
+
+// Reads the geometry position and repetition given by the X, Y and R bits of info
+func (d *oasisDecoder) readGeometryPosition(info byte) (*oasisRepetition, error) {
+	err := d.readCoordinate(info&0x10 != 0, &d.modal.geometryX)
+	if err == nil {
+		err = d.readCoordinate(info&0x08 != 0, &d.modal.geometryY)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.readRepetition(info&0x04 != 0)
+}
+
+// Adds a boundary for every repetition of the polygon given by points relative to the modal geometry position
+func (d *oasisDecoder) addPolygon(layer, datatype int16, points [][2]int64, repetition *oasisRepetition) error {
+	return d.addRepeated(repetition, d.modal.geometryX, d.modal.geometryY, func(x, y int64) (Element, error) {
+		xy, err := oasisXY(points, x, y, true)
+		if err != nil {
+			return nil, err
+		}
+		return &Boundary{Layer: layer, Datatype: datatype, XY: xy}, nil
+	})
+}
+
+func (d *oasisDecoder) readRectangle() error {
+	info, err := d.ReadByte()
+	if err != nil {
+		return err
+	}
+	layer, datatype, err := d.readLayer(info, &d.modal.layer, &d.modal.datatype)
+	if err != nil {
+		return err
+	}
+	err = d.readModal(info&0x40 != 0, &d.modal.width)
+	if err == nil {
+		err = d.readModal(info&0x20 != 0, &d.modal.height)
+	}
+	if err != nil {
+		return err
+	}
+	width, err := d.modal.width.get("geometry-w")
+	if err != nil {
+		return err
+	}
+	// squares use the width as height
+	if info&0x80 != 0 {
+		d.modal.height.put(width)
+	}
+	height, err := d.modal.height.get("geometry-h")
+	if err != nil {
+		return err
+	}
+	repetition, err := d.readGeometryPosition(info)
+	if err != nil {
+		return err
+	}
+	w, h := int64(width), int64(height)
+	return d.addPolygon(layer, datatype, [][2]int64{{0, 0}, {w, 0}, {w, h}, {0, h}}, repetition)
+}
+
+func (d *oasisDecoder) readPolygon() error {
+	info, err := d.ReadByte()
+	if err != nil {
+		return err
+	}
+	layer, datatype, err := d.readLayer(info, &d.modal.layer, &d.modal.datatype)
+	if err != nil {
+		return err
+	}
+	if info&0x20 != 0 {
+		points, err := d.readPointList(true)
+		if err != nil {
+			return err
+		}
+		d.modal.polygonPoints.put(points)
+	}
+	points, err := d.modal.polygonPoints.get("polygon-point-list")
+	if err != nil {
+		return err
+	}
+	repetition, err := d.readGeometryPosition(info)
+	if err != nil {
+		return err
+	}
+	return d.addPolygon(layer, datatype, points, repetition)
+}
+
+// Reads one extension of a path extension scheme, 0 keeps the modal value
+func (d *oasisDecoder) readExtension(scheme uint64, halfWidth uint64, extension *modal[int64]) error {
+	switch scheme {
+	case 1:
+		extension.put(0)
+	case 2:
+		extension.put(int64(halfWidth))
+	case 3:
+		value, err := d.readSint()
+		if err != nil {
+			return err
+		}
+		extension.put(value)
+	}
+	return nil
+}
+
+func (d *oasisDecoder) readPath() error {
+	info, err := d.ReadByte()
+	if err != nil {
+		return err
+	}
+	layer, datatype, err := d.readLayer(info, &d.modal.layer, &d.modal.datatype)
+	if err != nil {
+		return err
+	}
+	err = d.readModal(info&0x40 != 0, &d.modal.halfWidth)
+	if err != nil {
+		return err
+	}
+	halfWidth, err := d.modal.halfWidth.get("path-halfwidth")
+	if err != nil {
+		return err
+	}
+	if halfWidth > math.MaxInt32/2 {
+		return fmt.Errorf("%w: path half width %d exceeds the GDSII range", ErrInvalidRecord, halfWidth)
+	}
+	if info&0x80 != 0 {
+		scheme, err := d.readUint()
+		if err != nil {
+			return err
+		}
+		err = d.readExtension((scheme>>2)&3, halfWidth, &d.modal.startExtension)
+		if err == nil {
+			err = d.readExtension(scheme&3, halfWidth, &d.modal.endExtension)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	start, err := d.modal.startExtension.get("path-start-extension")
+	if err != nil {
+		return err
+	}
+	end, err := d.modal.endExtension.get("path-end-extension")
+	if err != nil {
+		return err
+	}
+	if info&0x20 != 0 {
+		points, err := d.readPointList(false)
+		if err != nil {
+			return err
+		}
+		d.modal.pathPoints.put(points)
+	}
+	points, err := d.modal.pathPoints.get("path-point-list")
+	if err != nil {
+		return err
+	}
+	repetition, err := d.readGeometryPosition(info)
+	if err != nil {
+		return err
+	}
+	if start < math.MinInt32 || start > math.MaxInt32 || end < math.MinInt32 || end > math.MaxInt32 {
+		return fmt.Errorf("%w: path extension exceeds the GDSII range", ErrInvalidRecord)
+	}
+	return d.addRepeated(repetition, d.modal.geometryX, d.modal.geometryY, func(x, y int64) (Element, error) {
+		xy, err := oasisXY(points, x, y, false)
+		if err != nil {
+			return nil, err
+		}
+		path := &Path{Layer: layer, Datatype: datatype, Width: 2 * int32(halfWidth), XY: xy}
+		switch {
+		case start == 0 && end == 0:
+		case start == int64(halfWidth) && end == int64(halfWidth):
+			path.Pathtype = 2
+		default:
+			path.Pathtype, path.Bgnextn, path.Endextn = 4, int32(start), int32(end)
+		}
+		return path, nil
+	})
+}
+
+func (d *oasisDecoder) readTrapezoid(id uint64) error {
+	info, err := d.ReadByte()
+	if err != nil {
+		return err
+	}
+	layer, datatype, err := d.readLayer(info, &d.modal.layer, &d.modal.datatype)
+	if err != nil {
+		return err
+	}
+	err = d.readModal(info&0x40 != 0, &d.modal.width)
+	if err == nil {
+		err = d.readModal(info&0x20 != 0, &d.modal.height)
+	}
+	if err != nil {
+		return err
+	}
+	width, err := d.modal.width.get("geometry-w")
+	if err != nil {
+		return err
+	}
+	height, err := d.modal.height.get("geometry-h")
+	if err != nil {
+		return err
+	}
+	var a, b int64
+	if id != oasisTrapezoidB {
+		a, err = d.readSint()
+		if err != nil {
+			return err
+		}
+	}
+	if id != oasisTrapezoidA {
+		b, err = d.readSint()
+		if err != nil {
+			return err
+		}
+	}
+	repetition, err := d.readGeometryPosition(info)
+	if err != nil {
+		return err
+	}
+	w, h := int64(width), int64(height)
+	// a and b move the corners of the left and right (bottom and top for vertical trapezoids) side
+	points := [][2]int64{{max(a, 0), h}, {w + min(b, 0), h}, {w - max(b, 0), 0}, {-min(a, 0), 0}}
+	if info&0x80 != 0 {
+		points = [][2]int64{{0, max(a, 0)}, {0, h + min(b, 0)}, {w, h - max(b, 0)}, {w, -min(a, 0)}}
+	}
+	return d.addPolygon(layer, datatype, points, repetition)
+}
+
+// Corners of the compact trapezoid types as factors of width and height: x = a*w + b*h, y = c*w + d*h
+var ctrapezoidCorners = [26][][4]int64{
+	{{0, 0, 0, 0}, {0, 0, 0, 1}, {1, -1, 0, 1}, {1, 0, 0, 0}},
+	{{0, 0, 0, 0}, {0, 0, 0, 1}, {1, 0, 0, 1}, {1, -1, 0, 0}},
+	{{0, 0, 0, 0}, {0, 1, 0, 1}, {1, 0, 0, 1}, {1, 0, 0, 0}},
+	{{0, 1, 0, 0}, {0, 0, 0, 1}, {1, 0, 0, 1}, {1, 0, 0, 0}},
+	{{0, 0, 0, 0}, {0, 1, 0, 1}, {1, -1, 0, 1}, {1, 0, 0, 0}},
+	{{0, 1, 0, 0}, {0, 0, 0, 1}, {1, 0, 0, 1}, {1, -1, 0, 0}},
+	{{0, 0, 0, 0}, {0, 1, 0, 1}, {1, 0, 0, 1}, {1, -1, 0, 0}},
+	{{0, 1, 0, 0}, {0, 0, 0, 1}, {1, -1, 0, 1}, {1, 0, 0, 0}},
+	{{0, 0, 0, 0}, {0, 0, 0, 1}, {1, 0, -1, 1}, {1, 0, 0, 0}},
+	{{0, 0, 0, 0}, {0, 0, -1, 1}, {1, 0, 0, 1}, {1, 0, 0, 0}},
+	{{0, 0, 0, 0}, {0, 0, 0, 1}, {1, 0, 0, 1}, {1, 0, 1, 0}},
+	{{0, 0, 1, 0}, {0, 0, 0, 1}, {1, 0, 0, 1}, {1, 0, 0, 0}},
+	{{0, 0, 0, 0}, {0, 0, 0, 1}, {1, 0, -1, 1}, {1, 0, 1, 0}},
+	{{0, 0, 1, 0}, {0, 0, -1, 1}, {1, 0, 0, 1}, {1, 0, 0, 0}},
+	{{0, 0, 0, 0}, {0, 0, -1, 1}, {1, 0, 0, 1}, {1, 0, 1, 0}},
+	{{0, 0, 1, 0}, {0, 0, 0, 1}, {1, 0, -1, 1}, {1, 0, 0, 0}},
+	{{0, 0, 0, 0}, {0, 0, 1, 0}, {1, 0, 0, 0}},
+	{{0, 0, 0, 0}, {0, 0, 1, 0}, {1, 0, 1, 0}},
+	{{0, 0, 0, 0}, {1, 0, 1, 0}, {1, 0, 0, 0}},
+	{{0, 0, 1, 0}, {1, 0, 1, 0}, {1, 0, 0, 0}},
+	{{0, 0, 0, 0}, {0, 1, 0, 1}, {0, 2, 0, 0}},
+	{{0, 0, 0, 1}, {0, 2, 0, 1}, {0, 1, 0, 0}},
+	{{0, 0, 0, 0}, {0, 0, 2, 0}, {1, 0, 1, 0}},
+	{{1, 0, 0, 0}, {0, 0, 1, 0}, {1, 0, 2, 0}},
+	{{0, 0, 0, 0}, {0, 0, 0, 1}, {1, 0, 0, 1}, {1, 0, 0, 0}},
+	{{0, 0, 0, 0}, {0, 0, 1, 0}, {1, 0, 1, 0}, {1, 0, 0, 0}},
+}
+
+func (d *oasisDecoder) readCTrapezoid() error {
+	info, err := d.ReadByte()
+	if err != nil {
+		return err
+	}
+	layer, datatype, err := d.readLayer(info, &d.modal.layer, &d.modal.datatype)
+	if err != nil {
+		return err
+	}
+	err = d.readModal(info&0x80 != 0, &d.modal.ctrapezoidType)
+	if err == nil {
+		err = d.readModal(info&0x40 != 0, &d.modal.width)
+	}
+	if err == nil {
+		err = d.readModal(info&0x20 != 0, &d.modal.height)
+	}
+	if err != nil {
+		return err
+	}
+	kind, err := d.modal.ctrapezoidType.get("ctrapezoid-type")
+	if err != nil {
+		return err
+	}
+	if kind >= uint64(len(ctrapezoidCorners)) {
+		return fmt.Errorf("%w: unknown ctrapezoid type %d", ErrInvalidRecord, kind)
+	}
+	// only the dimensions used by the type have to be defined
+	var width, height uint64
+	corners := ctrapezoidCorners[kind]
+	for _, corner := range corners {
+		if (corner[0] != 0 || corner[2] != 0) && err == nil {
+			width, err = d.modal.width.get("geometry-w")
+		}
+		if (corner[1] != 0 || corner[3] != 0) && err == nil {
+			height, err = d.modal.height.get("geometry-h")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	repetition, err := d.readGeometryPosition(info)
+	if err != nil {
+		return err
+	}
+	w, h := int64(width), int64(height)
+	points := make([][2]int64, len(corners))
+	for i, corner := range corners {
+		points[i] = [2]int64{corner[0]*w + corner[1]*h, corner[2]*w + corner[3]*h}
+	}
+	return d.addPolygon(layer, datatype, points, repetition)
+}
+
+func (d *oasisDecoder) readCircle() error {
+	info, err := d.ReadByte()
+	if err != nil {
+		return err
+	}
+	layer, datatype, err := d.readLayer(info, &d.modal.layer, &d.modal.datatype)
+	if err != nil {
+		return err
+	}
+	err = d.readModal(info&0x20 != 0, &d.modal.radius)
+	if err != nil {
+		return err
+	}
+	radius, err := d.modal.radius.get("circle-radius")
+	if err != nil {
+		return err
+	}
+	repetition, err := d.readGeometryPosition(info)
+	if err != nil {
+		return err
+	}
+	n := d.options.CircleVertices
+	points := make([][2]int64, n)
+	for i := range points {
+		sin, cos := math.Sincos(2 * math.Pi * float64(i) / float64(n))
+		points[i] = [2]int64{int64(math.Round(float64(radius) * cos)), int64(math.Round(float64(radius) * sin))}
+	}
+	return d.addPolygon(layer, datatype, points, repetition)
+}
+
+func (d *oasisDecoder) readProperty(id uint64) error {
+	var name oasisName
+	var values []any
+	var err error
+	if id == oasisPropertyRepeat {
+		name, err = d.modal.propertyName.get("last-property-name")
+		if err == nil {
+			values, err = d.modal.propertyValues.get("last-value-list")
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		info, err := d.ReadByte()
+		if err != nil {
+			return err
+		}
+		err = d.readName(info, 0x04, 0x02, &d.modal.propertyName)
+		if err != nil {
+			return err
+		}
+		name, err = d.modal.propertyName.get("last-property-name")
+		if err != nil {
+			return err
+		}
+		if info&0x08 != 0 {
+			values, err = d.modal.propertyValues.get("last-value-list")
+		} else {
+			values, err = d.readPropertyValues(info >> 4)
+		}
+		if err != nil {
+			return err
+		}
+		d.modal.propertyValues.put(values)
+	}
+	// properties of files, cells and names are skipped
+	if len(d.last) > 0 {
+		d.properties = append(d.properties, oasisPendingProperty{elements: d.last, name: name, values: values})
+	}
+	return nil
+}
+
+func (d *oasisDecoder) readPropertyValues(count byte) ([]any, error) {
+	n := int64(count)
+	if count == 15 {
+		var err error
+		n, err = d.readCount("property value count")
+		if err != nil {
+			return nil, err
+		}
+	}
+	values := make([]any, 0, n)
+	for range n {
+		kind, err := d.readUint()
+		if err != nil {
+			return nil, err
+		}
+		var value any
+		switch {
+		case kind <= 7:
+			value, err = d.readRealValue(kind)
+		case kind == 8:
+			value, err = d.readUint()
+		case kind == 9:
+			value, err = d.readSint()
+		case kind <= 12:
+			value, err = d.readString()
+		case kind <= 15:
+			var ref uint64
+			ref, err = d.readUint()
+			value = oasisStringRef(ref)
+		default:
+			err = fmt.Errorf("%w: unknown property value type %d", ErrInvalidRecord, kind)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (d *oasisDecoder) readXGeometry() error {
+	info, err := d.ReadByte()
+	if err != nil {
+		return err
+	}
+	d.last = nil
+	_, err = d.readUint()
+	if err == nil {
+		_, _, err = d.readLayer(info, &d.modal.layer, &d.modal.datatype)
+	}
+	if err == nil {
+		_, err = d.readString()
+	}
+	if err == nil {
+		_, err = d.readGeometryPosition(info)
+	}
+	return err
+}
+
+func (d *oasisDecoder) readCBlock() error {
+	if d.block != nil {
+		return fmt.Errorf("%w: nested CBLOCK", ErrUnexpectedRecord)
+	}
+	offset := d.recordOffset
+	method, err := d.readUint()
+	if err != nil {
+		return err
+	}
+	if method != 0 {
+		return fmt.Errorf("%w: unknown compression type %d", ErrInvalidRecord, method)
+	}
+	size, err := d.readCount("uncompressed size")
+	if err != nil {
+		return err
+	}
+	compressedSize, err := d.readCount("compressed size")
+	if err != nil {
+		return err
+	}
+	compressed, err := d.readBytes(compressedSize)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(compressed)), size+1))
+	if err != nil {
+		return fmt.Errorf("%w: could not decompress CBLOCK: %v", ErrInvalidRecord, err)
+	}
+	if int64(len(data)) != size {
+		return fmt.Errorf("%w: CBLOCK holds %d bytes instead of %d", ErrInvalidRecord, len(data), size)
+	}
+	d.block = bytes.NewReader(data)
+	d.blockOffset = offset
+	return nil
+}
+
+// Resolves all names and adds the cells to the library
+func (d *oasisDecoder) finish() (*Library, error) {
+	for table, references := range d.references {
+		for _, reference := range references {
+			name, err := d.resolve(table, reference.name)
+			if err != nil {
+				return nil, err
+			}
+			*reference.field = name
+		}
+	}
+	for i, cell := range d.cells {
+		name, err := d.resolve(oasisCellNames, d.cellNames[i])
+		if err != nil {
+			return nil, err
+		}
+		structure, err := d.library.NewCell(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+		}
+		structure.Elements = cell.Elements
+	}
+	for _, property := range d.properties {
+		gdsProperty, ok, err := d.gdsProperty(property)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		for _, element := range property.elements {
+			info := element.(elementInfo).info()
+			info.Properties = append(info.Properties, gdsProperty)
+		}
+	}
+	return d.library, nil
+}
+
+func (d *oasisDecoder) resolve(table int, name oasisName) (string, error) {
+	if !name.byRef {
+		return name.name, nil
+	}
+	value, ok := d.tables[table][name.ref]
+	if !ok {
+		return "", fmt.Errorf("%w: undefined reference number %d", ErrInvalidRecord, name.ref)
+	}
+	return value, nil
+}
+
+// Converts an S_GDS_PROPERTY into a GDSII property, ok is false for other properties
+func (d *oasisDecoder) gdsProperty(property oasisPendingProperty) (Property, bool, error) {
+	name, err := d.resolve(oasisPropNames, property.name)
+	if err != nil || name != oasisGDSProperty {
+		return Property{}, false, err
+	}
+	if len(property.values) != 2 {
+		return Property{}, false, fmt.Errorf("%w: invalid %s values %v", ErrInvalidRecord, oasisGDSProperty, property.values)
+	}
+	attribute, ok := property.values[0].(uint64)
+	if !ok || attribute > math.MaxInt16 {
+		return Property{}, false, fmt.Errorf("%w: invalid %s values %v", ErrInvalidRecord, oasisGDSProperty, property.values)
+	}
+	value, ok := property.values[1].(string)
+	if ref, isRef := property.values[1].(oasisStringRef); isRef {
+		value, err = d.resolve(oasisPropStrings, oasisName{ref: uint64(ref), byRef: true})
+		ok = err == nil
+	}
+	if !ok {
+		return Property{}, false, fmt.Errorf("%w: invalid %s values %v", ErrInvalidRecord, oasisGDSProperty, property.values)
+	}
+	return Property{Attribute: int16(attribute), Value: value}, true, nil
+}
@@ -0,0 +1,580 @@
+package gds
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Length of the END record including its padding
+const oasisEndSize = 256
+
+type oasisEncoder struct {
+	options OASISWriteOptions
+	// records of the current cell
+	data  []byte
+	modal oasisModal
+	cells map[string]uint64
+	texts map[string]uint64
+}
+
+// Updates the modal variable and reports whether the value has to be written because it differs
+func changed[T comparable](variable *modal[T], value T) bool {
+	if variable.set && variable.value == value {
+		return false
+	}
+	variable.put(value)
+	return true
+}
+
+// Updates a modal coordinate in absolute mode and reports whether it has to be written
+func changedCoordinate(coordinate *int64, value int64) bool {
+	if *coordinate == value {
+		return false
+	}
+	*coordinate = value
+	return true
+}
+
+func appendSint(data []byte, value int64) []byte {
+	if value < 0 {
+		return binary.AppendUvarint(data, uint64(-value)<<1|1)
+	}
+	return binary.AppendUvarint(data, uint64(value)<<1)
+}
+
+func appendString(data []byte, s string) []byte {
+	data = binary.AppendUvarint(data, uint64(len(s)))
+	return append(data, s...)
+}
+
+// Appends integers as integer reals, all other values as IEEE double
+func appendReal(data []byte, value float64) []byte {
+	if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+		if value < 0 {
+			return binary.AppendUvarint(append(data, 1), uint64(-value))
+		}
+		return binary.AppendUvarint(append(data, 0), uint64(value))
+	}
+	return binary.LittleEndian.AppendUint64(append(data, 7), math.Float64bits(value))
+}
+
+// Returns the index into oasisDirections and the magnitude of a horizontal, vertical or diagonal displacement
+func octangular(delta [2]int64) (uint64, uint64, bool) {
+	magnitude := max(delta[0], -delta[0], delta[1], -delta[1])
+	for i, direction := range oasisDirections {
+		if delta[0] == direction[0]*magnitude && delta[1] == direction[1]*magnitude {
+			return uint64(i), uint64(magnitude), true
+		}
+	}
+	return 0, 0, false
+}
+
+func appendGDelta(data []byte, delta [2]int64) []byte {
+	if direction, magnitude, ok := octangular(delta); ok {
+		return binary.AppendUvarint(data, magnitude<<4|direction<<1)
+	}
+	x := uint64(delta[0])<<2 | 1
+	if delta[0] < 0 {
+		x = uint64(-delta[0])<<2 | 3
+	}
+	return appendSint(binary.AppendUvarint(data, x), delta[1])
+}
+
+// Appends the points following the first point of a list of points relative to the first point, using 2-deltas
+// for Manhattan, 3-deltas for 45 degree and g-deltas for all-angle point lists
+func appendPointList(data []byte, points [][2]int64) []byte {
+	deltas := make([][2]int64, len(points)-1)
+	kind := uint64(2)
+	for i := range deltas {
+		deltas[i] = [2]int64{points[i+1][0] - points[i][0], points[i+1][1] - points[i][1]}
+		direction, _, ok := octangular(deltas[i])
+		switch {
+		case !ok:
+			kind = 4
+		case direction >= 4:
+			kind = max(kind, 3)
+		}
+	}
+	data = binary.AppendUvarint(data, kind)
+	data = binary.AppendUvarint(data, uint64(len(deltas)))
+	for _, delta := range deltas {
+		direction, magnitude, _ := octangular(delta)
+		switch kind {
+		case 2:
+			data = binary.AppendUvarint(data, magnitude<<2|direction)
+		case 3:
+			data = binary.AppendUvarint(data, magnitude<<3|direction)
+		default:
+			data = appendGDelta(data, delta)
+		}
+	}
+	return data
+}
+
+// Returns the points of xy relative to the first point
+func relativePoints(xy []int32) [][2]int64 {
+	points := make([][2]int64, len(xy)/2)
+	for i := range points {
+		points[i] = [2]int64{int64(xy[2*i]) - int64(xy[0]), int64(xy[2*i+1]) - int64(xy[1])}
+	}
+	return points
+}
+
+// Returns the number of database units per micrometer, rounded if it is close to an integer
+func oasisUnit(dbUnit float64) float64 {
+	unit := 1e-6 / dbUnit
+	if rounded := math.Round(unit); math.Abs(unit-rounded) < 1e-9*unit {
+		return rounded
+	}
+	return unit
+}
+
+func (e *oasisEncoder) encode(lib *Library) ([]byte, error) {
+	if len(lib.Units) != 2 || !(lib.Units[1] > 0) {
+		return nil, fmt.Errorf("library has invalid units %v", lib.Units)
+	}
+	names, err := lib.StructureNames(e.options.Order)
+	if err != nil {
+		return nil, err
+	}
+	data := []byte(oasisMagic)
+	data = append(data, oasisStart)
+	data = appendString(data, "1.0")
+	data = appendReal(data, oasisUnit(lib.Units[1]))
+	// table offsets follow in the END record
+	data = binary.AppendUvarint(data, 1)
+
+	// name tables with implicit reference numbers in order of first use
+	e.cells, e.texts = map[string]uint64{}, map[string]uint64{}
+	cellNames, texts := []string{}, []string{}
+	addCell := func(name string) {
+		if _, ok := e.cells[name]; !ok {
+			e.cells[name] = uint64(len(cellNames))
+			cellNames = append(cellNames, name)
+		}
+	}
+	properties := false
+	for _, name := range names {
+		addCell(name)
+	}
+	for _, name := range names {
+		for _, element := range lib.Structures[name].Elements {
+			switch el := asPointer(element).(type) {
+			case *SRef:
+				addCell(el.Sname)
+			case *ARef:
+				addCell(el.Sname)
+			case *Text:
+				if _, ok := e.texts[el.StringBody]; !ok {
+					e.texts[el.StringBody] = uint64(len(texts))
+					texts = append(texts, el.StringBody)
+				}
+			}
+			properties = properties || len(asPointer(element).(elementInfo).info().Properties) > 0
+		}
+	}
+	for _, name := range cellNames {
+		data = appendString(append(data, oasisCellName), name)
+	}
+	for _, text := range texts {
+		data = appendString(append(data, oasisTextString), text)
+	}
+	if properties {
+		data = appendString(append(data, oasisPropName), oasisGDSProperty)
+	}
+
+	for _, name := range names {
+		e.data = e.data[:0]
+		err := e.encodeCell(lib.Structures[name])
+		if err != nil {
+			return nil, fmt.Errorf("could not encode cell %s: %v", name, err)
+		}
+		if !e.options.Compress {
+			data = append(data, e.data...)
+			continue
+		}
+		var compressed bytes.Buffer
+		writer, err := flate.NewWriter(&compressed, flate.BestCompression)
+		if err == nil {
+			_, err = writer.Write(e.data)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not compress cell %s: %v", name, err)
+		}
+		data = append(data, oasisCBlock, 0)
+		data = binary.AppendUvarint(data, uint64(len(e.data)))
+		data = binary.AppendUvarint(data, uint64(compressed.Len()))
+		data = append(data, compressed.Bytes()...)
+	}
+
+	// END with zero table offsets, padding to the fixed record size and no validation
+	end := append([]byte{oasisEnd}, make([]byte, 12)...)
+	padding := oasisEndSize - len(end) - 2 - 1
+	end = binary.AppendUvarint(end, uint64(padding))
+	end = append(end, make([]byte, padding)...)
+	end = append(end, 0)
+	return append(data, end...), nil
+}
+
+func (e *oasisEncoder) encodeCell(structure *Structure) error {
+	e.modal = oasisModal{}
+	e.data = append(e.data, oasisCellRef)
+	e.data = binary.AppendUvarint(e.data, e.cells[structure.StrName])
+	for i, element := range structure.Elements {
+		var err error
+		switch el := asPointer(element).(type) {
+		case *Boundary:
+			err = e.encodePolygon(el.Layer, el.Datatype, el.XY)
+		case *Box:
+			err = e.encodePolygon(el.Layer, el.Boxtype, el.XY)
+		case *Path:
+			err = e.encodePath(el)
+		case *Text:
+			err = e.encodeText(el)
+		case *SRef:
+			err = e.encodePlacement(el.Sname, el.Strans, el.Mag, el.Angle, el.XY, nil)
+		case *ARef:
+			err = e.encodeArray(el)
+		default:
+			// nodes have no OASIS equivalent
+			continue
+		}
+		if err == nil {
+			err = e.encodeProperties(asPointer(element).(elementInfo).info().Properties)
+		}
+		if err != nil {
+			return fmt.Errorf("could not encode element %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Sets the L and D bits of info for a layer and datatype differing from the modal values
+func layerBits(info byte, layer, datatype int16, layerVar, datatypeVar *modal[uint64]) (byte, error) {
+	if layer < 0 || datatype < 0 {
+		return 0, fmt.Errorf("negative layer %d/%d", layer, datatype)
+	}
+	if changed(layerVar, uint64(layer)) {
+		info |= 0x01
+	}
+	if changed(datatypeVar, uint64(datatype)) {
+		info |= 0x02
+	}
+	return info, nil
+}
+
+func (e *oasisEncoder) appendLayer(info byte, layer, datatype int16) {
+	if info&0x01 != 0 {
+		e.data = binary.AppendUvarint(e.data, uint64(layer))
+	}
+	if info&0x02 != 0 {
+		e.data = binary.AppendUvarint(e.data, uint64(datatype))
+	}
+}
+
+// Sets the X and Y bits of info for a position differing from the modal position
+func positionBits(info byte, xBit, yBit byte, x, y int64, modalX, modalY *int64) byte {
+	if changedCoordinate(modalX, x) {
+		info |= xBit
+	}
+	if changedCoordinate(modalY, y) {
+		info |= yBit
+	}
+	return info
+}
+
+func (e *oasisEncoder) appendPosition(info byte, xBit, yBit byte, x, y int64) {
+	if info&xBit != 0 {
+		e.data = appendSint(e.data, x)
+	}
+	if info&yBit != 0 {
+		e.data = appendSint(e.data, y)
+	}
+}
+
+// Returns the position and size of an axis-parallel rectangle given as open ring
+func rectangle(ring []int32) (x, y, w, h int32, ok bool) {
+	if len(ring) != 8 {
+		return 0, 0, 0, 0, false
+	}
+	box := BoundingBox([][]int32{ring})
+	corners := map[[2]int32]bool{}
+	for i := range 4 {
+		px, py := ring[2*i], ring[2*i+1]
+		qx, qy := ring[(2*i+2)%8], ring[(2*i+3)%8]
+		if (px == qx) == (py == qy) || (px != box[0] && px != box[2]) || (py != box[1] && py != box[3]) {
+			return 0, 0, 0, 0, false
+		}
+		corners[[2]int32{px, py}] = true
+	}
+	return box[0], box[1], box[2] - box[0], box[3] - box[1], len(corners) == 4
+}
+
+func (e *oasisEncoder) encodePolygon(layer, datatype int16, xy []int32) error {
+	ring := openRing(xy)
+	if len(ring) < 6 {
+		return fmt.Errorf("polygon with %d points", len(ring)/2)
+	}
+	if x, y, w, h, ok := rectangle(ring); ok {
+		var info byte
+		if w == h {
+			info |= 0x80
+		}
+		if changed(&e.modal.width, uint64(w)) {
+			info |= 0x40
+		}
+		if changed(&e.modal.height, uint64(h)) && w != h {
+			info |= 0x20
+		}
+		info = positionBits(info, 0x10, 0x08, int64(x), int64(y), &e.modal.geometryX, &e.modal.geometryY)
+		info, err := layerBits(info, layer, datatype, &e.modal.layer, &e.modal.datatype)
+		if err != nil {
+			return err
+		}
+		e.data = append(e.data, oasisRectangle, info)
+		e.appendLayer(info, layer, datatype)
+		if info&0x40 != 0 {
+			e.data = binary.AppendUvarint(e.data, uint64(w))
+		}
+		if info&0x20 != 0 {
+			e.data = binary.AppendUvarint(e.data, uint64(h))
+		}
+		e.appendPosition(info, 0x10, 0x08, int64(x), int64(y))
+		return nil
+	}
+	points := relativePoints(ring)
+	var info byte
+	if !e.modal.polygonPoints.set || !slices.Equal(e.modal.polygonPoints.value, points) {
+		e.modal.polygonPoints.put(points)
+		info |= 0x20
+	}
+	info = positionBits(info, 0x10, 0x08, int64(ring[0]), int64(ring[1]), &e.modal.geometryX, &e.modal.geometryY)
+	info, err := layerBits(info, layer, datatype, &e.modal.layer, &e.modal.datatype)
+	if err != nil {
+		return err
+	}
+	e.data = append(e.data, oasisPolygon, info)
+	e.appendLayer(info, layer, datatype)
+	if info&0x20 != 0 {
+		e.data = appendPointList(e.data, points)
+	}
+	e.appendPosition(info, 0x10, 0x08, int64(ring[0]), int64(ring[1]))
+	return nil
+}
+
+// Returns the extension scheme bits of one path end, 0 reuses the modal value
+func extensionScheme(extension *modal[int64], value int64, halfWidth int64) uint64 {
+	switch {
+	case !changed(extension, value):
+		return 0
+	case value == 0:
+		return 1
+	case value == halfWidth:
+		return 2
+	}
+	return 3
+}
+
+func (e *oasisEncoder) encodePath(path *Path) error {
+	if len(path.XY) < 4 {
+		return fmt.Errorf("path with %d points", len(path.XY)/2)
+	}
+	width := int64(path.width())
+	if path.pathtype() == 1 || width%2 != 0 {
+		outline := PathOutline(path)
+		if outline == nil {
+			return nil
+		}
+		return e.encodePolygon(path.Layer, path.Datatype, outline)
+	}
+	halfWidth := max(width, -width) / 2
+	var start, end int64
+	switch path.pathtype() {
+	case 2:
+		start, end = halfWidth, halfWidth
+	case 4:
+		start, end = int64(path.Bgnextn), int64(path.Endextn)
+	}
+	var info byte
+	if changed(&e.modal.halfWidth, uint64(halfWidth)) {
+		info |= 0x40
+	}
+	scheme := extensionScheme(&e.modal.startExtension, start, halfWidth)<<2 | extensionScheme(&e.modal.endExtension, end, halfWidth)
+	if scheme != 0 {
+		info |= 0x80
+	}
+	points := relativePoints(path.XY)
+	if !e.modal.pathPoints.set || !slices.Equal(e.modal.pathPoints.value, points) {
+		e.modal.pathPoints.put(points)
+		info |= 0x20
+	}
+	x, y := int64(path.XY[0]), int64(path.XY[1])
+	info = positionBits(info, 0x10, 0x08, x, y, &e.modal.geometryX, &e.modal.geometryY)
+	info, err := layerBits(info, path.Layer, path.Datatype, &e.modal.layer, &e.modal.datatype)
+	if err != nil {
+		return err
+	}
+	e.data = append(e.data, oasisPath, info)
+	e.appendLayer(info, path.Layer, path.Datatype)
+	if info&0x40 != 0 {
+		e.data = binary.AppendUvarint(e.data, uint64(halfWidth))
+	}
+	if info&0x80 != 0 {
+		e.data = binary.AppendUvarint(e.data, scheme)
+		if scheme>>2 == 3 {
+			e.data = appendSint(e.data, start)
+		}
+		if scheme&3 == 3 {
+			e.data = appendSint(e.data, end)
+		}
+	}
+	if info&0x20 != 0 {
+		e.data = appendPointList(e.data, points)
+	}
+	e.appendPosition(info, 0x10, 0x08, x, y)
+	return nil
+}
+
+// Appends a text, OASIS texts have no presentation and transformation, Presentation, Strans, Mag and Angle are dropped
+func (e *oasisEncoder) encodeText(text *Text) error {
+	if len(text.XY) < 2 {
+		return fmt.Errorf("text without position")
+	}
+	ref := e.texts[text.StringBody]
+	var info byte
+	if changed(&e.modal.textString, oasisName{ref: ref, byRef: true}) {
+		info |= 0x60
+	}
+	x, y := int64(text.XY[0]), int64(text.XY[1])
+	info = positionBits(info, 0x10, 0x08, x, y, &e.modal.textX, &e.modal.textY)
+	info, err := layerBits(info, text.Layer, text.Texttype, &e.modal.textLayer, &e.modal.textType)
+	if err != nil {
+		return err
+	}
+	e.data = append(e.data, oasisText, info)
+	if info&0x40 != 0 {
+		e.data = binary.AppendUvarint(e.data, ref)
+	}
+	e.appendLayer(info, text.Layer, text.Texttype)
+	e.appendPosition(info, 0x10, 0x08, x, y)
+	return nil
+}
+
+// Appends a placement of cell at xy with a repetition if given. Only the reflection bit of strans is used,
+// the absolute magnification and angle bits are dropped.
+func (e *oasisEncoder) encodePlacement(cell string, strans uint16, mag, angle float64, xy []int32, repetition []byte) error {
+	if len(xy) < 2 {
+		return fmt.Errorf("reference without position")
+	}
+	var info byte
+	ref := e.cells[cell]
+	if changed(&e.modal.placementCell, oasisName{ref: ref, byRef: true}) {
+		info |= 0xc0
+	}
+	if strans&0x8000 != 0 {
+		info |= 0x01
+	}
+	if mag == 0 {
+		mag = 1
+	}
+	angle = math.Mod(angle, 360)
+	if angle < 0 {
+		angle += 360
+	}
+	id := byte(oasisPlacement)
+	if mag == 1 && math.Mod(angle, 90) == 0 {
+		info |= byte(angle/90) << 1
+	} else {
+		id = oasisPlacementTrans
+		if mag != 1 {
+			info |= 0x04
+		}
+		if angle != 0 {
+			info |= 0x02
+		}
+	}
+	x, y := int64(xy[0]), int64(xy[1])
+	info = positionBits(info, 0x20, 0x10, x, y, &e.modal.placementX, &e.modal.placementY)
+	if repetition != nil {
+		info |= 0x08
+	}
+	e.data = append(e.data, id, info)
+	if info&0x80 != 0 {
+		e.data = binary.AppendUvarint(e.data, ref)
+	}
+	if id == oasisPlacementTrans && info&0x04 != 0 {
+		e.data = appendReal(e.data, mag)
+	}
+	if id == oasisPlacementTrans && info&0x02 != 0 {
+		e.data = appendReal(e.data, angle)
+	}
+	e.appendPosition(info, 0x20, 0x10, x, y)
+	e.data = append(e.data, repetition...)
+	return nil
+}
+
+// Appends an array as placement with a repetition, arrays with pitches that are not integer are expanded
+func (e *oasisEncoder) encodeArray(ref *ARef) error {
+	if len(ref.Colrow) != 2 || ref.Colrow[0] < 1 || ref.Colrow[1] < 1 || len(ref.XY) != 6 {
+		return fmt.Errorf("invalid array %v", ref)
+	}
+	cols, rows := int64(ref.Colrow[0]), int64(ref.Colrow[1])
+	x0, y0 := int64(ref.XY[0]), int64(ref.XY[1])
+	colX, colY := int64(ref.XY[2])-x0, int64(ref.XY[3])-y0
+	rowX, rowY := int64(ref.XY[4])-x0, int64(ref.XY[5])-y0
+	if colX%cols != 0 || colY%cols != 0 || rowX%rows != 0 || rowY%rows != 0 {
+		for _, position := range arrayPositions(ref) {
+			xy := []int32{int32(math.Round(position[0])), int32(math.Round(position[1]))}
+			err := e.encodePlacement(ref.Sname, ref.Strans, ref.Mag, ref.Angle, xy, nil)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	col := [2]int64{colX / cols, colY / cols}
+	row := [2]int64{rowX / rows, rowY / rows}
+	var repetition []byte
+	switch {
+	case cols > 1 && rows > 1 && col[1] == 0 && row[0] == 0 && col[0] >= 0 && row[1] >= 0:
+		repetition = binary.AppendUvarint(nil, 1)
+		for _, value := range []int64{cols - 2, rows - 2, col[0], row[1]} {
+			repetition = binary.AppendUvarint(repetition, uint64(value))
+		}
+	case cols > 1 && rows > 1:
+		repetition = binary.AppendUvarint(nil, 8)
+		repetition = binary.AppendUvarint(repetition, uint64(cols-2))
+		repetition = binary.AppendUvarint(repetition, uint64(rows-2))
+		repetition = appendGDelta(appendGDelta(repetition, col), row)
+	case cols > 1 && col[1] == 0 && col[0] >= 0:
+		repetition = binary.AppendUvarint(binary.AppendUvarint(binary.AppendUvarint(nil, 2), uint64(cols-2)), uint64(col[0]))
+	case rows > 1 && row[0] == 0 && row[1] >= 0:
+		repetition = binary.AppendUvarint(binary.AppendUvarint(binary.AppendUvarint(nil, 3), uint64(rows-2)), uint64(row[1]))
+	case cols > 1:
+		repetition = appendGDelta(binary.AppendUvarint(binary.AppendUvarint(nil, 9), uint64(cols-2)), col)
+	case rows > 1:
+		repetition = appendGDelta(binary.AppendUvarint(binary.AppendUvarint(nil, 9), uint64(rows-2)), row)
+	}
+	return e.encodePlacement(ref.Sname, ref.Strans, ref.Mag, ref.Angle, ref.XY[:2], repetition)
+}
+
+// Appends the properties as S_GDS_PROPERTY
+func (e *oasisEncoder) encodeProperties(properties []Property) error {
+	for _, property := range properties {
+		if property.Attribute < 0 {
+			return fmt.Errorf("negative property attribute %d", property.Attribute)
+		}
+		// two values with name given by reference number 0, the only PROPNAME
+		e.data = append(e.data, oasisProperty, 0x27, 0, 8)
+		e.data = binary.AppendUvarint(e.data, uint64(property.Attribute))
+		e.data = appendString(append(e.data, 11), property.Value)
+	}
+	return nil
+}
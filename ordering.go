@@ -0,0 +1,116 @@
+package gds
+
+import (
+	"fmt"
+	"sort"
+)
+
+// StructureOrder defines the order in which structures of a library are written
+type StructureOrder int
+
+const (
+	// Order in which the structures were read or created, unknown structures are appended alphabetically
+	OrderInput StructureOrder = iota
+	// Alphabetical order of the structure names
+	OrderAlphabetical
+	// Referenced structures are written before the structures referencing them
+	OrderBottomUp
+)
+
+func (o StructureOrder) String() string {
+	switch o {
+	case OrderInput:
+		return "input"
+	case OrderAlphabetical:
+		return "alphabetical"
+	case OrderBottomUp:
+		return "bottom-up"
+	default:
+		return fmt.Sprintf("StructureOrder(%d)", int(o))
+	}
+}
+
+// StructureNames returns the names of all structures in the library in the requested order
+func (l Library) StructureNames(order StructureOrder) ([]string, error) {
+	switch order {
+	case OrderInput:
+		return l.inputOrder(), nil
+	case OrderAlphabetical:
+		names := make([]string, 0, len(l.Structures))
+		for name := range l.Structures {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names, nil
+	case OrderBottomUp:
+		return l.bottomUpOrder()
+	default:
+		return []string{}, fmt.Errorf("unknown structure order: %v", order)
+	}
+}
+
+func (l Library) inputOrder() []string {
+	names := make([]string, 0, len(l.Structures))
+	seen := map[string]bool{}
+	for _, name := range l.StructureOrder {
+		if _, ok := l.Structures[name]; ok && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+	remaining := []string{}
+	for name := range l.Structures {
+		if !seen[name] {
+			remaining = append(remaining, name)
+		}
+	}
+	sort.Strings(remaining)
+	return append(names, remaining...)
+}
+
+// Depth-first post-order traversal of the reference graph, starting from the structures in input order.
+// References to structures outside of the library are ignored.
+func (l Library) bottomUpOrder() ([]string, error) {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	names := make([]string, 0, len(l.Structures))
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("reference cycle through structure %s", name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, element := range l.Structures[name].Elements {
+			ref, ok := element.(Reference)
+			if !ok {
+				continue
+			}
+			if _, ok := l.Structures[ref.GetSname()]; !ok {
+				continue
+			}
+			err := visit(ref.GetSname())
+			if err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		names = append(names, name)
+		return nil
+	}
+
+	for _, name := range l.inputOrder() {
+		err := visit(name)
+		if err != nil {
+			return []string{}, fmt.Errorf("could not sort structures bottom-up: %v", err)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,338 @@
+package gds
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RasterOptions configures Render and WritePNG
+type RasterOptions struct {
+	// Size of the image in pixels. With only one of them set the other follows from the aspect ratio of the cell,
+	// with both set the cell is centered. Width defaults to 1000.
+	Width  int
+	Height int
+	// Styles by layer/datatype, hatched layers are drawn with a stipple of the stroke color
+	Styles map[string]LayerStyle
+	// Distance between stipple lines in pixels, defaults to 8
+	Stipple int
+	// Background color, transparent if empty
+	Background string
+}
+
+// Number of sub-scanlines per pixel row used for anti-aliasing
+const rasterSamples = 4
+
+// Edge of a polygon in pixel coordinates with y0 < y1, dir is the winding direction
+type rasterEdge struct {
+	x0, y0, x1, y1 float64
+	dir            int
+}
+
+// Render draws all boundaries, boxes and paths placed in cell into an image with anti-aliased edges. Every layer is
+// blended over the layers below it with its fill opacity, outlines are drawn opaque. Labels are not drawn.
+func Render(lib *Library, cell string, opts RasterOptions) (*image.RGBA, error) {
+	polygons, err := lib.FlattenPolygons(cell)
+	if err != nil {
+		return nil, fmt.Errorf("could not render cell %s: %v", cell, err)
+	}
+	all := [][]int32{}
+	for _, layer := range polygons {
+		all = append(all, layer...)
+	}
+	box := BoundingBox(all)
+	if box == nil {
+		return nil, fmt.Errorf("could not render cell %s, cell is empty", cell)
+	}
+	width, height := float64(box[2]-box[0]), float64(box[3]-box[1])
+	if opts.Width <= 0 && opts.Height <= 0 {
+		opts.Width = 1000
+	}
+	// one pixel of border keeps outlines at the bounding box inside the image
+	switch {
+	case opts.Height <= 0:
+		opts.Height = max(int(math.Round(float64(opts.Width-2)*height/max(width, 1)))+2, 3)
+	case opts.Width <= 0:
+		opts.Width = max(int(math.Round(float64(opts.Height-2)*width/max(height, 1)))+2, 3)
+	}
+	if opts.Width < 3 || opts.Height < 3 {
+		return nil, fmt.Errorf("could not render cell %s, image size %dx%d is too small", cell, opts.Width, opts.Height)
+	}
+	if opts.Stipple <= 0 {
+		opts.Stipple = 8
+	}
+	scale := min(float64(opts.Width-2)/max(width, 1), float64(opts.Height-2)/max(height, 1))
+	offsetX := (float64(opts.Width) - width*scale) / 2
+	offsetY := (float64(opts.Height) - height*scale) / 2
+	toPixel := func(x, y int32) (float64, float64) {
+		return float64(x-box[0])*scale + offsetX, float64(box[3]-y)*scale + offsetY
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	if opts.Background != "" {
+		background, err := parseColor(opts.Background)
+		if err != nil {
+			return nil, err
+		}
+		for y := 0; y < opts.Height; y++ {
+			for x := 0; x < opts.Width; x++ {
+				img.Set(x, y, background)
+			}
+		}
+	}
+	layers, styles := layerStyles(polygons, nil, opts.Styles)
+	fillMask := make([]float64, opts.Width*opts.Height)
+	strokeMask := make([]float64, opts.Width*opts.Height)
+	for _, layer := range layers {
+		style := styles[layer]
+		if style.Hidden {
+			continue
+		}
+		// the fill color is only used by solid fills, hatches are drawn in the stroke color
+		var fill color.NRGBA
+		if style.Hatch == HatchSolid {
+			var err error
+			fill, err = parseColor(style.Fill)
+			if err != nil {
+				return nil, fmt.Errorf("could not render layer %s: %v", layer, err)
+			}
+		}
+		stroke, err := parseColor(style.Stroke)
+		if err != nil {
+			return nil, fmt.Errorf("could not render layer %s: %v", layer, err)
+		}
+		clear(fillMask)
+		clear(strokeMask)
+		edges := []rasterEdge{}
+		for _, polygon := range polygons[layer] {
+			ring := openRing(polygon)
+			n := len(ring) / 2
+			for i := 0; i < n; i++ {
+				j := (i + 1) % n
+				x0, y0 := toPixel(ring[2*i], ring[2*i+1])
+				x1, y1 := toPixel(ring[2*j], ring[2*j+1])
+				drawLine(strokeMask, opts.Width, opts.Height, x0, y0, x1, y1, style.StrokeWidth)
+				switch {
+				case y0 < y1:
+					edges = append(edges, rasterEdge{x0, y0, x1, y1, 1})
+				case y0 > y1:
+					edges = append(edges, rasterEdge{x1, y1, x0, y0, -1})
+				}
+			}
+		}
+		if style.Hatch != HatchNone {
+			fillCoverage(fillMask, opts.Width, opts.Height, edges)
+		}
+		for y := 0; y < opts.Height; y++ {
+			for x := 0; x < opts.Width; x++ {
+				i := y*opts.Width + x
+				if coverage := fillMask[i]; coverage > 0 {
+					switch {
+					case style.Hatch == HatchSolid:
+						blend(img, x, y, fill, coverage*style.FillOpacity)
+					case stipple(style.Hatch, x, y, opts.Stipple):
+						blend(img, x, y, stroke, coverage*style.FillOpacity)
+					}
+				}
+				if coverage := strokeMask[i]; coverage > 0 {
+					blend(img, x, y, stroke, coverage)
+				}
+			}
+		}
+	}
+	return img, nil
+}
+
+// WritePNG renders cell as PNG image, see Render
+func WritePNG(w io.Writer, lib *Library, cell string, opts RasterOptions) error {
+	img, err := Render(lib, cell, opts)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(w, img)
+	if err != nil {
+		return fmt.Errorf("could not write image: %v", err)
+	}
+	return nil
+}
+
+// Adds the area of the image covered by the edges under the nonzero winding rule to mask
+func fillCoverage(mask []float64, width, height int, edges []rasterEdge) {
+	sort.Slice(edges, func(i, j int) bool { return edges[i].y0 < edges[j].y0 })
+	type crossing struct {
+		x   float64
+		dir int
+	}
+	row := make([]float64, width)
+	active := []rasterEdge{}
+	next := 0
+	for y := 0; y < height; y++ {
+		for s := 0; s < rasterSamples; s++ {
+			scan := float64(y) + (float64(s)+0.5)/rasterSamples
+			for next < len(edges) && edges[next].y0 <= scan {
+				active = append(active, edges[next])
+				next++
+			}
+			crossings := []crossing{}
+			kept := active[:0]
+			for _, e := range active {
+				if e.y1 <= scan {
+					continue
+				}
+				kept = append(kept, e)
+				if e.y0 <= scan {
+					crossings = append(crossings, crossing{e.x0 + (scan-e.y0)*(e.x1-e.x0)/(e.y1-e.y0), e.dir})
+				}
+			}
+			active = kept
+			sort.Slice(crossings, func(i, j int) bool { return crossings[i].x < crossings[j].x })
+			winding := 0
+			for i, c := range crossings {
+				winding += c.dir
+				if winding != 0 && i+1 < len(crossings) {
+					addSpan(row, c.x, crossings[i+1].x, 1.0/rasterSamples)
+				}
+			}
+		}
+		for x := range row {
+			mask[y*width+x] = min(mask[y*width+x]+row[x], 1)
+			row[x] = 0
+		}
+	}
+}
+
+// Adds weight times the covered fraction of every pixel between x0 and x1 to row
+func addSpan(row []float64, x0, x1, weight float64) {
+	x0, x1 = max(x0, 0), min(x1, float64(len(row)))
+	if x1 <= x0 {
+		return
+	}
+	i0, i1 := int(x0), int(x1)
+	if i0 == i1 {
+		row[i0] += (x1 - x0) * weight
+		return
+	}
+	row[i0] += (float64(i0+1) - x0) * weight
+	for i := i0 + 1; i < i1; i++ {
+		row[i] += weight
+	}
+	if i1 < len(row) {
+		row[i1] += (x1 - float64(i1)) * weight
+	}
+}
+
+// Draws an anti-aliased line of the given width in pixels into mask, stepping along the major axis and splitting
+// the coverage between the two nearest pixels of the minor axis
+func drawLine(mask []float64, width, height int, x0, y0, x1, y1, lineWidth float64) {
+	steep := math.Abs(y1-y0) > math.Abs(x1-x0)
+	if steep {
+		x0, y0, x1, y1 = y0, x0, y1, x1
+	}
+	if x0 > x1 {
+		x0, y0, x1, y1 = x1, y1, x0, y0
+	}
+	plot := func(u, v int, coverage float64) {
+		x, y := u, v
+		if steep {
+			x, y = v, u
+		}
+		if x < 0 || y < 0 || x >= width || y >= height {
+			return
+		}
+		mask[y*width+x] = max(mask[y*width+x], coverage)
+	}
+	gradient := 0.0
+	if x1 > x0 {
+		gradient = (y1 - y0) / (x1 - x0)
+	}
+	lines := max(int(math.Round(lineWidth)), 1)
+	for u := int(math.Floor(x0)); u <= int(math.Floor(x1)) && u < max(width, height); u++ {
+		if u < 0 {
+			continue
+		}
+		center := min(max(float64(u)+0.5, x0), x1)
+		v := y0 + (center-x0)*gradient - 0.5
+		for k := 0; k < lines; k++ {
+			offset := v + float64(k) - float64(lines-1)/2
+			base := math.Floor(offset)
+			fraction := offset - base
+			plot(u, int(base), 1-fraction)
+			plot(u, int(base)+1, fraction)
+		}
+	}
+}
+
+// Reports whether the pixel at x, y belongs to the stipple pattern of hatch
+func stipple(hatch Hatch, x, y, spacing int) bool {
+	on := func(v int) bool {
+		return ((v%spacing)+spacing)%spacing == 0
+	}
+	switch hatch {
+	case HatchDiagonal:
+		return on(x + y)
+	case HatchBackDiagonal:
+		return on(x - y)
+	case HatchCross:
+		return on(x) || on(y)
+	case HatchHorizontal:
+		return on(y)
+	case HatchVertical:
+		return on(x)
+	}
+	return true
+}
+
+// Blends c with the given opacity over the pixel at x, y
+func blend(img *image.RGBA, x, y int, c color.NRGBA, opacity float64) {
+	alpha := float64(c.A) / 255 * min(opacity, 1)
+	i := img.PixOffset(x, y)
+	pixel := img.Pix[i : i+4 : i+4]
+	for k, value := range [4]uint8{c.R, c.G, c.B, 255} {
+		pixel[k] = uint8(math.Round(float64(value)*alpha + float64(pixel[k])*(1-alpha)))
+	}
+}
+
+// Named colors accepted besides hexadecimal notation
+var namedColors = map[string]color.NRGBA{
+	"black":       {0, 0, 0, 255},
+	"white":       {255, 255, 255, 255},
+	"red":         {255, 0, 0, 255},
+	"green":       {0, 128, 0, 255},
+	"lime":        {0, 255, 0, 255},
+	"blue":        {0, 0, 255, 255},
+	"yellow":      {255, 255, 0, 255},
+	"cyan":        {0, 255, 255, 255},
+	"magenta":     {255, 0, 255, 255},
+	"gray":        {128, 128, 128, 255},
+	"grey":        {128, 128, 128, 255},
+	"orange":      {255, 165, 0, 255},
+	"purple":      {128, 0, 128, 255},
+	"none":        {},
+	"transparent": {},
+}
+
+// Parses a CSS color given as #rgb, #rrggbb, #rrggbbaa or by one of the basic color names
+func parseColor(s string) (color.NRGBA, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if c, ok := namedColors[s]; ok {
+		return c, nil
+	}
+	hex, ok := strings.CutPrefix(s, "#")
+	if ok && len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if ok && len(hex) == 6 {
+		hex += "ff"
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if !ok || len(hex) != 8 || err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	return color.NRGBA{uint8(value >> 24), uint8(value >> 16), uint8(value >> 8), uint8(value)}, nil
+}
@@ -0,0 +1,105 @@
+package gds
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	library := NewLibrary("RASTER", 1e-6, 1e-9)
+	cell, err := library.NewCell("CELL")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	cell.AddRect(LayerSpec{1, 0}, 0, 0, 1000, 500)
+	cell.AddRect(LayerSpec{2, 0}, 0, 500, 1000, 1000)
+	cell.AddRect(LayerSpec{3, 0}, 0, 0, 1000, 1000)
+
+	// 100 pixels for 1000 units with one pixel of border
+	img, err := Render(library, "CELL", RasterOptions{
+		Width:      102,
+		Background: "black",
+		Styles: map[string]LayerStyle{
+			"1/0": {Fill: "#ff0000", FillOpacity: 1},
+			"2/0": {Fill: "#00f", FillOpacity: 1, Hatch: HatchHorizontal},
+			"3/0": {Hidden: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not render cell: %v", err)
+	}
+	assertEqual(t, "(0,0)-(102,102)", img.Bounds().String())
+	assertEqual(t, "{0 0 0 255}", fmt.Sprint(img.At(0, 0)))
+	// the bottom half is filled, the top half has a line every 8 pixels
+	assertEqual(t, "{255 0 0 255}", fmt.Sprint(img.At(50, 80)))
+	assertEqual(t, "{0 0 255 255}", fmt.Sprint(img.At(50, 24)))
+	assertEqual(t, "{0 0 0 255}", fmt.Sprint(img.At(50, 25)))
+	// outlines on a pixel border are split between both rows
+	assertEqual(t, "{0 0 128 255}", fmt.Sprint(img.At(50, 0)))
+	assertEqual(t, "{0 0 128 255}", fmt.Sprint(img.At(50, 1)))
+	assertEqual(t, "{255 0 0 255}", fmt.Sprint(img.At(1, 80)))
+
+	// edges between pixels are blended with the background
+	cell.AddRect(LayerSpec{4, 0}, 0, 0, 15, 15)
+	img, err = Render(library, "CELL", RasterOptions{
+		Width:      102,
+		Background: "white",
+		Styles:     map[string]LayerStyle{"4/0": {Fill: "black", Stroke: "none", FillOpacity: 1}, "1/0": {Hidden: true}, "2/0": {Hidden: true}, "3/0": {Hidden: true}},
+	})
+	if err != nil {
+		t.Fatalf("could not render cell: %v", err)
+	}
+	assertEqual(t, "{0 0 0 255}", fmt.Sprint(img.At(1, 100)))
+	assertEqual(t, "{128 128 128 255}", fmt.Sprint(img.At(2, 100)))
+	assertEqual(t, "{191 191 191 255}", fmt.Sprint(img.At(2, 99)))
+
+	// outlines only, the fill color is not needed
+	img, err = Render(library, "CELL", RasterOptions{
+		Width:      102,
+		Background: "white",
+		Styles:     map[string]LayerStyle{"1/0": {Stroke: "red", Hatch: HatchNone}, "2/0": {Hidden: true}, "3/0": {Hidden: true}, "4/0": {Hidden: true}},
+	})
+	if err != nil {
+		t.Fatalf("could not render outlines: %v", err)
+	}
+	assertEqual(t, "{255 255 255 255}", fmt.Sprint(img.At(50, 80)))
+
+	var buffer bytes.Buffer
+	err = WritePNG(&buffer, library, "CELL", RasterOptions{Height: 52})
+	if err != nil {
+		t.Fatalf("could not write image: %v", err)
+	}
+	decoded, err := png.Decode(&buffer)
+	if err != nil {
+		t.Fatalf("could not decode image: %v", err)
+	}
+	assertEqual(t, "(0,0)-(52,52)", decoded.Bounds().String())
+
+	_, err = Render(library, "CELL", RasterOptions{Styles: map[string]LayerStyle{"1/0": {Fill: "rgb(1,2,3)"}}})
+	if err == nil {
+		t.Fatalf("could render invalid color")
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	for s, expected := range map[string]string{
+		"#102030":   "{16 32 48 255}",
+		"#fff":      "{255 255 255 255}",
+		"#10203040": "{16 32 48 64}",
+		" Orange":   "{255 165 0 255}",
+	} {
+		c, err := parseColor(s)
+		if err != nil {
+			t.Fatalf("could not parse %s: %v", s, err)
+		}
+		assertEqual(t, expected, fmt.Sprint(c))
+	}
+	for _, s := range []string{"", "#12", "#gggggg", "salmon"} {
+		_, err := parseColor(s)
+		if err == nil {
+			t.Fatalf("could parse invalid color %q", s)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package gds
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+// Hatch selects the fill pattern of a layer
+type Hatch int
+
+const (
+	// Fills shapes with the fill color
+	HatchSolid Hatch = iota
+	// Draws outlines only
+	HatchNone
+	HatchDiagonal
+	HatchBackDiagonal
+	HatchCross
+	HatchHorizontal
+	HatchVertical
+)
+
+func (h Hatch) String() string {
+	switch h {
+	case HatchSolid:
+		return "solid"
+	case HatchNone:
+		return "none"
+	case HatchDiagonal:
+		return "diagonal"
+	case HatchBackDiagonal:
+		return "back-diagonal"
+	case HatchCross:
+		return "cross"
+	case HatchHorizontal:
+		return "horizontal"
+	case HatchVertical:
+		return "vertical"
+	}
+	return fmt.Sprintf("Hatch(%d)", int(h))
+}
+
+// LayerStyle configures how the shapes and labels of a layer are drawn, colors are given as CSS colors
+type LayerStyle struct {
+	Fill string
+	// Opacity of the fill between 0 and 1, 0 defaults to 0.5
+	FillOpacity float64
+	// Stroke color of outlines and label color, defaults to Fill
+	Stroke string
+	// Width of outlines in pixels of the image, 0 defaults to 1
+	StrokeWidth float64
+	Hatch       Hatch
+	Hidden      bool
+}
+
+// Default colors of layers without style, assigned in layer order
+var defaultLayerColors = []string{
+	"#ff80a8", "#c080ff", "#9580ff", "#8086ff", "#80a8ff", "#ff0000", "#ff0080", "#ff00ff",
+	"#8000ff", "#0000ff", "#0080ff", "#00ffff", "#00ff80", "#00ff00", "#80ff00", "#ffff00",
+}
+
+// SVGOptions configures WriteSVG
+type SVGOptions struct {
+	// Width of the image in pixels, the height follows from the aspect ratio of the cell. Defaults to 1000.
+	Width int
+	// Styles by layer/datatype, layers without style get a solid fill with a color from a default palette
+	Styles map[string]LayerStyle
+	// Font size of labels in database units, 0 defaults to 2% of the cell height
+	LabelSize  float64
+	HideLabels bool
+	// Background color, transparent if empty
+	Background string
+}
+
+// WriteSVG draws all boundaries, boxes, paths and labels placed in cell as SVG. The view box is the bounding box
+// of the cell with the y axis pointing up. Every layer becomes a group with id "L<layer>_<datatype>", paths are
+// drawn as outlines with their real width and extensions.
+func WriteSVG(w io.Writer, lib *Library, cell string, opts SVGOptions) error {
+	polygons, err := lib.FlattenPolygons(cell)
+	if err != nil {
+		return fmt.Errorf("could not draw cell %s: %v", cell, err)
+	}
+	labels := map[string]*LabelLayer{}
+	if !opts.HideLabels {
+		labels, err = lib.FlattenLabels(cell)
+		if err != nil {
+			return fmt.Errorf("could not draw cell %s: %v", cell, err)
+		}
+	}
+	all := [][]int32{}
+	for _, layer := range polygons {
+		all = append(all, layer...)
+	}
+	for _, layer := range labels {
+		all = append(all, layer.LabelCoords...)
+	}
+	box := BoundingBox(all)
+	if box == nil {
+		return fmt.Errorf("could not draw cell %s, cell is empty", cell)
+	}
+	// keep labels and outlines at the border inside the image
+	margin := max(box[2]-box[0], box[3]-box[1])/50 + 1
+	x0, y0, width, height := box[0]-margin, box[1]-margin, box[2]-box[0]+2*margin, box[3]-box[1]+2*margin
+	if opts.Width <= 0 {
+		opts.Width = 1000
+	}
+	pixelHeight := max(int(math.Round(float64(opts.Width)*float64(height)/float64(width))), 1)
+	pixel := float64(width) / float64(opts.Width) // size of a pixel in database units
+	if opts.LabelSize <= 0 {
+		opts.LabelSize = float64(box[3]-box[1]) / 50
+	}
+	opts.LabelSize = max(opts.LabelSize, pixel)
+
+	layers, styles := layerStyles(polygons, labels, opts.Styles)
+
+	canvas := svg.New(w)
+	// the view box is flipped, y values are negated inside the drawing
+	canvas.Startview(opts.Width, pixelHeight, int(x0), int(-y0-height), int(width), int(height))
+	if opts.Background != "" {
+		canvas.Rect(int(x0), int(-y0-height), int(width), int(height), "fill:"+opts.Background)
+	}
+	canvas.Def()
+	for _, layer := range layers {
+		if style := styles[layer]; !style.Hidden && style.Hatch > HatchNone {
+			writeHatch(canvas, layerID(layer), style, max(int(math.Round(8*pixel)), 2))
+		}
+	}
+	canvas.DefEnd()
+	canvas.Gtransform("scale(1,-1)")
+	for _, layer := range layers {
+		style := styles[layer]
+		if style.Hidden || len(polygons[layer]) == 0 {
+			continue
+		}
+		fill := style.Fill
+		switch {
+		case style.Hatch == HatchNone:
+			fill = "none"
+		case style.Hatch > HatchNone:
+			fill = fmt.Sprintf("url(#%s-hatch)", layerID(layer))
+		}
+		canvas.Group(fmt.Sprintf(`id="%s"`, layerID(layer)), fmt.Sprintf("fill:%s;fill-opacity:%g;stroke:%s;stroke-width:%g;vector-effect:non-scaling-stroke",
+			fill, style.FillOpacity, style.Stroke, style.StrokeWidth))
+		for _, polygon := range polygons[layer] {
+			xs, ys := make([]int, len(polygon)/2), make([]int, len(polygon)/2)
+			for i := range xs {
+				xs[i], ys[i] = int(polygon[2*i]), int(polygon[2*i+1])
+			}
+			canvas.Polygon(xs, ys)
+		}
+		canvas.Gend()
+	}
+	canvas.Gend()
+	for _, layer := range layers {
+		style := styles[layer]
+		label, ok := labels[layer]
+		if style.Hidden || !ok {
+			continue
+		}
+		canvas.Group(fmt.Sprintf(`id="%s-labels"`, layerID(layer)), fmt.Sprintf("fill:%s;font-family:sans-serif;font-size:%gpx;text-anchor:middle;dominant-baseline:middle",
+			style.Stroke, opts.LabelSize))
+		for i, text := range label.Labels {
+			canvas.Text(int(label.LabelCoords[i][0]), -int(label.LabelCoords[i][1]), text)
+		}
+		canvas.Gend()
+	}
+	canvas.End()
+	return nil
+}
+
+// Returns the sorted layers of polygons and labels together with their style, missing values are filled with defaults
+func layerStyles(polygons map[string][][]int32, labels map[string]*LabelLayer, given map[string]LayerStyle) ([]string, map[string]LayerStyle) {
+	layers := []string{}
+	for layer := range polygons {
+		layers = append(layers, layer)
+	}
+	for layer := range labels {
+		if _, ok := polygons[layer]; !ok {
+			layers = append(layers, layer)
+		}
+	}
+	sortLayers(layers)
+	styles := map[string]LayerStyle{}
+	for i, layer := range layers {
+		style, ok := given[layer]
+		if !ok {
+			style = LayerStyle{Fill: defaultLayerColors[i%len(defaultLayerColors)]}
+		}
+		if style.Stroke == "" {
+			style.Stroke = style.Fill
+		}
+		if style.FillOpacity <= 0 {
+			style.FillOpacity = 0.5
+		}
+		if style.StrokeWidth <= 0 {
+			style.StrokeWidth = 1
+		}
+		styles[layer] = style
+	}
+	return layers, styles
+}
+
+// Returns an XML id for a layer/datatype string
+func layerID(layer string) string {
+	return "L" + strings.NewReplacer("/", "_", " ", "_").Replace(layer)
+}
+
+// Writes a pattern of lines with the stroke color on the fill color with the given spacing in database units
+func writeHatch(canvas *svg.SVG, id string, style LayerStyle, spacing int) {
+	rotation := 0
+	switch style.Hatch {
+	case HatchDiagonal:
+		rotation = 45
+	case HatchBackDiagonal:
+		rotation = -45
+	case HatchVertical:
+		rotation = 90
+	}
+	canvas.Pattern(id+"-hatch", 0, 0, spacing, spacing, "user", fmt.Sprintf(`patternTransform="rotate(%d)"`, rotation))
+	line := fmt.Sprintf("stroke:%s;stroke-width:%g;vector-effect:non-scaling-stroke", style.Stroke, style.StrokeWidth)
+	canvas.Line(0, spacing/2, spacing, spacing/2, line)
+	if style.Hatch == HatchCross {
+		canvas.Line(spacing/2, 0, spacing/2, spacing, line)
+	}
+	canvas.PatternEnd()
+}
@@ -0,0 +1,76 @@
+package gds
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteSVG(t *testing.T) {
+	library := NewLibrary("SVG", 1e-6, 1e-9)
+	cell, err := library.NewCell("CELL")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	cell.AddRect(LayerSpec{1, 0}, 0, 0, 1000, 500)
+	_, err = cell.AddPath(LayerSpec{2, 0}, 100, []int32{0, 250, 1000, 250})
+	if err != nil {
+		t.Fatalf("could not add path: %v", err)
+	}
+	cell.AddText(LayerSpec{3, 0}, 500, 250, "a<b")
+	top, err := library.NewCell("TOP")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	top.AddInstance("CELL", 0, 0)
+	top.AddInstance("CELL", 0, 1000)
+
+	var buffer bytes.Buffer
+	err = WriteSVG(&buffer, library, "TOP", SVGOptions{
+		Width: 200,
+		Styles: map[string]LayerStyle{
+			"1/0": {Fill: "blue", Hatch: HatchDiagonal},
+			"2/0": {Fill: "red", Hidden: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not draw cell: %v", err)
+	}
+	image := buffer.String()
+	for _, expected := range []string{
+		// bounding box 0, 0, 1000, 1500 with a margin of 31 and flipped y axis
+		`<svg width="200" height="294"`,
+		`viewBox="-31 -1531 1062 1562"`,
+		`<g transform="scale(1,-1)">`,
+		`<g id="L1_0" style="fill:url(#L1_0-hatch);fill-opacity:0.5;stroke:blue;`,
+		`<pattern id="L1_0-hatch"`,
+		`<polygon points="0,1000 1000,1000 1000,1500 0,1500" />`,
+		`<text x="500" y="-1250" >a&lt;b</text>`,
+	} {
+		if !strings.Contains(image, expected) {
+			t.Fatalf("image does not contain %s:\n%s", expected, image)
+		}
+	}
+	if strings.Contains(image, `id="L2_0"`) {
+		t.Fatalf("hidden layer was drawn:\n%s", image)
+	}
+
+	buffer.Reset()
+	err = WriteSVG(&buffer, library, "TOP", SVGOptions{HideLabels: true})
+	if err != nil {
+		t.Fatalf("could not draw cell: %v", err)
+	}
+	// paths are drawn with their width
+	if !strings.Contains(buffer.String(), `<polygon points="0,300 1000,300 1000,200 0,200" />`) || strings.Contains(buffer.String(), "<text") {
+		t.Fatalf("unexpected image:\n%s", buffer.String())
+	}
+
+	_, err = library.NewCell("EMPTY")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	err = WriteSVG(&buffer, library, "EMPTY", SVGOptions{})
+	if err == nil {
+		t.Fatalf("could draw empty cell")
+	}
+}
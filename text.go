@@ -0,0 +1,283 @@
+package gds
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Text format of GDSII streams, one record per line in stream order, similar to the GDS2 text of KLayout:
+//
+//	HEADER 600
+//	BGNLIB 2024 1 1 0 0 0 2024 1 1 0 0 0
+//	LIBNAME "LIB"
+//	UNITS 0.001 1e-09
+//	BGNSTR 2024 1 1 0 0 0 2024 1 1 0 0 0
+//	  STRNAME "TOP"
+//	  BOUNDARY
+//	    LAYER 1
+//	    DATATYPE 0
+//	    XY 0,0 100,0 100,100 0,100 0,0
+//	  ENDEL
+//	ENDSTR
+//	ENDLIB
+//
+// Each line starts with the record type followed by its values separated by whitespace: integers for 2- and 4-byte
+// integer records, hexadecimal, octal or decimal integers for bit arrays (STRANS 0x8000), reals for 8-byte real
+// records and a double quoted string with Go escapes for string records. XY coordinates are written as x,y pairs,
+// commas and whitespace are interchangeable when parsing. Records without data have no values.
+//
+// Records of unknown type and records whose data does not survive the conversion to text unchanged (e.g. reals with
+// a non-normalized mantissa) are written as RAW followed by the hexadecimal record type and data, so the binary
+// stream is reproduced byte by byte. Indentation is ignored, empty lines and lines starting with # are skipped.
+
+// Record type of records given as hexadecimal type and data
+const rawRecord = "RAW"
+
+// WriteTextRecords writes records in the text format, see ReadTextRecords for the conversion back
+func WriteTextRecords(f io.Writer, records []Record) error {
+	writer := bufio.NewWriter(f)
+	depth := 0
+	for _, record := range records {
+		switch record.Datatype {
+		case "ENDSTR", "ENDEL":
+			depth = max(depth-1, 0)
+		}
+		_, err := fmt.Fprintf(writer, "%s%s\n", strings.Repeat("  ", depth), formatTextRecord(record))
+		if err != nil {
+			return fmt.Errorf("could not write text records: %v", err)
+		}
+		switch record.Datatype {
+		case "BGNSTR", "BOUNDARY", "PATH", "SREF", "AREF", "TEXT", "NODE", "BOX":
+			depth++
+		}
+	}
+	err := writer.Flush()
+	if err != nil {
+		return fmt.Errorf("could not write text records: %v", err)
+	}
+	return nil
+}
+
+// WriteGDSText writes the records of the library in the text format
+func WriteGDSText(f io.Writer, lib *Library) error {
+	records, err := lib.Records()
+	if err != nil {
+		return fmt.Errorf("could not write GDSII text: %v", err)
+	}
+	return WriteTextRecords(f, records)
+}
+
+// ReadTextRecords parses records in the text format written by WriteTextRecords, the records can be written as binary
+// stream with WriteRecords. Errors report the line number and wrap ErrUnknownRecord or ErrInvalidRecord.
+func ReadTextRecords(f io.Reader) ([]Record, error) {
+	records := []Record{}
+	scanner := bufio.NewScanner(f)
+	// XY records hold up to 8190 points
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		record, err := parseTextRecord(text)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse GDSII text at line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("could not read GDSII text at line %d: %v", line+1, err)
+	}
+	return records, nil
+}
+
+// ReadGDSText parses a library in the text format
+func ReadGDSText(f io.Reader) (*Library, error) {
+	records, err := ReadTextRecords(f)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	err = WriteRecords(&buffer, records)
+	if err != nil {
+		return nil, err
+	}
+	return ReadGDS(&buffer)
+}
+
+// Formats the record as a line of text, falls back to RAW if the line would not parse into the same record
+func formatTextRecord(record Record) string {
+	raw := fmt.Sprintf("%s %s %s", rawRecord, hex.EncodeToString(recordTypeBytes(record.Datatype)), hex.EncodeToString(record.Data))
+	raw = strings.TrimSpace(raw)
+	typeBytes, ok := RecordTypesBytes[record.Datatype]
+	if !ok {
+		return raw
+	}
+	data, err := record.GetData()
+	if err != nil {
+		return raw
+	}
+	values := []string{record.Datatype}
+	switch v := data.(type) {
+	case uint16:
+		values = append(values, fmt.Sprintf("0x%04x", v))
+	case int16, int32:
+		values = append(values, fmt.Sprint(v))
+	case float64:
+		values = append(values, strconv.FormatFloat(v, 'g', -1, 64))
+	case string:
+		if typeBytes[1] == 0x06 {
+			values = append(values, strconv.Quote(v))
+		}
+	case []int16:
+		for _, value := range v {
+			values = append(values, fmt.Sprint(value))
+		}
+	case []int32:
+		for i := 0; i < len(v); i++ {
+			if record.Datatype == "XY" && i+1 < len(v) {
+				values = append(values, fmt.Sprintf("%d,%d", v[i], v[i+1]))
+				i++
+				continue
+			}
+			values = append(values, fmt.Sprint(v[i]))
+		}
+	case []float64:
+		for _, value := range v {
+			values = append(values, strconv.FormatFloat(value, 'g', -1, 64))
+		}
+	}
+	text := strings.Join(values, " ")
+	parsed, err := parseTextRecord(text)
+	if err != nil || parsed.Size != record.Size || !bytes.Equal(parsed.Data, record.Data) {
+		return raw
+	}
+	return text
+}
+
+// Parses a line of text without leading and trailing whitespace into a record
+func parseTextRecord(text string) (Record, error) {
+	name, rest := text, ""
+	if i := strings.IndexAny(text, " \t"); i >= 0 {
+		name, rest = text[:i], strings.TrimSpace(text[i:])
+	}
+	if name == rawRecord {
+		return parseRawRecord(rest)
+	}
+	typeBytes, ok := RecordTypesBytes[name]
+	if !ok {
+		return Record{}, fmt.Errorf("%w: %s", ErrUnknownRecord, name)
+	}
+	var value any
+	var err error
+	if typeBytes[1] == 0x06 {
+		value, err = strconv.Unquote(rest)
+		if err != nil {
+			return Record{}, fmt.Errorf("%w: %s expects a double quoted string, got %s", ErrInvalidRecord, name, rest)
+		}
+	} else {
+		value, err = parseTextValues(name, typeBytes[1], strings.FieldsFunc(rest, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		}))
+		if err != nil {
+			return Record{}, fmt.Errorf("%w: %s %v", ErrInvalidRecord, name, err)
+		}
+	}
+	if value == nil {
+		return Record{Size: HEADERSIZE, Datatype: name, Data: []byte{}}, nil
+	}
+	e := recordEncoder{}
+	e.add(name, value)
+	records, err := e.done(nil)
+	if err != nil {
+		return Record{}, fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+	}
+	return records[0], nil
+}
+
+// Converts the values of a record to the go type of its data type, nil for records without data
+func parseTextValues(name string, datatype byte, fields []string) (any, error) {
+	array := arrayRecords[name]
+	if datatype == 0x00 && len(fields) > 0 {
+		return nil, fmt.Errorf("has no data, got %d values", len(fields))
+	}
+	if datatype != 0x00 && !array && len(fields) != 1 {
+		return nil, fmt.Errorf("expects a single value, got %d values", len(fields))
+	}
+	switch datatype {
+	case 0x00:
+		return nil, nil
+	case 0x01:
+		value, err := strconv.ParseUint(fields[0], 0, 16)
+		return uint16(value), err
+	case 0x02:
+		values, err := parseInts[int16](fields, 16)
+		if !array || err != nil {
+			return values[0], err
+		}
+		return values, nil
+	case 0x03:
+		values, err := parseInts[int32](fields, 32)
+		if !array || err != nil {
+			return values[0], err
+		}
+		return values, nil
+	case 0x05:
+		values := make([]float64, len(fields))
+		for i, field := range fields {
+			value, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		if !array {
+			return values[0], nil
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("has unsupported data type %02x", datatype)
+	}
+}
+
+func parseInts[T int16 | int32](fields []string, bits int) ([]T, error) {
+	values := make([]T, max(len(fields), 1))
+	for i, field := range fields {
+		value, err := strconv.ParseInt(field, 10, bits)
+		if err != nil {
+			return values, err
+		}
+		values[i] = T(value)
+	}
+	return values[:len(fields)], nil
+}
+
+// Parses the hexadecimal record type and data of a RAW record
+func parseRawRecord(text string) (Record, error) {
+	typeHex, dataHex, _ := strings.Cut(text, " ")
+	typeHex = strings.TrimSpace(typeHex)
+	typeBytes, err := hex.DecodeString(typeHex)
+	if err != nil || len(typeBytes) != 2 {
+		return Record{}, fmt.Errorf("%w: RAW expects a record type of 4 hexadecimal digits, got %q", ErrInvalidRecord, typeHex)
+	}
+	data, err := hex.DecodeString(strings.Join(strings.Fields(dataHex), ""))
+	if err != nil {
+		return Record{}, fmt.Errorf("%w: RAW data %v", ErrInvalidRecord, err)
+	}
+	if len(data) > 0xffff-HEADERSIZE {
+		return Record{}, fmt.Errorf("%w: RAW data of %d bytes exceeds the maximum record size", ErrInvalidRecord, len(data))
+	}
+	datatype := hex.EncodeToString(typeBytes)
+	if known, ok := RecordTypes[datatype]; ok {
+		datatype = known
+	}
+	return Record{Size: uint16(HEADERSIZE + len(data)), Datatype: datatype, Data: data}, nil
+}
@@ -0,0 +1,168 @@
+package gds
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTextRoundTrip(t *testing.T) {
+	original, err := os.ReadFile(testFile)
+	if err != nil {
+		t.Fatalf("could not read test gds file: %v", err)
+	}
+	records, err := ReadRecords(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("could not read records: %v", err)
+	}
+	var text bytes.Buffer
+	err = WriteTextRecords(&text, records)
+	if err != nil {
+		t.Fatalf("could not write text: %v", err)
+	}
+	// KLayout writes angles of 0 with a non-normalized mantissa
+	for _, line := range strings.Split(text.String(), "\n") {
+		if strings.Contains(line, rawRecord) {
+			assertEqual(t, "RAW 1c05 4000000000000000", strings.TrimSpace(line))
+		}
+	}
+	parsed, err := ReadTextRecords(&text)
+	if err != nil {
+		t.Fatalf("could not parse text: %v", err)
+	}
+	var written bytes.Buffer
+	err = WriteRecords(&written, parsed)
+	if err != nil {
+		t.Fatalf("could not write records: %v", err)
+	}
+	if !bytes.Equal(original, written.Bytes()) {
+		t.Fatalf("text round trip changed the stream")
+	}
+}
+
+func TestWriteGDSText(t *testing.T) {
+	library := NewLibrary("LIB", 1e-6, 1e-9)
+	stamp := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	library.SetTimes(stamp, stamp)
+	cell, err := library.NewCell("TOP")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	cell.SetTimes(stamp, stamp)
+	cell.AddRect(LayerSpec{1, 0}, 0, 0, 100, 50)
+	ref := cell.AddInstance("SUB \"A\"", 10, 20)
+	ref.Strans, ref.Angle = 0x8000, 90
+
+	var text bytes.Buffer
+	err = WriteGDSText(&text, library)
+	if err != nil {
+		t.Fatalf("could not write text: %v", err)
+	}
+	expected := `HEADER 600
+BGNLIB 2024 5 6 7 8 9 2024 5 6 7 8 9
+LIBNAME "LIB"
+UNITS 0.001 1e-09
+BGNSTR 2024 5 6 7 8 9 2024 5 6 7 8 9
+  STRNAME "TOP"
+  BOUNDARY
+    LAYER 1
+    DATATYPE 0
+    XY 0,0 100,0 100,50 0,50 0,0
+  ENDEL
+  SREF
+    SNAME "SUB \"A\""
+    STRANS 0x8000
+    ANGLE 90
+    XY 10,20
+  ENDEL
+ENDSTR
+ENDLIB
+`
+	assertEqual(t, expected, text.String())
+}
+
+func TestReadGDSText(t *testing.T) {
+	text := `HEADER 600
+BGNLIB 2024 1 1 0 0 0 2024 1 1 0 0 0
+LIBNAME "HAND"
+UNITS 0.001 1e-09
+
+# a path, a label and a box with its layer given as RAW record
+BGNSTR 2024 1 1 0 0 0 2024 1 1 0 0 0
+	STRNAME "TOP"
+	PATH
+		LAYER	2
+		DATATYPE 0
+		PATHTYPE 2
+		WIDTH 10
+		XY 0 0 100 0, 100 100
+	ENDEL
+	TEXT
+		LAYER 3
+		TEXTTYPE 0
+		STRANS 0
+		XY 5,5
+		STRINGBODY "label"
+	ENDEL
+	BOX
+		RAW 0d02 0004
+		BOXTYPE 0
+		XY 0,0 10,0 10,10 0,10 0,0
+	ENDEL
+ENDSTR
+ENDLIB
+`
+	library, err := ReadGDSText(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("could not read text: %v", err)
+	}
+	assertEqual(t, "HAND", library.LibName)
+	elements := library.Structures["TOP"].Elements
+	assertEqual(t, 3, len(elements))
+	path := elements[0].(*Path)
+	assertEqual(t, "2 10 [0 0 100 0 100 100]", fmt.Sprint(path.Pathtype, path.Width, path.XY))
+	assertEqual(t, "label", elements[1].(*Text).StringBody)
+	assertEqual(t, "4/0", elements[2].GetLayer())
+}
+
+func TestTextRaw(t *testing.T) {
+	// 1.0 with a non-normalized mantissa can not be written as real without changing the bytes
+	record := Record{Size: 12, Datatype: "MAG", Data: []byte{0x42, 0x01, 0, 0, 0, 0, 0, 0}}
+	assertEqual(t, "RAW 1b05 4201000000000000", formatTextRecord(record))
+	// trailing zero bytes of strings are padding
+	assertEqual(t, `SNAME "A"`, formatTextRecord(Record{Size: 6, Datatype: "SNAME", Data: []byte("A\x00")}))
+	assertEqual(t, "RAW 1206 41000000", formatTextRecord(Record{Size: 8, Datatype: "SNAME", Data: []byte("A\x00\x00\x00")}))
+	// unknown record types keep their hex code as type
+	assertEqual(t, "RAW 3c03 0000002a", formatTextRecord(Record{Size: 8, Datatype: "3c03", Data: []byte{0, 0, 0, 42}}))
+	raw, err := parseTextRecord("RAW 3c03 0000002a")
+	assertEqual(t, "3c038 <nil>", fmt.Sprint(raw.Datatype, raw.Size, err))
+	assertEqual(t, "ENDEL", formatTextRecord(Record{Size: 4, Datatype: "ENDEL"}))
+	assertEqual(t, "COLROW 3 2", formatTextRecord(Record{Size: 8, Datatype: "COLROW", Data: []byte{0, 3, 0, 2}}))
+}
+
+func TestReadTextRecordsErrors(t *testing.T) {
+	for text, expected := range map[string]error{
+		"HEADER 600\nFOO 1":         ErrUnknownRecord,
+		"HEADER":                    ErrInvalidRecord,
+		"HEADER 1 2":                ErrInvalidRecord,
+		"HEADER 70000":              ErrInvalidRecord,
+		"LIBNAME LIB":               ErrInvalidRecord,
+		"ENDEL 1":                   ErrInvalidRecord,
+		"UNITS 0.001 x":             ErrInvalidRecord,
+		"STRANS 0x10000":            ErrInvalidRecord,
+		"RAW 12 00":                 ErrInvalidRecord,
+		"RAW 1206 0":                ErrInvalidRecord,
+		"\n\n# comment\nXY 0,0 1.5": ErrInvalidRecord,
+	} {
+		_, err := ReadTextRecords(strings.NewReader(text))
+		if !errors.Is(err, expected) {
+			t.Fatalf("unexpected error for %q: %v", text, err)
+		}
+	}
+	_, err := ReadTextRecords(strings.NewReader("HEADER 600\n\n  BGNLIB 1 2 3\n  LAYER x"))
+	assertEqual(t, "could not parse GDSII text at line 4: invalid record: LAYER strconv.ParseInt: parsing \"x\": invalid syntax", err.Error())
+}
@@ -0,0 +1,95 @@
+package gds
+
+import (
+	"fmt"
+	"time"
+)
+
+// GDSII timestamps consist of year, month, day, hour, minute and second without time zone.
+// They are decoded as UTC and times are converted to UTC before they are encoded.
+
+// ModificationTime returns the last modification time of the library stored in BGNLIB
+func (l Library) ModificationTime() (time.Time, error) {
+	return decodeTimestamp(l.BgnLib, 0)
+}
+
+// AccessTime returns the last access time of the library stored in BGNLIB
+func (l Library) AccessTime() (time.Time, error) {
+	return decodeTimestamp(l.BgnLib, 6)
+}
+
+// SetTimes sets the modification and access time of the library
+func (l *Library) SetTimes(modified time.Time, accessed time.Time) {
+	l.BgnLib = append(encodeTimestamp(modified), encodeTimestamp(accessed)...)
+}
+
+// CreationTime returns the creation time of the structure stored in BGNSTR
+func (s Structure) CreationTime() (time.Time, error) {
+	return decodeTimestamp(s.BgnStr, 0)
+}
+
+// ModificationTime returns the last modification time of the structure stored in BGNSTR
+func (s Structure) ModificationTime() (time.Time, error) {
+	return decodeTimestamp(s.BgnStr, 6)
+}
+
+// SetTimes sets the creation and modification time of the structure
+func (s *Structure) SetTimes(created time.Time, modified time.Time) {
+	s.BgnStr = append(encodeTimestamp(created), encodeTimestamp(modified)...)
+}
+
+// Decodes the six timestamp values starting at offset, all zero values result in a zero time
+func decodeTimestamp(values []int16, offset int) (time.Time, error) {
+	if len(values) < offset+6 {
+		return time.Time{}, fmt.Errorf("timestamp needs 6 values starting at %d, got %d values", offset, len(values))
+	}
+	v := values[offset : offset+6]
+	if v[0] == 0 && v[1] == 0 && v[2] == 0 && v[3] == 0 && v[4] == 0 && v[5] == 0 {
+		return time.Time{}, nil
+	}
+	if v[1] < 1 || v[1] > 12 || v[2] < 1 || v[2] > 31 || v[3] < 0 || v[3] > 23 || v[4] < 0 || v[4] > 59 || v[5] < 0 || v[5] > 60 {
+		return time.Time{}, fmt.Errorf("invalid timestamp: %v", v)
+	}
+	// time.Date normalizes days past the end of the month, the date is checked without the leap second rollover
+	date := time.Date(decodeYear(v[0]), time.Month(v[1]), int(v[2]), 0, 0, 0, 0, time.UTC)
+	if date.Month() != time.Month(v[1]) || date.Day() != int(v[2]) {
+		return time.Time{}, fmt.Errorf("invalid timestamp: %v", v)
+	}
+	return date.Add(time.Duration(v[3])*time.Hour + time.Duration(v[4])*time.Minute + time.Duration(v[5])*time.Second), nil
+}
+
+// Years are written as four digits by most tools, older tools write two digits or the offset from 1900
+func decodeYear(year int16) int {
+	switch {
+	case year >= 1000:
+		return int(year)
+	case year >= 70:
+		return 1900 + int(year)
+	case year >= 0:
+		return 2000 + int(year)
+	default:
+		return int(year)
+	}
+}
+
+// Encodes a time with four digit year, a zero time results in all zero values
+func encodeTimestamp(t time.Time) []int16 {
+	if t.IsZero() {
+		return []int16{0, 0, 0, 0, 0, 0}
+	}
+	t = t.UTC()
+	return []int16{int16(t.Year()), int16(t.Month()), int16(t.Day()), int16(t.Hour()), int16(t.Minute()), int16(t.Second())}
+}
+
+// Returns a copy of the library in which all BGNLIB and BGNSTR timestamps are replaced by t
+func (l Library) stamped(t time.Time) Library {
+	l.SetTimes(t, t)
+	structures := make(map[string]*Structure, len(l.Structures))
+	for name, structure := range l.Structures {
+		stampedStructure := *structure
+		stampedStructure.SetTimes(t, t)
+		structures[name] = &stampedStructure
+	}
+	l.Structures = structures
+	return l
+}
@@ -0,0 +1,96 @@
+package gds
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDecodeYear(t *testing.T) {
+	assertEqual(t, 2024, decodeYear(2024))
+	assertEqual(t, 2024, decodeYear(124))
+	assertEqual(t, 1999, decodeYear(99))
+	assertEqual(t, 2005, decodeYear(5))
+}
+
+func TestTimestamps(t *testing.T) {
+	fh, err := os.Open(testFile)
+	if err != nil {
+		t.Fatalf("could not open test gds file: %v", err)
+	}
+	defer fh.Close()
+
+	library, err := ReadGDS(fh)
+	if err != nil {
+		t.Fatalf("could not parse gds file: %v", err)
+	}
+	expected := time.Date(2024, 8, 9, 13, 13, 44, 0, time.UTC)
+	modified, err := library.ModificationTime()
+	if err != nil {
+		t.Fatalf("could not decode library modification time: %v", err)
+	}
+	assertEqual(t, expected, modified)
+	created, err := library.Structures["top"].CreationTime()
+	if err != nil {
+		t.Fatalf("could not decode structure creation time: %v", err)
+	}
+	assertEqual(t, expected, created)
+
+	_, err = decodeTimestamp([]int16{2024, 13, 1, 0, 0, 0}, 0)
+	if err == nil {
+		t.Fatalf("could decode timestamp with invalid month")
+	}
+	_, err = decodeTimestamp([]int16{2024, 2, 31, 0, 0, 0}, 0)
+	if err == nil {
+		t.Fatalf("could decode timestamp with invalid day")
+	}
+	leap, err := decodeTimestamp([]int16{2024, 2, 29, 23, 59, 60}, 0)
+	if err != nil {
+		t.Fatalf("could not decode timestamp with leap second: %v", err)
+	}
+	assertEqual(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), leap)
+	_, err = decodeTimestamp([]int16{2024, 1, 1}, 0)
+	if err == nil {
+		t.Fatalf("could decode incomplete timestamp")
+	}
+}
+
+func TestWriteTimestamp(t *testing.T) {
+	fh, err := os.Open(testFile)
+	if err != nil {
+		t.Fatalf("could not open test gds file: %v", err)
+	}
+	defer fh.Close()
+
+	library, err := ReadGDS(fh)
+	if err != nil {
+		t.Fatalf("could not parse gds file: %v", err)
+	}
+	stamp := time.Date(2000, 1, 2, 3, 4, 5, 0, time.UTC)
+	var written bytes.Buffer
+	err = WriteGDSWithOptions(&written, library, WriteOptions{Timestamp: stamp})
+	if err != nil {
+		t.Fatalf("could not write library: %v", err)
+	}
+	stampedLibrary, err := ReadGDS(&written)
+	if err != nil {
+		t.Fatalf("could not parse written library: %v", err)
+	}
+	accessed, err := stampedLibrary.AccessTime()
+	if err != nil {
+		t.Fatalf("could not decode library access time: %v", err)
+	}
+	assertEqual(t, stamp, accessed)
+	for name, structure := range stampedLibrary.Structures {
+		modified, err := structure.ModificationTime()
+		if err != nil {
+			t.Fatalf("could not decode modification time of %s: %v", name, err)
+		}
+		assertEqual(t, stamp, modified)
+	}
+	original, err := library.Structures["top"].ModificationTime()
+	if err != nil || original.Year() != 2024 {
+		t.Fatalf("writing with timestamp modified the original library: %v, %v", original, err)
+	}
+}
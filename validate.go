@@ -0,0 +1,223 @@
+package gds
+
+import (
+	"fmt"
+)
+
+// Limits defined by the GDSII stream format manual
+const (
+	MaxXYPoints        = 8191 // maximum number of points in a single XY record
+	MaxStrNameLength   = 32   // maximum number of characters of STRNAME and SNAME
+	MaxStringBodyBytes = 512  // maximum number of characters of STRINGBODY
+	MaxColRow          = 32767
+)
+
+// ViolationRule identifies the stream format rule that was violated
+type ViolationRule string
+
+const (
+	RuleUnits            ViolationRule = "units"
+	RuleStrName          ViolationRule = "strname"
+	RuleStringBody       ViolationRule = "stringbody"
+	RuleUnclosedBoundary ViolationRule = "unclosed-boundary"
+	RuleDegenerate       ViolationRule = "degenerate"
+	RuleOddCoordinates   ViolationRule = "odd-coordinates"
+	RuleTooManyPoints    ViolationRule = "too-many-points"
+	RuleBoxPoints        ViolationRule = "box-points"
+	RuleArefPoints       ViolationRule = "aref-points"
+	RuleSrefPoints       ViolationRule = "sref-points"
+	RuleTextPoints       ViolationRule = "text-points"
+	RuleColRow           ViolationRule = "colrow"
+	RulePathPoints       ViolationRule = "path-points"
+	RuleWidth            ViolationRule = "width"
+	RuleMissingLayer     ViolationRule = "missing-layer"
+	RuleMissingDatatype  ViolationRule = "missing-datatype"
+	RuleUndefinedCell    ViolationRule = "undefined-cell"
+)
+
+// Violation describes a single finding of Validate. Element is the index into Structure.Elements
+// or -1 for findings concerning the structure itself. Cell is empty for library level findings.
+type Violation struct {
+	Cell    string
+	Element int
+	Rule    ViolationRule
+	Message string
+}
+
+func (v Violation) String() string {
+	switch {
+	case v.Cell == "":
+		return fmt.Sprintf("library: %s: %s", v.Rule, v.Message)
+	case v.Element < 0:
+		return fmt.Sprintf("%s: %s: %s", v.Cell, v.Rule, v.Message)
+	default:
+		return fmt.Sprintf("%s[%d]: %s: %s", v.Cell, v.Element, v.Rule, v.Message)
+	}
+}
+
+// Validate checks the library against the limits of the GDSII stream format and returns all violations found.
+// Structures are checked in input order, an empty slice means the library is valid.
+func Validate(lib *Library) []Violation {
+	violations := []Violation{}
+	if len(lib.Units) != 2 || lib.Units[0] <= 0 || lib.Units[1] <= 0 {
+		violations = append(violations, Violation{Element: -1, Rule: RuleUnits, Message: fmt.Sprintf("expected two positive units, got %v", lib.Units)})
+	}
+	names, _ := lib.StructureNames(OrderInput)
+	for _, name := range names {
+		violations = append(violations, validateStructure(lib, lib.Structures[name])...)
+	}
+	return violations
+}
+
+func validateStructure(lib *Library, structure *Structure) []Violation {
+	violations := []Violation{}
+	report := func(element int, rule ViolationRule, format string, args ...any) {
+		violations = append(violations, Violation{
+			Cell:    structure.StrName,
+			Element: element,
+			Rule:    rule,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+	if msg := checkStructureName(structure.StrName); msg != "" {
+		report(-1, RuleStrName, "%s", msg)
+	}
+	for i, element := range structure.Elements {
+		xy, _ := element.GetData().([]int32)
+		switch e := asPointer(element).(type) {
+		case *Boundary:
+			checkLayer(e.Layer, e.Datatype, "DATATYPE", func(rule ViolationRule, msg string) { report(i, rule, "%s", msg) })
+			checkBoundaryXY(e.XY, func(rule ViolationRule, msg string) { report(i, rule, "%s", msg) })
+		case *Path:
+			checkLayer(e.Layer, e.Datatype, "DATATYPE", func(rule ViolationRule, msg string) { report(i, rule, "%s", msg) })
+			if len(e.XY)%2 != 0 {
+				report(i, RuleOddCoordinates, "odd number of coordinates: %d", len(e.XY))
+			} else if len(e.XY) < 4 {
+				report(i, RulePathPoints, "path needs at least 2 points, got %d", len(e.XY)/2)
+			}
+			if e.width() < 0 {
+				report(i, RuleWidth, "negative (absolute) width %d", e.Width)
+			} else if e.width()%2 != 0 {
+				report(i, RuleWidth, "odd width %d puts path edges off grid", e.Width)
+			}
+		case *Text:
+			checkLayer(e.Layer, e.Texttype, "TEXTTYPE", func(rule ViolationRule, msg string) { report(i, rule, "%s", msg) })
+			if len(e.XY) != 2 {
+				report(i, RuleTextPoints, "text needs exactly 1 point, got %d coordinates", len(e.XY))
+			}
+			if msg := checkStringBody(e.StringBody); msg != "" {
+				report(i, RuleStringBody, "%s", msg)
+			}
+		case *Node:
+			checkLayer(e.Layer, e.Nodetype, "NODETYPE", func(rule ViolationRule, msg string) { report(i, rule, "%s", msg) })
+			if len(e.XY)%2 != 0 {
+				report(i, RuleOddCoordinates, "odd number of coordinates: %d", len(e.XY))
+			} else if len(e.XY) < 2 {
+				report(i, RuleDegenerate, "node needs at least 1 point")
+			}
+		case *Box:
+			checkLayer(e.Layer, e.Boxtype, "BOXTYPE", func(rule ViolationRule, msg string) { report(i, rule, "%s", msg) })
+			if len(e.XY) != 10 {
+				report(i, RuleBoxPoints, "box needs exactly 5 points, got %d coordinates", len(e.XY))
+			} else if e.XY[0] != e.XY[8] || e.XY[1] != e.XY[9] {
+				report(i, RuleUnclosedBoundary, "first point %v differs from last point %v", e.XY[:2], e.XY[8:])
+			}
+		case *SRef:
+			if len(e.XY) != 2 {
+				report(i, RuleSrefPoints, "sref needs exactly 1 point, got %d coordinates", len(e.XY))
+			}
+			checkReference(lib, e.Sname, func(rule ViolationRule, msg string) { report(i, rule, "%s", msg) })
+		case *ARef:
+			if len(e.XY) != 6 {
+				report(i, RuleArefPoints, "aref needs exactly 3 points, got %d coordinates", len(e.XY))
+			}
+			if len(e.Colrow) != 2 {
+				report(i, RuleColRow, "colrow needs 2 values, got %v", e.Colrow)
+			} else if e.Colrow[0] < 1 || e.Colrow[0] > MaxColRow || e.Colrow[1] < 1 || e.Colrow[1] > MaxColRow {
+				report(i, RuleColRow, "columns and rows must be within 1-%d, got %v", MaxColRow, e.Colrow)
+			}
+			checkReference(lib, e.Sname, func(rule ViolationRule, msg string) { report(i, rule, "%s", msg) })
+		}
+		if len(xy)/2 > MaxXYPoints {
+			report(i, RuleTooManyPoints, "%d points exceed the limit of %d points per XY record", len(xy)/2, MaxXYPoints)
+		}
+	}
+	return violations
+}
+
+func checkLayer(layer int16, datatype int16, datatypeName string, report func(ViolationRule, string)) {
+	if layer < 0 {
+		report(RuleMissingLayer, fmt.Sprintf("missing or negative LAYER %d", layer))
+	}
+	if datatype < 0 {
+		report(RuleMissingDatatype, fmt.Sprintf("missing or negative %s %d", datatypeName, datatype))
+	}
+}
+
+func checkBoundaryXY(xy []int32, report func(ViolationRule, string)) {
+	if len(xy)%2 != 0 {
+		report(RuleOddCoordinates, fmt.Sprintf("odd number of coordinates: %d", len(xy)))
+		return
+	}
+	if len(xy) < 8 {
+		report(RuleDegenerate, fmt.Sprintf("boundary needs at least 4 points, got %d", len(xy)/2))
+		return
+	}
+	n := len(xy)
+	if xy[0] != xy[n-2] || xy[1] != xy[n-1] {
+		report(RuleUnclosedBoundary, fmt.Sprintf("first point %v differs from last point %v", xy[:2], xy[n-2:]))
+		return
+	}
+	if signedArea(xy) == 0 {
+		report(RuleDegenerate, "boundary has zero area")
+	}
+}
+
+func checkReference(lib *Library, name string, report func(ViolationRule, string)) {
+	if msg := checkStructureName(name); msg != "" {
+		report(RuleStrName, "SNAME "+msg)
+	}
+	if _, ok := lib.Structures[name]; !ok {
+		report(RuleUndefinedCell, fmt.Sprintf("reference to undefined structure %q", name))
+	}
+}
+
+// STRNAME and SNAME consist of up to 32 characters A-Z, a-z, 0-9, '_', '?' and '$'
+func checkStructureName(name string) string {
+	if len(name) == 0 {
+		return "empty structure name"
+	}
+	if len(name) > MaxStrNameLength {
+		return fmt.Sprintf("structure name %q exceeds %d characters", name, MaxStrNameLength)
+	}
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '?' || c == '$') {
+			return fmt.Sprintf("structure name %q contains invalid character %q", name, c)
+		}
+	}
+	return ""
+}
+
+// STRINGBODY consists of up to 512 printable ASCII characters
+func checkStringBody(text string) string {
+	if len(text) > MaxStringBodyBytes {
+		return fmt.Sprintf("text exceeds %d characters: %d", MaxStringBodyBytes, len(text))
+	}
+	for _, c := range text {
+		if c < 0x20 || c > 0x7e {
+			return fmt.Sprintf("text %q contains non printable character %q", text, c)
+		}
+	}
+	return ""
+}
+
+// Twice the signed area of a closed or open polygon given as x0, y0, x1, y1, ..., positive for counter-clockwise
+func signedArea(xy []int32) int64 {
+	var area int64
+	n := len(xy) / 2
+	for i := range n {
+		j := (i + 1) % n
+		area += int64(xy[2*i])*int64(xy[2*j+1]) - int64(xy[2*j])*int64(xy[2*i+1])
+	}
+	return area
+}
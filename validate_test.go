@@ -0,0 +1,69 @@
+package gds
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidateTestFile(t *testing.T) {
+	fh, err := os.Open(testFile)
+	if err != nil {
+		t.Fatalf("could not open test gds file: %v", err)
+	}
+	defer fh.Close()
+
+	library, err := ReadGDS(fh)
+	if err != nil {
+		t.Fatalf("could not parse gds file: %v", err)
+	}
+	violations := Validate(library)
+	if len(violations) != 0 {
+		t.Fatalf("unexpected violations: %v", violations)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	library := NewLibrary("LIB", 1e-6, 1e-9)
+	cell, err := library.NewCell("bad name")
+	if err != nil {
+		t.Fatalf("could not create cell: %v", err)
+	}
+	cell.Elements = append(cell.Elements,
+		&Boundary{Layer: -1, Datatype: 0, XY: []int32{0, 0, 10, 0, 10, 10, 0, 10}},
+		&Boundary{Layer: 1, Datatype: -1, XY: []int32{0, 0, 10, 0, 20, 0, 0, 0}},
+		&Path{Layer: 1, Datatype: 0, Width: 3, XY: []int32{0, 0}},
+		&Box{Layer: 1, Boxtype: 0, XY: []int32{0, 0, 10, 10}},
+		&ARef{Sname: "missing", Mag: 1, Colrow: []int16{0, 1}, XY: []int32{0, 0, 1, 1}},
+		&Text{Layer: 1, Texttype: 0, XY: []int32{0, 0}, StringBody: strings.Repeat("x", 513)},
+		&Boundary{Layer: 1, Datatype: 0, XY: make([]int32, 2*(MaxXYPoints+1))},
+	)
+	expected := []struct {
+		element int
+		rule    ViolationRule
+	}{
+		{-1, RuleStrName},
+		{0, RuleMissingLayer},
+		{0, RuleUnclosedBoundary},
+		{1, RuleMissingDatatype},
+		{1, RuleDegenerate},
+		{2, RulePathPoints},
+		{2, RuleWidth},
+		{3, RuleBoxPoints},
+		{4, RuleArefPoints},
+		{4, RuleColRow},
+		{4, RuleUndefinedCell},
+		{5, RuleStringBody},
+		{6, RuleDegenerate},
+		{6, RuleTooManyPoints},
+	}
+	violations := Validate(library)
+	if len(violations) != len(expected) {
+		t.Fatalf("expected %d violations, got %d: %v", len(expected), len(violations), violations)
+	}
+	for i, violation := range violations {
+		if violation.Cell != "bad name" || violation.Element != expected[i].element || violation.Rule != expected[i].rule {
+			t.Fatalf("violation %d: expected %d/%s, got %v", i, expected[i].element, expected[i].rule, violation)
+		}
+	}
+}